@@ -0,0 +1,88 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"time"
+)
+
+const (
+	// The number of resolutions considered each time the frequency is adjusted
+	adaptiveWindow = 20
+
+	// The failure ratio above which the frequency is backed off
+	adaptiveBackoffRatio = 0.1
+
+	// The failure ratio below which the frequency is sped up
+	adaptiveSpeedupRatio = 0.02
+)
+
+// AdaptiveRate - Returns the bounds of the frequency when it adapts to the failure rate,
+// with a zero maximum when the adaptive rate is disabled
+func (ds *DNSService) AdaptiveRate() (min, max time.Duration) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.minFrequency, ds.maxFrequency
+}
+
+// SetAdaptiveRate - Causes the frequency to adapt to the observed failure rate within the bounds.
+// Much like TCP congestion control, the time between names is doubled when timeouts and server
+// failures spike, and reduced gradually while the names resolve. A zero maximum disables it
+func (ds *DNSService) SetAdaptiveRate(min, max time.Duration) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	if min > max {
+		min, max = max, min
+	}
+	ds.minFrequency = min
+	ds.maxFrequency = max
+	ds.rateOutcomes = 0
+	ds.rateFailures = 0
+	if max > 0 {
+		ds.frequency = clampDuration(ds.frequency, min, max)
+	}
+}
+
+// adaptRate records the outcome of a resolution, and adjusts the frequency
+// once enough outcomes have been observed
+func (ds *DNSService) adaptRate(err error) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	if ds.maxFrequency <= 0 {
+		return
+	}
+
+	ds.rateOutcomes++
+	switch err {
+	case ErrTimeout, ErrServFail, ErrRefused:
+		ds.rateFailures++
+	}
+	if ds.rateOutcomes < adaptiveWindow {
+		return
+	}
+
+	ratio := float64(ds.rateFailures) / float64(ds.rateOutcomes)
+	ds.rateOutcomes = 0
+	ds.rateFailures = 0
+	switch {
+	case ratio > adaptiveBackoffRatio:
+		ds.frequency *= 2
+	case ratio < adaptiveSpeedupRatio:
+		ds.frequency -= ds.frequency / 10
+	}
+	ds.frequency = clampDuration(ds.frequency, ds.minFrequency, ds.maxFrequency)
+}
+
+func clampDuration(d, min, max time.Duration) time.Duration {
+	if d < min {
+		return min
+	}
+	if d > max {
+		return max
+	}
+	return d
+}
@@ -0,0 +1,47 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdaptiveRate(t *testing.T) {
+	srv := NewDNSService(nil, nil)
+	srv.SetFrequency(10 * time.Millisecond)
+	srv.SetAdaptiveRate(time.Millisecond, 50*time.Millisecond)
+
+	// Timeouts back off the frequency until the maximum is reached
+	for i := 0; i < 5*adaptiveWindow; i++ {
+		srv.adaptRate(ErrTimeout)
+	}
+	if freq := srv.Frequency(); freq != 50*time.Millisecond {
+		t.Errorf("The frequency was %v after the timeouts instead of the maximum", freq)
+	}
+
+	// Successful resolutions speed it back up
+	for i := 0; i < adaptiveWindow; i++ {
+		srv.adaptRate(nil)
+	}
+	if freq := srv.Frequency(); freq != 45*time.Millisecond {
+		t.Errorf("The frequency was %v after the successes instead of 45ms", freq)
+	}
+	// Names that do not exist are not failures of the servers
+	for i := 0; i < 100*adaptiveWindow; i++ {
+		srv.adaptRate(ErrNXDOMAIN)
+	}
+	if freq := srv.Frequency(); freq != time.Millisecond {
+		t.Errorf("The frequency was %v instead of the minimum", freq)
+	}
+
+	srv.SetAdaptiveRate(0, 0)
+	srv.SetFrequency(10 * time.Millisecond)
+	for i := 0; i < adaptiveWindow; i++ {
+		srv.adaptRate(ErrTimeout)
+	}
+	if freq := srv.Frequency(); freq != 10*time.Millisecond {
+		t.Errorf("The frequency changed to %v while the adaptive rate was disabled", freq)
+	}
+}
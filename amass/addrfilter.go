@@ -0,0 +1,144 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"net"
+
+	"github.com/caffix/amass/amass/stringset"
+	"github.com/caffix/recon"
+)
+
+// The private, loopback, link-local and other reserved address ranges
+var reservedCIDRs = []string{
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.0.2.0/24",
+	"192.88.99.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"198.51.100.0/24",
+	"203.0.113.0/24",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"64:ff9b::/96",
+	"100::/64",
+	"2001:db8::/32",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+}
+
+var reservedNetworks []*net.IPNet
+
+func init() {
+	for _, cidr := range reservedCIDRs {
+		if _, ipnet, err := net.ParseCIDR(cidr); err == nil {
+			reservedNetworks = append(reservedNetworks, ipnet)
+		}
+	}
+}
+
+// ExcludePrivateIPs - Returns true if private and reserved addresses are removed from the results
+func (ds *DNSService) ExcludePrivateIPs() bool {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.excludePrivate
+}
+
+// SetExcludePrivateIPs - Causes private, loopback, link-local and other reserved addresses to be
+// removed from the answers, and names resolving only to such addresses are not reported
+func (ds *DNSService) SetExcludePrivateIPs(exclude bool) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.excludePrivate = exclude
+}
+
+// AddressBlacklist - Returns the addresses that are treated as wildcards for every zone
+func (ds *DNSService) AddressBlacklist() []string {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.blacklist.ToStrings()
+}
+
+// SetAddressBlacklist - Sets the addresses, such as those of parking services, that are treated
+// as wildcards for every zone. Names resolving to them are dropped, including names from searches
+func (ds *DNSService) SetAddressBlacklist(addrs []string) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.blacklist = stringset.NewStringSet()
+	ds.blacklist.AddAll(addrs)
+}
+
+func (ds *DNSService) blacklisted(addrs []string) bool {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.blacklist.ContainsAny(addrs)
+}
+
+// WildcardWhitelist - Returns the addresses that are never treated as wildcard matches
+func (ds *DNSService) WildcardWhitelist() []string {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.whitelist.ToStrings()
+}
+
+// SetWildcardWhitelist - Sets the addresses, such as those of known-good shared hosts, that are never
+// treated as wildcard matches, even when detection finds a wildcard providing them
+func (ds *DNSService) SetWildcardWhitelist(addrs []string) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.whitelist = stringset.NewStringSet()
+	ds.whitelist.AddAll(addrs)
+}
+
+// whitelisted checks if any of the addresses are exempt from wildcard matching
+func (ds *DNSService) whitelisted(addrs []string) bool {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.whitelist.ContainsAny(addrs)
+}
+
+// reservedAddress checks if the IPv4 or IPv6 address falls within a reserved range
+func reservedAddress(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+
+	for _, ipnet := range reservedNetworks {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutReserved returns the answers without the A and AAAA records for reserved addresses
+func withoutReserved(answers []recon.DNSAnswer) []recon.DNSAnswer {
+	var result []recon.DNSAnswer
+
+	for _, a := range answers {
+		if (a.Type == 1 || a.Type == 28) && reservedAddress(a.Data) {
+			continue
+		}
+		result = append(result, a)
+	}
+	return result
+}
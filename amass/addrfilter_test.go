@@ -0,0 +1,160 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caffix/recon"
+)
+
+func TestReservedAddress(t *testing.T) {
+	tests := map[string]bool{
+		"10.1.2.3":             true,
+		"172.16.5.4":           true,
+		"192.168.1.1":          true,
+		"127.0.0.1":            true,
+		"169.254.10.10":        true,
+		"100.64.0.1":           true,
+		"::1":                  true,
+		"fe80::1":              true,
+		"fd00::1":              true,
+		"8.8.8.8":              false,
+		"172.32.0.1":           false,
+		"2001:4860:4860::8888": false,
+		"not an address":       false,
+	}
+
+	for addr, reserved := range tests {
+		if got := reservedAddress(addr); got != reserved {
+			t.Errorf("reservedAddress(%q) returned %t instead of %t", addr, got, reserved)
+		}
+	}
+}
+
+func TestExcludePrivateIPs(t *testing.T) {
+	srv, out, done := newTestService(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		if qtype != "A" {
+			return nil, testNoRecords(name)
+		}
+		switch name {
+		case "internal.example.com":
+			return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "10.0.0.5"}}, nil
+		case "mixed.example.com":
+			return []recon.DNSAnswer{
+				{Name: name, Type: 1, TTL: 60, Data: "192.168.1.5"},
+				{Name: name, Type: 1, TTL: 60, Data: "8.8.8.8"},
+			}, nil
+		}
+		return nil, testNXDOMAIN(name)
+	})
+	defer done()
+
+	srv.SetExcludePrivateIPs(true)
+	srv.Start()
+
+	srv.performDNSRequest(&AmassRequest{Name: "internal.example.com", Domain: "example.com", Tag: SEARCH})
+	srv.performDNSRequest(&AmassRequest{Name: "mixed.example.com", Domain: "example.com", Tag: SEARCH})
+
+	results := make(map[string]*AmassRequest)
+	timeout := time.After(time.Second)
+loop:
+	for {
+		select {
+		case req := <-out:
+			results[req.Name] = req
+		case <-timeout:
+			break loop
+		}
+	}
+
+	if _, found := results["internal.example.com"]; found {
+		t.Errorf("The name resolving to a private address was reported")
+	}
+	if req, found := results["mixed.example.com"]; !found {
+		t.Errorf("The name resolving to a public address was not reported")
+	} else if req.Address != "8.8.8.8" || len(req.Addresses) != 1 {
+		t.Errorf("The private address was not removed: %s %v", req.Address, req.Addresses)
+	}
+}
+
+func TestAddressBlacklist(t *testing.T) {
+	srv, out, done := newTestService(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		if qtype == "A" && strings.HasSuffix(name, ".example.com") {
+			return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "198.51.100.7"}}, nil
+		}
+		return nil, testNoRecords(name)
+	})
+	defer done()
+
+	srv.SetAddressBlacklist([]string{"198.51.100.7"})
+	if list := srv.AddressBlacklist(); len(list) != 1 || list[0] != "198.51.100.7" {
+		t.Errorf("The blacklist was not returned: %v", list)
+	}
+	srv.Start()
+
+	srv.performDNSRequest(&AmassRequest{Name: "parked.example.com", Domain: "example.com", Tag: SEARCH})
+	select {
+	case req := <-out:
+		t.Errorf("The name %s resolving to a blacklisted address was reported", req.Name)
+	case <-time.After(250 * time.Millisecond):
+	}
+
+	if stats := srv.Stats(); stats.WildcardFiltered != 1 {
+		t.Errorf("The blacklisted address was not counted as filtered")
+	}
+}
+
+func TestAddressBlacklistAnyAddress(t *testing.T) {
+	srv, out, done := newTestService(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		if qtype == "A" && strings.HasSuffix(name, ".example.com") {
+			return []recon.DNSAnswer{
+				{Name: name, Type: 1, TTL: 60, Data: "192.0.2.10"},
+				{Name: name, Type: 1, TTL: 60, Data: "198.51.100.7"},
+			}, nil
+		}
+		return nil, testNoRecords(name)
+	})
+	defer done()
+
+	srv.SetAddressBlacklist([]string{"198.51.100.7"})
+	srv.Start()
+
+	// The blacklisted address is not the first one, so only req.Addresses carries it
+	srv.performDNSRequest(&AmassRequest{Name: "parked.example.com", Domain: "example.com", Tag: SEARCH})
+	select {
+	case req := <-out:
+		t.Errorf("The name %s resolving to a blacklisted address was reported: %v", req.Name, req.Addresses)
+	case <-time.After(250 * time.Millisecond):
+	}
+}
+
+func TestWildcardWhitelist(t *testing.T) {
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		if qtype != "A" {
+			return nil, testNoRecords(name)
+		}
+		return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "192.0.2.50"}}, nil
+	})()
+
+	srv := NewDNSService(make(chan *AmassRequest), make(chan *AmassRequest, 10))
+	srv.SetRecordMode(RecordAOnly)
+	srv.Start()
+	defer srv.Stop()
+
+	req := &AmassRequest{Name: "www.example.com", Domain: "example.com", Address: "192.0.2.50"}
+	if !srv.dnsWildcardMatch(req) {
+		t.Fatalf("The name did not match the wildcard")
+	}
+
+	srv.SetWildcardWhitelist([]string{"192.0.2.50"})
+	if list := srv.WildcardWhitelist(); len(list) != 1 || list[0] != "192.0.2.50" {
+		t.Errorf("WildcardWhitelist returned %v", list)
+	}
+	if srv.dnsWildcardMatch(req) {
+		t.Errorf("The whitelisted address was treated as a wildcard match")
+	}
+}
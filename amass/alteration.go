@@ -78,28 +78,28 @@ func (as *AlterationService) flipNumbersInName(req *AmassRequest) {
 	for i := 0; i < 10; i++ {
 		sf := n[:first] + strconv.Itoa(i) + n[first+1:]
 
-		as.secondNumberFlip(sf, req.Domain, first+1)
+		as.secondNumberFlip(sf, req.Domain, first+1, req.Round+1)
 	}
 	// Take the first number out
-	as.secondNumberFlip(n[:first]+n[first+1:], req.Domain, -1)
+	as.secondNumberFlip(n[:first]+n[first+1:], req.Domain, -1, req.Round+1)
 }
 
-func (as *AlterationService) secondNumberFlip(name, domain string, minIndex int) {
+func (as *AlterationService) secondNumberFlip(name, domain string, minIndex, round int) {
 	parts := strings.SplitN(name, ".", 2)
 	// Find the second character that is a number
 	last := strings.LastIndexFunc(parts[0], unicode.IsNumber)
 	if last < 0 || last < minIndex {
-		as.sendAlteredName(name, domain)
+		as.sendAlteredName(name, domain, round)
 		return
 	}
 	// Flip those numbers and send out the mutations
 	for i := 0; i < 10; i++ {
 		n := name[:last] + strconv.Itoa(i) + name[last+1:]
 
-		as.sendAlteredName(n, domain)
+		as.sendAlteredName(n, domain, round)
 	}
 	// Take the second number out
-	as.sendAlteredName(name[:last]+name[last+1:], domain)
+	as.sendAlteredName(name[:last]+name[last+1:], domain, round)
 }
 
 // appendNumbers - Method for appending a number to a subdomain name
@@ -110,10 +110,10 @@ func (as *AlterationService) appendNumbers(req *AmassRequest) {
 	for i := 0; i < 10; i++ {
 		// Send a LABEL-NUM altered name
 		nhn := parts[0] + "-" + strconv.Itoa(i) + "." + parts[1]
-		as.sendAlteredName(nhn, req.Domain)
+		as.sendAlteredName(nhn, req.Domain, req.Round+1)
 		// Send a LABELNUM altered name
 		nn := parts[0] + strconv.Itoa(i) + "." + parts[1]
-		as.sendAlteredName(nn, req.Domain)
+		as.sendAlteredName(nn, req.Domain, req.Round+1)
 	}
 }
 
@@ -139,7 +139,7 @@ func (as *AlterationService) suffixWord(name, word, domain string) {
 }
 */
 // Checks that the name is valid and sends along for DNS resolve
-func (as *AlterationService) sendAlteredName(name, domain string) {
+func (as *AlterationService) sendAlteredName(name, domain string, round int) {
 	re := SubdomainRegex(domain)
 
 	if re.MatchString(name) {
@@ -148,6 +148,7 @@ func (as *AlterationService) sendAlteredName(name, domain string) {
 			Domain: domain,
 			Tag:    ALT,
 			Source: "Alterations",
+			Round:  round,
 		})
 	}
 }
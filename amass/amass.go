@@ -18,6 +18,7 @@ const (
 	BRUTE   = "brute"
 	SEARCH  = "search"
 	ARCHIVE = "archive"
+	BUILTIN = "builtin"
 
 	// This regular expression + the base domain will match on all names and subdomains
 	SUBRE = "(([a-zA-Z0-9]{1}|[a-zA-Z0-9]{1}[a-zA-Z0-9-]{0,61}[a-zA-Z0-9]{1})[.]{1})+"
@@ -49,6 +50,11 @@ func StartAmass(config *AmassConfig) {
 	config.Frequency *= 2
 	dnsSrv := NewDNSService(dns, dnsMux)
 	dnsSrv.SetFrequency(config.Frequency)
+	dnsSrv.SetMaxRound(config.MaxRound)
+	if len(config.FallbackServers) > 0 {
+		dnsSrv.SetFallbackServers(config.FallbackServers)
+		dnsSrv.SetSelectionMode(FallbackSelection)
+	}
 	reverseipSrv := NewReverseIPService(reverseip, dns)
 	reverseipSrv.SetFrequency(config.Frequency)
 	// Add these service to the slice
@@ -94,6 +100,7 @@ func StartAmass(config *AmassConfig) {
 		if config.BruteForcing {
 			brute <- req
 		}
+		submitPrefixes(domain, config.Prefixes, dns)
 	}
 	// We periodically check if all the services have finished
 	t := time.NewTicker(10 * time.Second)
@@ -140,6 +147,22 @@ func sendOut(req *AmassRequest, out chan *AmassRequest) {
 	out <- req
 }
 
+// submitPrefixes - Combines the high-value prefixes with the domain and sends the names for resolution
+func submitPrefixes(domain string, prefixes []string, out chan *AmassRequest) {
+	if prefixes == nil {
+		prefixes = DefaultPrefixes
+	}
+
+	for _, prefix := range prefixes {
+		go sendOut(&AmassRequest{
+			Name:   prefix + "." + domain,
+			Domain: domain,
+			Tag:    BUILTIN,
+			Source: "Builtin Prefixes",
+		}, out)
+	}
+}
+
 // NewUniqueElements - Removes elements that have duplicates in the original or new elements
 func NewUniqueElements(orig []string, add ...string) []string {
 	var n []string
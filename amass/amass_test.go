@@ -0,0 +1,66 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"testing"
+	"time"
+
+	"github.com/caffix/amass/amass/stringset"
+)
+
+func TestSubmitPrefixes(t *testing.T) {
+	collect := func(prefixes []string) *stringset.StringSet {
+		out := make(chan *AmassRequest, 20)
+		submitPrefixes("example.com", prefixes, out)
+
+		names := stringset.NewStringSet()
+		timeout := time.After(100 * time.Millisecond)
+		for {
+			select {
+			case req := <-out:
+				if req.Domain != "example.com" || req.Tag != BUILTIN {
+					t.Errorf("%s was submitted with domain %s and tag %s", req.Name, req.Domain, req.Tag)
+				}
+				names.Add(req.Name)
+			case <-timeout:
+				return names
+			}
+		}
+	}
+
+	names := collect(nil)
+	if len(names.ToStrings()) != len(DefaultPrefixes) || !names.Contains("vpn.example.com") {
+		t.Errorf("The default prefixes were submitted as %v", names.ToStrings())
+	}
+
+	names = collect([]string{"portal"})
+	if n := names.ToStrings(); len(n) != 1 || n[0] != "portal.example.com" {
+		t.Errorf("The configured prefixes were submitted as %v", n)
+	}
+
+	if n := collect([]string{}).ToStrings(); len(n) != 0 {
+		t.Errorf("The disabled prefixes submitted %v", n)
+	}
+
+	if c := customConfig(AmassConfig{Prefixes: []string{}}); c.Prefixes == nil || len(c.Prefixes) != 0 {
+		t.Errorf("The empty prefixes were replaced with %v", c.Prefixes)
+	}
+}
+
+func TestCustomConfig(t *testing.T) {
+	servers := []string{"192.0.2.1:53", "192.0.2.2:53"}
+
+	c := customConfig(AmassConfig{MaxRound: 3, FallbackServers: servers})
+	if c.MaxRound != 3 {
+		t.Errorf("The maximum round was set to %d", c.MaxRound)
+	}
+	if len(c.FallbackServers) != 2 || c.FallbackServers[0] != servers[0] || c.FallbackServers[1] != servers[1] {
+		t.Errorf("The fallback servers were set to %v", c.FallbackServers)
+	}
+	// Negative rounds do not limit the discovery
+	if c := customConfig(AmassConfig{MaxRound: -1}); c.MaxRound != 0 {
+		t.Errorf("The negative maximum round was kept as %d", c.MaxRound)
+	}
+}
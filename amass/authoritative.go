@@ -0,0 +1,301 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/caffix/recon"
+)
+
+// authServers holds the authoritative nameservers discovered for each domain
+type authServers struct {
+	sync.Mutex
+	servers map[string][]string
+
+	// Every server discovered for the domains
+	known map[string]struct{}
+
+	// Domains currently being looked up, closed once the servers are stored
+	inflight map[string]chan struct{}
+}
+
+func newAuthServers() *authServers {
+	return &authServers{
+		servers:  make(map[string][]string),
+		known:    make(map[string]struct{}),
+		inflight: make(map[string]chan struct{}),
+	}
+}
+
+// has returns true if the server was discovered as an authoritative server of a domain
+func (as *authServers) has(server string) bool {
+	as.Lock()
+	defer as.Unlock()
+
+	_, found := as.known[server]
+	return found
+}
+
+// Authoritative - Returns true if names are resolved against the authoritative servers of their domain
+func (ds *DNSService) Authoritative() bool {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.authoritative
+}
+
+// SetAuthoritative - Causes names to be resolved against the authoritative servers of their domain,
+// discovered through an NS lookup, instead of the public recursive servers. The public servers
+// are still used when the authoritative servers cannot be reached
+func (ds *DNSService) SetAuthoritative(enabled bool) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.authoritative = enabled
+}
+
+// AuthoritativeServers - Returns the authoritative nameservers (ip:53) discovered for the domain
+func (ds *DNSService) AuthoritativeServers(domain string) []string {
+	ds.auth.Lock()
+	defer ds.auth.Unlock()
+
+	return ds.auth.servers[domain]
+}
+
+// nameserversFor returns the authoritative servers for the domain, performing the NS lookup the
+// first time the domain is seen. Lookups that failed, such as by timing out, are performed again later
+func (ds *DNSService) nameserversFor(domain string) []string {
+	as := ds.auth
+
+	as.Lock()
+	if servers, found := as.servers[domain]; found {
+		as.Unlock()
+		return servers
+	}
+	// Check if another goroutine is already looking up the servers for this domain
+	if wait, found := as.inflight[domain]; found {
+		as.Unlock()
+		<-wait
+
+		as.Lock()
+		defer as.Unlock()
+		return as.servers[domain]
+	}
+	wait := make(chan struct{})
+	as.inflight[domain] = wait
+	as.Unlock()
+
+	servers, err := ds.lookupNameservers(domain, ds.nextNameserver())
+
+	as.Lock()
+	// Only the domains known to exist with or without the records are cached
+	if err == nil || err == ErrNXDOMAIN || err == ErrNoRecords {
+		as.servers[domain] = servers
+	}
+	for _, server := range servers {
+		as.known[server] = struct{}{}
+	}
+	delete(as.inflight, domain)
+	as.Unlock()
+	close(wait)
+	return servers
+}
+
+// lookupNameservers obtains the NS records for the domain and resolves the addresses of the servers.
+// The error is returned when the NS lookup failed, or none of the servers could be resolved
+func (ds *DNSService) lookupNameservers(domain, server string) ([]string, error) {
+	var servers []string
+
+	// Only the NS records are kept, since the answer can also carry CNAME and other records
+	answers, err := ds.dnsQueryNS(domain, server)
+	if err != nil {
+		// The domains that do not exist are recognized by nameserversFor
+		return servers, err
+	}
+
+	var aErr error
+	for _, a := range answers {
+		addrs, err := ds.query(a.Data, server, "A")
+		if err != nil {
+			aErr = err
+			continue
+		}
+		for _, addr := range addrs {
+			if addr.Type == 1 {
+				servers = UniqueAppend(servers, net.JoinHostPort(addr.Data, "53"))
+			}
+		}
+	}
+	if len(servers) == 0 && aErr != nil {
+		return servers, aErr
+	}
+	return servers, nil
+}
+
+// Discrepancy - The differing addresses obtained from a recursive and an authoritative server
+type Discrepancy struct {
+	Recursive     []string
+	Authoritative []string
+}
+
+// CompareAuthoritative - Returns true if resolved names are also checked against the authoritative servers
+func (ds *DNSService) CompareAuthoritative() bool {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.compareAuth
+}
+
+// SetCompareAuthoritative - Causes each resolved name to also be resolved against the authoritative
+// servers of its domain, and flagged when the answers disagree with the recursive resolution.
+// This roughly doubles the number of queries for the resolved names
+func (ds *DNSService) SetCompareAuthoritative(enabled bool) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.compareAuth = enabled
+}
+
+// compareResolution resolves the name against the authoritative servers and the public recursive
+// servers, returning the differing addresses or nil when they agree or cannot be compared
+func (ds *DNSService) compareResolution(domain, name string, answers []recon.DNSAnswer, server string) *Discrepancy {
+	servers := ds.nameserversFor(domain)
+	if len(servers) == 0 {
+		return nil
+	}
+
+	auth, err := ds.queryFirst(domain, name, servers)
+	if err != nil && err != ErrNXDOMAIN && err != ErrNoRecords && err != ErrCNAMEDepth {
+		return nil
+	}
+	// Obtain a recursive answer if the name was resolved against an authoritative server
+	for _, s := range servers {
+		if s == server {
+			answers, err = ds.dnsQuery(domain, name, ds.nextNameserver())
+			if err != nil && err != ErrNXDOMAIN && err != ErrNoRecords && err != ErrCNAMEDepth {
+				return nil
+			}
+			break
+		}
+	}
+
+	recursive, authoritative := addressSet(answers), addressSet(auth)
+	if recursive.Equal(authoritative) && authoritative.Equal(recursive) {
+		return nil
+	}
+	return &Discrepancy{
+		Recursive:     sortedStrings(recursive),
+		Authoritative: sortedStrings(authoritative),
+	}
+}
+
+// queryFirst returns the answers from the first server that can be reached
+func (ds *DNSService) queryFirst(domain, name string, servers []string) ([]recon.DNSAnswer, error) {
+	var err error
+
+	for _, server := range servers {
+		var answers []recon.DNSAnswer
+
+		answers, err = ds.dnsQuery(domain, name, server)
+		if err == nil || err == ErrNXDOMAIN || err == ErrNoRecords || err == ErrCNAMEDepth {
+			return answers, err
+		}
+	}
+	return []recon.DNSAnswer{}, err
+}
+
+// ZoneSerial - Returns the SOA serial of the domain, obtained from one of its authoritative servers.
+// Monitors can compare serials to skip re-enumerating zones that have not changed
+func (ds *DNSService) ZoneSerial(domain string) (uint32, error) {
+	servers := ds.nameserversFor(domain)
+	if len(servers) == 0 {
+		return 0, errors.New("No authoritative servers were discovered for " + domain)
+	}
+
+	err := ErrNoRecords
+	for _, server := range servers {
+		answers, qerr := ds.query(domain, server, "SOA")
+		if qerr != nil {
+			err = ClassifyError(qerr)
+			// The other servers will not make the zone exist
+			if err == ErrNXDOMAIN {
+				break
+			}
+			continue
+		}
+
+		for _, a := range answers {
+			if serial, ok := soaSerial(a.Data); ok {
+				return serial, nil
+			}
+		}
+	}
+	return 0, err
+}
+
+// soaSerial extracts the serial from SOA record data, which may or may not include the owner, TTL and type
+func soaSerial(data string) (uint32, bool) {
+	fields := soaFields(data)
+	// The serial follows the primary nameserver and the responsible mailbox
+	if len(fields) < 3 {
+		return 0, false
+	}
+
+	serial, err := strconv.ParseUint(fields[2], 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(serial), true
+}
+
+// soaFields returns the fields of the SOA record data following the record header, when it is present
+func soaFields(data string) []string {
+	fields := strings.Fields(data)
+
+	for i, f := range fields {
+		if strings.ToUpper(f) == "SOA" {
+			return fields[i+1:]
+		}
+	}
+	return fields
+}
+
+// dnsQueryNS - Obtains the NS records for the name, with the nameserver hostnames as the data
+func (ds *DNSService) dnsQueryNS(name, server string) ([]recon.DNSAnswer, error) {
+	answers, err := ds.query(name, server, "NS")
+	if err != nil {
+		return []recon.DNSAnswer{}, queryError(err)
+	}
+
+	var ns []recon.DNSAnswer
+	for _, a := range answers {
+		if a.Type != 2 || !validTarget(a.Data) {
+			continue
+		}
+
+		a.Data = strings.TrimSuffix(a.Data, ".")
+		ns = append(ns, a)
+	}
+	return ns, nil
+}
+
+// sendNameservers queues the nameservers of the domain that are in scope,
+// since vanity nameservers are common and often reveal delegated zones
+func (ds *DNSService) sendNameservers(domain string, round int) {
+	answers, err := ds.dnsQueryNS(domain, ds.nextNameserver())
+	if err != nil {
+		return
+	}
+
+	for _, a := range answers {
+		if d := ds.scopeOf(a.Data, domain); d != "" {
+			ds.queueName(discovered(ProvenanceNS, a.Data, d, round+1))
+		}
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"testing"
+	"time"
+
+	"github.com/caffix/recon"
+)
+
+func TestNameserverDiscovery(t *testing.T) {
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		if qtype == "NS" && name == "example.com" {
+			return []recon.DNSAnswer{
+				{Name: name, Type: 2, TTL: 60, Data: "ns1.example.com."},
+				{Name: name, Type: 2, TTL: 60, Data: "ns1.dnsprovider.net."},
+				{Name: name, Type: 2, TTL: 60, Data: "ns2.example.org."},
+			}, nil
+		}
+		return nil, testNoRecords(name)
+	})()
+
+	srv := NewDNSService(nil, nil)
+	srv.SetScopeDomains([]string{"example.org"})
+	srv.sendNameservers("example.com", 0)
+
+	if len(srv.requeue) != 2 {
+		t.Fatalf("%d nameservers were queued instead of the two in-scope nameservers", len(srv.requeue))
+	}
+	if req := <-srv.requeue; req.Name != "ns1.example.com" || req.Source != "NS" {
+		t.Errorf("The nameserver was queued as %+v", req)
+	}
+	if req := <-srv.requeue; req.Name != "ns2.example.org" || req.Domain != "example.org" {
+		t.Errorf("The nameserver within the scope domain was queued as %+v", req)
+	}
+}
+
+// authResolver answers as the public server 192.0.2.1:53 and the authoritative server
+// 198.51.100.1:53 of example.com, which disagree on the address of www.example.com
+func authResolver(name, server, qtype string) ([]recon.DNSAnswer, error) {
+	if server == "198.51.100.1:53" {
+		switch {
+		case name == "down.example.com":
+			return nil, ErrTimeout
+		case qtype == "A" && name == "www.example.com":
+			return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "198.51.100.10"}}, nil
+		case qtype == "SOA" && name == "example.com":
+			return []recon.DNSAnswer{{Name: name, Type: 6, TTL: 60,
+				Data: "example.com. 3600 IN SOA ns1.example.com. hostmaster.example.com. 2024010101 7200 3600 1209600 300"}}, nil
+		}
+		return nil, testNoRecords(name)
+	}
+
+	switch {
+	case qtype == "NS" && name == "example.com":
+		return []recon.DNSAnswer{{Name: name, Type: 2, TTL: 60, Data: "ns1.example.com."}}, nil
+	case qtype == "A" && name == "ns1.example.com":
+		return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "198.51.100.1"}}, nil
+	case qtype == "A" && (name == "www.example.com" || name == "down.example.com"):
+		return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "192.0.2.10"}}, nil
+	}
+	return nil, testNoRecords(name)
+}
+
+func TestAuthoritativeResolution(t *testing.T) {
+	defer useTestResolver(authResolver)()
+
+	srv := NewDNSService(nil, nil)
+	srv.SetAuthoritative(true)
+
+	answers, server, err := srv.resolveName("example.com", "www.example.com")
+	if err != nil || server != "198.51.100.1:53" || len(answers) != 1 || answers[0].Data != "198.51.100.10" {
+		t.Errorf("The name was resolved by %s with error %v instead of the authoritative server", server, err)
+	}
+	if servers := srv.AuthoritativeServers("example.com"); len(servers) != 1 || servers[0] != "198.51.100.1:53" {
+		t.Errorf("The authoritative servers were discovered as %v", servers)
+	}
+
+	// The public servers are used when the authoritative servers cannot be reached
+	answers, server, err = srv.resolveName("example.com", "down.example.com")
+	if err != nil || server != "192.0.2.1:53" || len(answers) != 1 || answers[0].Data != "192.0.2.10" {
+		t.Errorf("The name was resolved by %s with error %v instead of the public server", server, err)
+	}
+}
+
+func TestNameserverLookupFailure(t *testing.T) {
+	// The first NS lookup times out, and the later lookups succeed
+	var lookups int
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		if qtype == "NS" && name == "example.com" {
+			if lookups++; lookups == 1 {
+				return nil, ErrTimeout
+			}
+		}
+		return authResolver(name, server, qtype)
+	})()
+
+	srv := NewDNSService(nil, nil)
+	if servers := srv.nameserversFor("example.com"); len(servers) != 0 {
+		t.Fatalf("The failed lookup returned the servers %v", servers)
+	}
+	if servers := srv.nameserversFor("example.com"); len(servers) != 1 || servers[0] != "198.51.100.1:53" {
+		t.Errorf("The failed lookup was cached, and the servers were %v", servers)
+	}
+	// Successful lookups are cached
+	srv.nameserversFor("example.com")
+	if lookups != 2 {
+		t.Errorf("The NS records were looked up %d times", lookups)
+	}
+}
+
+func TestNameserverLookupNXDOMAIN(t *testing.T) {
+	var lookups int
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		if qtype == "NS" {
+			lookups++
+		}
+		return nil, testNXDOMAIN(name)
+	})()
+
+	srv := NewDNSService(nil, nil)
+	// Domains that do not exist are not looked up again for each name
+	for i := 0; i < 3; i++ {
+		if servers := srv.nameserversFor("missing.example"); len(servers) != 0 {
+			t.Fatalf("The missing domain returned the servers %v", servers)
+		}
+	}
+	if lookups != 1 {
+		t.Errorf("The NS records of the missing domain were looked up %d times", lookups)
+	}
+}
+
+func TestNameserverLookupRecordTypes(t *testing.T) {
+	var lookups []string
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		if qtype == "NS" && name == "example.com" {
+			return []recon.DNSAnswer{
+				{Name: name, Type: 5, TTL: 60, Data: "cdn.example.net."},
+				{Name: name, Type: 2, TTL: 60, Data: "ns1.example.com."},
+			}, nil
+		}
+		if qtype == "A" {
+			lookups = append(lookups, name)
+		}
+		return authResolver(name, server, qtype)
+	})()
+
+	srv := NewDNSService(nil, nil)
+	if servers := srv.nameserversFor("example.com"); len(servers) != 1 || servers[0] != "198.51.100.1:53" {
+		t.Errorf("The nameservers were discovered as %v", servers)
+	}
+	if len(lookups) != 1 || lookups[0] != "ns1.example.com" {
+		t.Errorf("The addresses were looked up for %v instead of only the NS record", lookups)
+	}
+}
+
+func TestCompareAuthoritative(t *testing.T) {
+	srv, out, done := newTestService(authResolver)
+	defer done()
+
+	srv.SetCompareAuthoritative(true)
+	srv.Start()
+	srv.performDNSRequest(&AmassRequest{Name: "www.example.com", Domain: "example.com", Tag: SEARCH})
+
+	var req *AmassRequest
+	select {
+	case req = <-out:
+	case <-time.After(time.Second):
+		t.Fatalf("The name was not resolved")
+	}
+	// The cached recursive answers do not stand in for the authoritative answers
+	d := req.Discrepancy
+	if d == nil || len(d.Recursive) != 1 || d.Recursive[0] != "192.0.2.10" ||
+		len(d.Authoritative) != 1 || d.Authoritative[0] != "198.51.100.10" {
+		t.Errorf("The differing answers were reported as %+v", d)
+	}
+}
+
+func TestZoneSerial(t *testing.T) {
+	defer useTestResolver(authResolver)()
+
+	srv := NewDNSService(nil, nil)
+	if serial, err := srv.ZoneSerial("example.com"); err != nil || serial != 2024010101 {
+		t.Errorf("ZoneSerial returned %d with error %v", serial, err)
+	}
+	// Domains without authoritative servers have no serial
+	if _, err := srv.ZoneSerial("example.org"); err == nil {
+		t.Errorf("ZoneSerial returned a serial for a domain without nameservers")
+	}
+
+	if serial, ok := soaSerial("ns1.example.com. hostmaster.example.com. 42 7200 3600 1209600 300"); !ok || serial != 42 {
+		t.Errorf("The serial of the record data without a header was parsed as %d", serial)
+	}
+	if _, ok := soaSerial("ns1.example.com. hostmaster.example.com."); ok {
+		t.Errorf("A serial was parsed from the truncated record data")
+	}
+}
@@ -97,7 +97,7 @@ func (bfs *BruteForceService) checkForNewSubdomain(req *AmassRequest) {
 	// Check if we have seen the Domain already
 	if _, found := bfs.subdomains[req.Domain]; !found {
 		bfs.subdomains[req.Domain] = struct{}{}
-		go bfs.performBruteForcing(req.Domain, req.Domain, bfs.wordlist)
+		go bfs.performBruteForcing(req.Domain, req.Domain, bfs.wordlist, req.Round)
 	}
 	// If the Name is empty or recursive brute forcing is off, we are done here
 	if req.Name == "" || !bfs.recursive {
@@ -121,16 +121,32 @@ func (bfs *BruteForceService) checkForNewSubdomain(req *AmassRequest) {
 		return
 	}
 	// Otherwise, run the brute forcing on the proper subdomain
-	go bfs.performBruteForcing(sub, req.Domain, bfs.wordlist)
+	go bfs.performBruteForcing(sub, req.Domain, bfs.wordlist, req.Round+1)
 }
 
-func (bfs *BruteForceService) performBruteForcing(subdomain, root string, words []string) {
+func (bfs *BruteForceService) performBruteForcing(subdomain, root string, words []string, round int) {
 	for _, word := range words {
 		go bfs.sendOut(&AmassRequest{
 			Name:   word + "." + subdomain,
 			Domain: root,
 			Tag:    BRUTE,
 			Source: "Brute Forcing",
+			Round:  round,
 		})
 	}
 }
+
+// FeedWordlist - Sends a request for each word prepended to the domain into the input channel
+// of a service, blocking while the channel is full. Words producing invalid names are skipped
+func FeedWordlist(domain string, words []string, in chan *AmassRequest) {
+	for _, word := range words {
+		name := strings.TrimSpace(word) + "." + domain
+		if !validName(name) {
+			continue
+		}
+
+		req := discovered(ProvenanceBruteForce, name, domain, 0)
+		req.Source = "Brute Forcing"
+		in <- req
+	}
+}
@@ -44,3 +44,30 @@ func TestBruteForceService(t *testing.T) {
 
 	srv.Stop()
 }
+
+func TestFeedWordlist(t *testing.T) {
+	in := make(chan *AmassRequest)
+
+	go func() {
+		FeedWordlist("example.com", []string{"www", " mail ", "-bad", "in valid", "api"}, in)
+		close(in)
+	}()
+
+	var names []string
+	for req := range in {
+		if req.Tag != BRUTE || req.Provenance != ProvenanceBruteForce || req.Domain != "example.com" {
+			t.Errorf("The request for %s was not marked as brute forced: %+v", req.Name, req)
+		}
+		names = append(names, req.Name)
+	}
+
+	expected := []string{"www.example.com", "mail.example.com", "api.example.com"}
+	if len(names) != len(expected) {
+		t.Fatalf("FeedWordlist sent %v instead of %v", names, expected)
+	}
+	for i, name := range expected {
+		if names[i] != name {
+			t.Errorf("FeedWordlist sent %s instead of %s", names[i], name)
+		}
+	}
+}
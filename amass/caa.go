@@ -0,0 +1,41 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"github.com/caffix/recon"
+)
+
+// FetchCAA - Returns true if the CAA records of the domain are attached to each result
+func (ds *DNSService) FetchCAA() bool {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.fetchCAA
+}
+
+// SetFetchCAA - Causes the CAA records of the domain to be obtained and included in the
+// Records of each result. The records do not provide names, so nothing is queued from them
+func (ds *DNSService) SetFetchCAA(enabled bool) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.fetchCAA = enabled
+}
+
+// dnsQueryCAA - Obtains the CAA records of the domain, which are shared by all of its names
+func (ds *DNSService) dnsQueryCAA(domain, server string) ([]recon.DNSAnswer, error) {
+	answers, err := ds.cachedQuery(domain, server, "CAA")
+	if err != nil {
+		return []recon.DNSAnswer{}, queryError(err)
+	}
+
+	var caa []recon.DNSAnswer
+	for _, a := range answers {
+		if a.Type == 257 {
+			caa = append(caa, a)
+		}
+	}
+	return caa, nil
+}
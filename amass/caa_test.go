@@ -0,0 +1,46 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"testing"
+	"time"
+
+	"github.com/caffix/recon"
+)
+
+func TestFetchCAA(t *testing.T) {
+	srv, out, done := newTestService(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		switch {
+		case qtype == "A" && name == "www.example.com":
+			return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "192.0.2.1"}}, nil
+		case qtype == "CAA" && name == "example.com":
+			return []recon.DNSAnswer{{Name: name, Type: 257, TTL: 60, Data: "0 issue \"ca.example.net\""}}, nil
+		}
+		return nil, testNoRecords(name)
+	})
+	defer done()
+
+	srv.SetFetchCAA(true)
+	srv.Start()
+
+	srv.performDNSRequest(&AmassRequest{Name: "www.example.com", Domain: "example.com", Tag: SEARCH})
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case req := <-out:
+			if req.Name != "www.example.com" {
+				continue
+			}
+			for _, r := range req.Records {
+				if r.Type == 257 && r.Name == "example.com" {
+					return
+				}
+			}
+			t.Fatalf("The CAA record was not included in the result records")
+		case <-timeout:
+			t.Fatalf("The requested name was not returned")
+		}
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caffix/recon"
+)
+
+const (
+	// The default maximum time that answers are cached
+	defaultCacheTTL = time.Minute
+
+	// The number of insertions between removals of the expired answers
+	cachePruneInterval = 1000
+)
+
+type cachedAnswers struct {
+	answers []recon.DNSAnswer
+	expires time.Time
+}
+
+// answerCache - Keeps successful answers keyed by the name, query type and the source of the answers
+type answerCache struct {
+	sync.Mutex
+	entries map[string]*cachedAnswers
+	inserts int
+}
+
+func newAnswerCache() *answerCache {
+	return &answerCache{entries: make(map[string]*cachedAnswers)}
+}
+
+// cacheKey returns the key of the answers, where the source is empty for the public servers over UDP
+func cacheKey(name, qtype, source string) string {
+	return strings.ToLower(name) + "|" + qtype + "|" + source
+}
+
+func (c *answerCache) get(name, qtype, source string) ([]recon.DNSAnswer, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	key := cacheKey(name, qtype, source)
+	entry, found := c.entries[key]
+	if !found {
+		return nil, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return append([]recon.DNSAnswer{}, entry.answers...), true
+}
+
+// set caches the answers for the lowest record TTL, limited to the maximum
+func (c *answerCache) set(name, qtype, source string, answers []recon.DNSAnswer, max time.Duration) {
+	ttl := max
+	for _, a := range answers {
+		if d := time.Duration(a.TTL) * time.Second; d < ttl {
+			ttl = d
+		}
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	now := time.Now()
+	c.entries[cacheKey(name, qtype, source)] = &cachedAnswers{
+		answers: append([]recon.DNSAnswer{}, answers...),
+		expires: now.Add(ttl),
+	}
+
+	c.inserts++
+	if c.inserts%cachePruneInterval == 0 {
+		for key, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, key)
+			}
+		}
+	}
+}
+
+// CacheTTL - Returns the maximum time that answers are cached
+func (ds *DNSService) CacheTTL() time.Duration {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.cacheTTL
+}
+
+// SetCacheTTL - Sets the maximum time that answers are cached, where answers are cached
+// no longer than their record TTL. Zero disables the cache
+func (ds *DNSService) SetCacheTTL(ttl time.Duration) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.cacheTTL = ttl
+}
+
+// cachedQuery performs the query when the answers have not already been cached
+func (ds *DNSService) cachedQuery(name, server, qtype string) ([]recon.DNSAnswer, error) {
+	max := ds.CacheTTL()
+	if max <= 0 {
+		return ds.query(name, server, qtype)
+	}
+
+	// The answers of the authoritative servers are compared with those of the public servers,
+	// and the answers obtained over each transport are reported separately when they are merged
+	var source string
+	if transport, _ := transportOf(server); ds.auth.has(server) {
+		source = server
+	} else if transport != TransportUDP {
+		source = transport
+	}
+
+	if answers, found := ds.cache.get(name, qtype, source); found {
+		ds.stats.cacheLookup(true)
+		return answers, nil
+	}
+	ds.stats.cacheLookup(false)
+
+	answers, err := ds.query(name, server, qtype)
+	if err == nil {
+		ds.cache.set(name, qtype, source, answers, max)
+	}
+	return answers, err
+}
@@ -0,0 +1,51 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"testing"
+	"time"
+
+	"github.com/caffix/recon"
+)
+
+func TestAnswerCache(t *testing.T) {
+	var queries int
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		queries++
+		if qtype == "A" {
+			return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 1, Data: "192.0.2.100"}}, nil
+		}
+		return nil, testNoRecords(name)
+	})()
+
+	srv := NewDNSService(nil, nil)
+	srv.dnsQuery("example.com", "www.example.com", "192.0.2.1:53")
+	sent := queries
+	answers, err := srv.dnsQuery("example.com", "www.example.com", "192.0.2.1:53")
+	if err != nil || len(answers) != 1 {
+		t.Errorf("The cached answers were not returned: %v", err)
+	}
+	if queries != sent+2 {
+		t.Errorf("%d queries were sent instead of only the queries that failed", queries-sent)
+	}
+	if stats := srv.Stats(); stats.CacheHits != 1 {
+		t.Errorf("%d cache hits were counted instead of one", stats.CacheHits)
+	}
+
+	// The answers expire according to the record TTL
+	time.Sleep(1100 * time.Millisecond)
+	sent = queries
+	srv.dnsQuery("example.com", "www.example.com", "192.0.2.1:53")
+	if queries != sent+3 {
+		t.Errorf("The expired answers were returned from the cache")
+	}
+
+	srv.SetCacheTTL(0)
+	sent = queries
+	srv.dnsQuery("example.com", "www.example.com", "192.0.2.1:53")
+	if queries != sent+3 {
+		t.Errorf("The answers were returned from the disabled cache")
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/caffix/recon"
+	"github.com/miekg/dns"
+)
+
+// ChainHop - A name followed while resolving, and the type of the record it provided
+type ChainHop struct {
+	Name string
+	Type string
+}
+
+// cnameChain returns the names followed through the CNAME records in the answers, in order and
+// ending with the name providing the addresses. Nil is returned when there was no CNAME record
+func cnameChain(answers []recon.DNSAnswer) []ChainHop {
+	var chain []ChainHop
+
+	for _, a := range answers {
+		if a.Type == 5 {
+			chain = append(chain, ChainHop{Name: a.Name, Type: typeName(a.Type)})
+		}
+	}
+	if len(chain) == 0 {
+		return nil
+	}
+
+	for _, a := range answers {
+		if a.Type == 1 || a.Type == 28 {
+			chain = append(chain, ChainHop{Name: a.Name, Type: typeName(a.Type)})
+			break
+		}
+	}
+	return chain
+}
+
+// chainFrom returns the part of the chain starting at the name
+func chainFrom(chain []ChainHop, name string) []ChainHop {
+	for i, hop := range chain {
+		if strings.EqualFold(hop.Name, name) {
+			return chain[i:]
+		}
+	}
+	return nil
+}
+
+// typeName returns the mnemonic of the record type, such as CNAME
+func typeName(t int) string {
+	if name, found := dns.TypeToString[uint16(t)]; found {
+		return name
+	}
+	return "TYPE" + strconv.Itoa(t)
+}
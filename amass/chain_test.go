@@ -0,0 +1,67 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"testing"
+	"time"
+
+	"github.com/caffix/recon"
+)
+
+func TestCNAMEChain(t *testing.T) {
+	srv, out, done := newTestService(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		switch {
+		case qtype == "CNAME" && name == "a.example.com":
+			return []recon.DNSAnswer{{Name: name, Type: 5, TTL: 60, Data: "b.example.com"}}, nil
+		case qtype == "CNAME" && name == "b.example.com":
+			return []recon.DNSAnswer{{Name: name, Type: 5, TTL: 60, Data: "c.provider.net"}}, nil
+		case qtype == "A" && name == "c.provider.net":
+			return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "203.0.113.5"}}, nil
+		}
+		return nil, testNoRecords(name)
+	})
+	defer done()
+
+	srv.SetRecordMode(RecordAOnly)
+	srv.Start()
+
+	srv.performDNSRequest(&AmassRequest{Name: "a.example.com", Domain: "example.com", Tag: SEARCH})
+
+	results := make(map[string]*AmassRequest)
+	timeout := time.After(500 * time.Millisecond)
+loop:
+	for {
+		select {
+		case req := <-out:
+			results[req.Name] = req
+		case <-timeout:
+			break loop
+		}
+	}
+
+	expected := map[string][]string{
+		"a.example.com": {"a.example.com", "b.example.com", "c.provider.net"},
+		"b.example.com": {"b.example.com", "c.provider.net"},
+	}
+	for name, names := range expected {
+		req, found := results[name]
+		if !found {
+			t.Errorf("%s was not reported", name)
+			continue
+		}
+		if len(req.Chain) != len(names) {
+			t.Errorf("The chain of %s was %v", name, req.Chain)
+			continue
+		}
+		for i, hop := range req.Chain {
+			if hop.Name != names[i] {
+				t.Errorf("Hop %d in the chain of %s was %s instead of %s", i, name, hop.Name, names[i])
+			}
+		}
+		if last := req.Chain[len(req.Chain)-1]; last.Type != typeName(1) || req.Chain[0].Type != typeName(5) {
+			t.Errorf("The record types in the chain of %s were %v", name, req.Chain)
+		}
+	}
+}
@@ -0,0 +1,391 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Checkpoint - The state of a DNSService persisted to disk for crash recovery
+type Checkpoint struct {
+	// Requests waiting to be resolved, including the requests that were being resolved
+	Queue []*AmassRequest `json:"queue"`
+
+	// Names discovered by the service that were waiting to enter the queue, which are
+	// filtered like any other name when the service resumes
+	Requeue []*AmassRequest `json:"requeue,omitempty"`
+
+	// Names that have already been accepted by the service
+	Seen []string `json:"seen"`
+
+	// Results delivered by the service, which are kept in the results file next to the checkpoint
+	Results []*AmassRequest `json:"-"`
+
+	// The number of results in the results file when the checkpoint was written
+	ResultCount int `json:"result_count"`
+
+	// When the checkpoint was written
+	Time time.Time `json:"time"`
+}
+
+// resultsPath returns the file that the results are appended to as they are delivered
+func resultsPath(path string) string {
+	return path + ".results"
+}
+
+// LoadCheckpoint - Reads a checkpoint previously written by a DNSService
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cp := new(Checkpoint)
+	if err := json.Unmarshal(data, cp); err != nil {
+		return nil, err
+	}
+	if cp.ResultCount == 0 {
+		return cp, nil
+	}
+
+	f, err := os.Open(resultsPath(path))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// Results appended after the checkpoint was written belong to requests that are still queued
+	reader := bufio.NewReader(f)
+	for len(cp.Results) < cp.ResultCount {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		req := new(AmassRequest)
+		if err := json.Unmarshal(line, req); err != nil {
+			return nil, err
+		}
+		cp.Results = append(cp.Results, req)
+	}
+	return cp, nil
+}
+
+// SetCheckpoint - Causes the queue and seen names to be written to the path on the interval, and the
+// results to be appended to the path with a .results suffix as they are delivered. This must be set
+// before calling Start, and an empty path or zero interval disables checkpointing
+func (ds *DNSService) SetCheckpoint(path string, interval time.Duration) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.checkpointPath = path
+	ds.checkpointInterval = interval
+}
+
+// Restore - Resumes from a checkpoint, and must be called before Start.
+// The queued requests are resolved again, and the seen names are not
+func (ds *DNSService) Restore(cp *Checkpoint) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.restore = cp
+}
+
+func (ds *DNSService) checkpointConfig() (string, time.Duration) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.checkpointPath, ds.checkpointInterval
+}
+
+// checkpointTicker returns the channel that drives checkpointing, which is nil when it is disabled
+func (ds *DNSService) checkpointTicker() (<-chan time.Time, func()) {
+	path, interval := ds.checkpointConfig()
+	if path == "" || interval <= 0 {
+		return nil, func() {}
+	}
+
+	t := time.NewTicker(interval)
+	return t.C, t.Stop
+}
+
+// restoreState seeds the filter from the checkpoint provided to Restore, and returns the queued
+// requests along with the discovered names still to be enqueued. The results file is started
+// when checkpointing has been enabled
+func (ds *DNSService) restoreState(filter *nameFilter) ([]*AmassRequest, []*AmassRequest) {
+	ds.Lock()
+	cp := ds.restore
+	ds.restore = nil
+	ds.Unlock()
+
+	if path, interval := ds.checkpointConfig(); path != "" && interval > 0 {
+		// The restored results are carried forward into the new results file
+		var carried []*AmassRequest
+		if cp != nil {
+			carried = cp.Results
+		}
+
+		journal, err := newResultJournal(resultsPath(path), carried)
+		if err != nil {
+			log.Printf("%s: failed to create the results file: %v", ds, err)
+		}
+
+		ds.Lock()
+		ds.journal = journal
+		ds.inflight = make(map[*AmassRequest]*inflightRequest)
+		ds.requeued = make(map[*AmassRequest]struct{})
+		ds.Unlock()
+	}
+
+	if cp == nil {
+		return []*AmassRequest{}, []*AmassRequest{}
+	}
+
+	for _, name := range cp.Seen {
+		filter.Insert(name)
+	}
+	return append([]*AmassRequest{}, cp.Queue...), append([]*AmassRequest{}, cp.Requeue...)
+}
+
+// closeJournal stops recording results once the service has stopped
+func (ds *DNSService) closeJournal() {
+	ds.Lock()
+	journal := ds.journal
+	ds.journal = nil
+	ds.Unlock()
+
+	if journal != nil {
+		journal.Close()
+	}
+}
+
+// recordResult appends the result to the results file once it has been delivered. The results
+// discarded by the output policy are not recorded, since the consumer never received them
+func (ds *DNSService) recordResult(req *AmassRequest) {
+	ds.Lock()
+	journal := ds.journal
+	ds.Unlock()
+
+	if journal == nil {
+		return
+	}
+	if err := journal.Write(req); err != nil {
+		log.Printf("%s: failed to write the results file: %v", ds, err)
+	}
+}
+
+// inflightRequest is a copy of a dispatched request, along with the number of goroutines
+// still delivering its results or queuing the names derived from it
+type inflightRequest struct {
+	req     AmassRequest
+	pending int
+}
+
+// startRequest keeps a copy of the dispatched request, so the checkpoint can queue it again
+// until it has been resolved. The copy must be made before the request is handed to a worker
+func (ds *DNSService) startRequest(req *AmassRequest) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	if ds.inflight != nil {
+		ds.inflight[req] = &inflightRequest{req: *req, pending: 1}
+	}
+}
+
+// holdRequest keeps the request in the checkpoint until a matching finishRequest
+func (ds *DNSService) holdRequest(req *AmassRequest) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	if r, found := ds.inflight[req]; found {
+		r.pending++
+	}
+}
+
+// finishRequest removes the request from the checkpoint once it has been resolved,
+// and the results and names derived from it have been delivered or queued
+func (ds *DNSService) finishRequest(req *AmassRequest) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	r, found := ds.inflight[req]
+	if !found {
+		return
+	}
+	if r.pending--; r.pending <= 0 {
+		delete(ds.inflight, req)
+	}
+}
+
+// goRequestWork runs the function like goWork, keeping the dispatched request in the
+// checkpoint until it returns, since the function delivers results or queues names for it
+func (ds *DNSService) goRequestWork(req *AmassRequest, fn func()) {
+	ds.holdRequest(req)
+
+	ds.goWork(func() {
+		defer ds.finishRequest(req)
+
+		fn()
+	})
+}
+
+// startRequeue keeps track of the discovered name until processRequests has received it,
+// so the checkpoint does not lose the names waiting to enter the queue
+func (ds *DNSService) startRequeue(req *AmassRequest) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	if ds.requeued != nil {
+		ds.requeued[req] = struct{}{}
+	}
+}
+
+// finishRequeue removes the name from the checkpoint backlog once it has been received
+func (ds *DNSService) finishRequeue(req *AmassRequest) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	delete(ds.requeued, req)
+}
+
+// saveCheckpoint copies the current state and writes it in the background, so the dispatch
+// loop is not held up by the disk. The checkpoint is skipped while the previous one is written
+func (ds *DNSService) saveCheckpoint(queue []*AmassRequest, filter *nameFilter) {
+	path, _ := ds.checkpointConfig()
+
+	ds.Lock()
+	if ds.checkpointBusy {
+		ds.Unlock()
+		return
+	}
+	ds.checkpointBusy = true
+
+	cp := &Checkpoint{
+		Queue: make([]*AmassRequest, 0, len(ds.inflight)+len(queue)),
+		Time:  time.Now(),
+	}
+	if ds.journal != nil {
+		cp.ResultCount = ds.journal.Len()
+	}
+	for _, r := range ds.inflight {
+		c := r.req
+		cp.Queue = append(cp.Queue, &c)
+	}
+	// The discovered names are not modified until processRequests has received them
+	for req := range ds.requeued {
+		c := *req
+		cp.Requeue = append(cp.Requeue, &c)
+	}
+	ds.Unlock()
+
+	// The queued requests are only modified by the dispatch loop until they are handed to a worker
+	for _, req := range queue {
+		c := *req
+		cp.Queue = append(cp.Queue, &c)
+	}
+	cp.Seen = filter.Names()
+
+	go func() {
+		if err := writeCheckpoint(path, cp); err != nil {
+			log.Printf("%s: failed to write the checkpoint: %v", ds, err)
+		}
+
+		ds.Lock()
+		ds.checkpointBusy = false
+		ds.Unlock()
+	}()
+}
+
+// writeCheckpoint atomically replaces the checkpoint file
+func writeCheckpoint(path string, cp *Checkpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// resultJournal appends the emitted results to a file, so they are not held in memory
+type resultJournal struct {
+	sync.Mutex
+	file  *os.File
+	count int
+}
+
+// newResultJournal starts the results file with the results carried forward from a checkpoint.
+// The file is written under a temporary name and renamed, like writeCheckpoint does, so the
+// results file of the checkpoint remains intact when the process fails during the rewrite
+func newResultJournal(path string, carried []*AmassRequest) (*resultJournal, error) {
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	rj := &resultJournal{file: file}
+	for _, req := range carried {
+		if err := rj.Write(req); err != nil {
+			rj.Close()
+			os.Remove(tmp)
+			return nil, err
+		}
+	}
+	// The open file keeps receiving the results appended after the rename
+	if err := os.Rename(tmp, path); err != nil {
+		rj.Close()
+		os.Remove(tmp)
+		return nil, err
+	}
+	return rj, nil
+}
+
+// Write appends the result to the end of the file
+func (rj *resultJournal) Write(req *AmassRequest) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	rj.Lock()
+	defer rj.Unlock()
+
+	// Results emitted while the service stops are not recorded
+	if rj.file == nil {
+		return nil
+	}
+	if _, err := rj.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	rj.count++
+	return nil
+}
+
+// Len returns the number of results written to the file
+func (rj *resultJournal) Len() int {
+	rj.Lock()
+	defer rj.Unlock()
+
+	return rj.count
+}
+
+func (rj *resultJournal) Close() {
+	rj.Lock()
+	defer rj.Unlock()
+
+	if rj.file != nil {
+		rj.file.Close()
+		rj.file = nil
+	}
+}
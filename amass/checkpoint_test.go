@@ -0,0 +1,275 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/caffix/amass/amass/stringset"
+	"github.com/caffix/recon"
+)
+
+func TestCheckpointRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "amass-checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "checkpoint.json")
+
+	var lock sync.Mutex
+	queried := make(map[string]int)
+	release := make(chan struct{})
+	restore := useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		if qtype != "A" {
+			return nil, testNoRecords(name)
+		}
+
+		lock.Lock()
+		queried[name]++
+		lock.Unlock()
+		// The name is still being resolved when the checkpoint is written
+		if name == "slow.example.com" {
+			<-release
+		}
+		return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "192.0.2.1"}}, nil
+	})
+	defer restore()
+
+	in := make(chan *AmassRequest)
+	out := make(chan *AmassRequest, 10)
+	srv := NewDNSService(in, out)
+	srv.SetWildcardDetection(false)
+	srv.SetCheckpoint(path, 20*time.Millisecond)
+	srv.Start()
+
+	in <- &AmassRequest{Name: "fast.example.com", Domain: "example.com", Tag: SEARCH}
+	in <- &AmassRequest{Name: "slow.example.com", Domain: "example.com", Tag: SEARCH}
+	select {
+	case req := <-out:
+		if req.Name != "fast.example.com" {
+			t.Fatalf("%s was resolved instead of fast.example.com", req.Name)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("fast.example.com was not resolved")
+	}
+	// The paused service keeps the name in the queue
+	srv.Pause()
+	in <- &AmassRequest{Name: "queued.example.com", Domain: "example.com", Tag: SEARCH}
+
+	var cp *Checkpoint
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if c, err := LoadCheckpoint(path); err == nil && len(c.Queue) == 2 && len(c.Results) == 1 {
+			cp = c
+			break
+		}
+	}
+	close(release)
+	srv.Stop()
+	waitForWork(srv)
+	if cp == nil {
+		t.Fatalf("The checkpoint with the in-flight and queued names was not written")
+	}
+
+	queue := stringset.NewStringSet()
+	for _, req := range cp.Queue {
+		queue.Add(req.Name)
+	}
+	if !queue.Contains("slow.example.com") || !queue.Contains("queued.example.com") {
+		t.Errorf("The checkpoint queued %v", queue.ToStrings())
+	}
+	if cp.Results[0].Name != "fast.example.com" {
+		t.Errorf("The checkpoint recorded %s as the result", cp.Results[0].Name)
+	}
+	if len(cp.Seen) != 3 {
+		t.Errorf("The checkpoint recorded %d seen names instead of 3", len(cp.Seen))
+	}
+
+	// Results delivered as the first service stopped do not count for the restored service
+	for len(out) > 0 {
+		<-out
+	}
+	lock.Lock()
+	queried = make(map[string]int)
+	lock.Unlock()
+
+	in = make(chan *AmassRequest)
+	srv = NewDNSService(in, out)
+	srv.SetWildcardDetection(false)
+	srv.SetCheckpoint(path, time.Hour)
+	srv.Restore(cp)
+	srv.Start()
+	defer srv.Stop()
+
+	// The seen name is not resolved again
+	in <- &AmassRequest{Name: "fast.example.com", Domain: "example.com", Tag: SEARCH}
+
+	resolved := stringset.NewStringSet()
+	timeout := time.After(time.Second)
+loop:
+	for {
+		select {
+		case req := <-out:
+			resolved.Add(req.Name)
+		case <-timeout:
+			break loop
+		}
+	}
+	if !resolved.Contains("slow.example.com") || !resolved.Contains("queued.example.com") {
+		t.Errorf("Only %v were resolved after restoring the checkpoint", resolved.ToStrings())
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if queried["fast.example.com"] != 0 {
+		t.Errorf("The name resolved before the checkpoint was resolved again")
+	}
+}
+
+func TestCheckpointPendingWork(t *testing.T) {
+	dir, err := ioutil.TempDir("", "amass-checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "checkpoint.json")
+
+	out := make(chan *AmassRequest, 1)
+	srv := NewDNSService(nil, out)
+	srv.SetOutputPolicy(DropOutput)
+	srv.SetCheckpoint(path, time.Hour)
+	filter := newNameFilter(0)
+	srv.restoreState(filter)
+	defer srv.closeJournal()
+
+	// The second result is discarded, since the consumer has not received the first
+	srv.sendOut(&AmassRequest{Name: "delivered.example.com", Domain: "example.com"})
+	srv.sendOut(&AmassRequest{Name: "dropped.example.com", Domain: "example.com"})
+	// The discovered name is waiting to enter the queue
+	srv.queueName(discovered(ProvenanceMX, "mail.example.com", "example.com", 1))
+
+	srv.saveCheckpoint([]*AmassRequest{}, filter)
+	var cp *Checkpoint
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if c, err := LoadCheckpoint(path); err == nil {
+			cp = c
+			break
+		}
+	}
+	if cp == nil {
+		t.Fatalf("The checkpoint was not written")
+	}
+
+	if len(cp.Results) != 1 || cp.Results[0].Name != "delivered.example.com" {
+		t.Errorf("The checkpoint recorded %d results instead of the delivered result", len(cp.Results))
+	}
+	if len(cp.Requeue) != 1 || cp.Requeue[0].Name != "mail.example.com" {
+		t.Fatalf("The checkpoint did not keep the name waiting to enter the queue")
+	}
+
+	restored := NewDNSService(nil, nil)
+	restored.Restore(cp)
+	if _, pending := restored.restoreState(newNameFilter(0)); len(pending) != 1 || pending[0].Name != "mail.example.com" {
+		t.Errorf("The restored service did not enqueue the pending name")
+	}
+}
+
+func TestCheckpointBlockedResult(t *testing.T) {
+	dir, err := ioutil.TempDir("", "amass-checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "checkpoint.json")
+
+	resolved := make(chan struct{}, 1)
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		if qtype != "A" {
+			return nil, testNoRecords(name)
+		}
+		select {
+		case resolved <- struct{}{}:
+		default:
+		}
+		return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "192.0.2.1"}}, nil
+	})()
+
+	// Nothing receives from the output channel, so the result stays blocked
+	in := make(chan *AmassRequest)
+	out := make(chan *AmassRequest)
+	srv := NewDNSService(in, out)
+	srv.SetWildcardDetection(false)
+	srv.SetCheckpoint(path, 20*time.Millisecond)
+	srv.Start()
+
+	in <- &AmassRequest{Name: "www.example.com", Domain: "example.com", Tag: SEARCH}
+	select {
+	case <-resolved:
+	case <-time.After(time.Second):
+		t.Fatalf("The name was not resolved")
+	}
+	// The resolution has finished by the time the following checkpoints are written
+	time.Sleep(100 * time.Millisecond)
+	mark := time.Now()
+
+	var cp *Checkpoint
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if c, err := LoadCheckpoint(path); err == nil && c.Time.After(mark) {
+			cp = c
+			break
+		}
+	}
+	srv.Stop()
+	waitForWork(srv)
+	if cp == nil {
+		t.Fatalf("No checkpoint was written after the name was resolved")
+	}
+
+	if len(cp.Queue) != 1 || cp.Queue[0].Name != "www.example.com" || len(cp.Results) != 0 {
+		t.Errorf("The name with the undelivered result was not kept in the checkpoint")
+	}
+}
+
+func TestCheckpointResultsRewrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "amass-checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "checkpoint.json")
+
+	cp := &Checkpoint{ResultCount: 1, Time: time.Now()}
+	if err := writeCheckpoint(path, cp); err != nil {
+		t.Fatal(err)
+	}
+	journal, err := newResultJournal(resultsPath(path), []*AmassRequest{{Name: "www.example.com", Domain: "example.com"}})
+	if err != nil {
+		t.Fatalf("The results file was not created: %v", err)
+	}
+	journal.Close()
+
+	loaded, err := LoadCheckpoint(path)
+	if err != nil || len(loaded.Results) != 1 {
+		t.Fatalf("The checkpoint was not loaded with its result: %v", err)
+	}
+
+	// The rewrite fails, since the temporary file cannot be created
+	if err := os.Mkdir(resultsPath(path)+".tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+	srv := NewDNSService(nil, nil)
+	srv.SetCheckpoint(path, time.Hour)
+	srv.Restore(loaded)
+	srv.restoreState(newNameFilter(0))
+	srv.closeJournal()
+
+	if again, err := LoadCheckpoint(path); err != nil || len(again.Results) != 1 || again.Results[0].Name != "www.example.com" {
+		t.Errorf("The delivered results were lost when the results file could not be rewritten: %v", err)
+	}
+}
@@ -24,15 +24,29 @@ type AmassConfig struct {
 	// Sets the maximum number of DNS queries per minute
 	Frequency time.Duration
 
+	// The last discovery round that will be resolved, where zero means no limit
+	MaxRound int
+
+	// Servers (host:port) tried in order for each query, instead of the random public servers
+	FallbackServers []string
+
+	// High-value prefixes combined with each domain at the start of the enumeration.
+	// A nil slice causes DefaultPrefixes to be used, and an empty slice disables them
+	Prefixes []string
+
 	// The channel that will receive the results
 	Output chan *AmassRequest
 }
 
+// DefaultPrefixes are the labels tried against each domain when no prefixes have been configured
+var DefaultPrefixes = []string{"admin", "vpn", "mail", "dev", "staging", "api", "internal"}
+
 // DefaultConfig returns a config with values that have been tested and produce desirable results
 func DefaultConfig() AmassConfig {
 	return AmassConfig{
 		Wordlist:  []string{},
 		Frequency: 5 * time.Millisecond,
+		Prefixes:  DefaultPrefixes,
 	}
 }
 
@@ -45,5 +59,12 @@ func customConfig(ac AmassConfig) AmassConfig {
 		config.Frequency = ac.Frequency
 	}
 	config.Wordlist = ac.Wordlist
+	if ac.Prefixes != nil {
+		config.Prefixes = ac.Prefixes
+	}
+	if ac.MaxRound > 0 {
+		config.MaxRound = ac.MaxRound
+	}
+	config.FallbackServers = ac.FallbackServers
 	return config
 }
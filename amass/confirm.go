@@ -0,0 +1,94 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"log"
+
+	"github.com/caffix/recon"
+)
+
+// ConfirmationServers - Returns the number of distinct servers that must agree on a resolution
+func (ds *DNSService) ConfirmationServers() int {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.confirmServers
+}
+
+// SetConfirmationServers - Sets the number of distinct servers that must resolve a name to the same
+// address before it is emitted, which guards against transient poisoning of a single resolver.
+// Values above one cause the name to be resolved again against other public servers, and names
+// the servers disagree on are counted as anomalies and dropped
+func (ds *DNSService) SetConfirmationServers(n int) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.confirmServers = n
+}
+
+// confirmResolution queries the additional servers required for confirmation, returning true when
+// each of them provides at least one of the addresses in the answers. The cache is bypassed, and the
+// servers are chosen at random from the usable public servers that are not quarantined, besides the
+// one that answered. Servers that cannot be reached are replaced by another server
+func (ds *DNSService) confirmResolution(name string, answers []recon.DNSAnswer, server string) bool {
+	needed := ds.ConfirmationServers() - 1
+	if needed <= 0 {
+		return true
+	}
+
+	// The addresses belong to the last name in the CNAME chain
+	target := name
+	for _, a := range answers {
+		if a.Type == 1 || a.Type == 28 {
+			target = a.Name
+			break
+		}
+	}
+
+	var candidates []string
+	for _, s := range ds.nameservers() {
+		if s != server && !quarantined(s) {
+			candidates = append(candidates, s)
+		}
+	}
+	ds.random().Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+
+	addrs := addressSet(answers).ToStrings()
+	for _, s := range candidates {
+		if needed == 0 {
+			break
+		}
+
+		var confirm []recon.DNSAnswer
+		var unreachable bool
+		for _, qtype := range ds.RecordMode().queryTypes() {
+			ans, err := ds.query(target, s, qtype)
+			if err == nil {
+				confirm = append(confirm, ans...)
+			} else if err := ClassifyError(err); err != ErrNXDOMAIN && err != ErrNoRecords {
+				unreachable = true
+			}
+		}
+		// A server that could not be reached neither confirms nor disputes the resolution
+		if len(confirm) == 0 && unreachable {
+			continue
+		}
+		if found := addressSet(confirm); !found.ContainsAny(addrs) {
+			ds.stats.anomaly()
+			log.Printf("%s: %s resolved to %v at %s, but %v at %s", ds, name, addrs, server, found.ToStrings(), s)
+			return false
+		}
+		needed--
+	}
+
+	if needed > 0 {
+		ds.stats.anomaly()
+		log.Printf("%s: %s could not be confirmed by %d more servers", ds, name, needed)
+		return false
+	}
+	return true
+}
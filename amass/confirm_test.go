@@ -0,0 +1,72 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"testing"
+	"time"
+
+	"github.com/caffix/recon"
+)
+
+func TestConfirmationServers(t *testing.T) {
+	poisoned := "192.0.2.2:53"
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		if qtype != "A" {
+			return nil, testNoRecords(name)
+		}
+		if server == poisoned {
+			return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "198.51.100.66"}}, nil
+		}
+		return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "192.0.2.100"}}, nil
+	})()
+	usableServers = []string{"192.0.2.1:53", "192.0.2.3:53"}
+
+	srv := NewDNSService(nil, nil)
+	srv.SetRecordMode(RecordAOnly)
+	answers := []recon.DNSAnswer{{Name: "www.example.com", Type: 1, TTL: 60, Data: "192.0.2.100"}}
+	if !srv.confirmResolution("www.example.com", answers, "192.0.2.1:53") {
+		t.Errorf("The resolution was not trusted while confirmation was disabled")
+	}
+
+	srv.SetConfirmationServers(2)
+	if !srv.confirmResolution("www.example.com", answers, "192.0.2.1:53") {
+		t.Errorf("The resolution was not confirmed by the agreeing server")
+	}
+
+	usableServers = []string{"192.0.2.1:53", poisoned}
+	if srv.confirmResolution("www.example.com", answers, "192.0.2.1:53") {
+		t.Errorf("The resolution was confirmed by the disagreeing server")
+	}
+	if stats := srv.Stats(); stats.Anomalies != 1 {
+		t.Errorf("The disagreement was counted %d times instead of once", stats.Anomalies)
+	}
+
+	// Servers that cannot be reached are replaced, and quarantined servers are not used
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		switch server {
+		case "192.0.2.4:53":
+			return nil, ErrTimeout
+		case poisoned:
+			return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "198.51.100.66"}}, nil
+		}
+		return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "192.0.2.100"}}, nil
+	})()
+	usableServers = []string{"192.0.2.1:53", "192.0.2.4:53", "192.0.2.3:53", poisoned}
+	serverQuarantine[poisoned] = time.Now().Add(time.Hour)
+	for i := 0; i < 10; i++ {
+		if !srv.confirmResolution("www.example.com", answers, "192.0.2.1:53") {
+			t.Fatalf("The resolution was not confirmed by the available server")
+		}
+	}
+
+	// The name is dropped when too few servers remain to confirm it
+	srv.SetConfirmationServers(3)
+	if srv.confirmResolution("www.example.com", answers, "192.0.2.1:53") {
+		t.Errorf("The resolution was confirmed by fewer servers than required")
+	}
+	if stats := srv.Stats(); stats.Anomalies != 2 {
+		t.Errorf("The unconfirmed resolution was not counted as an anomaly")
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"strings"
+)
+
+// DefaultTakeoverProviders - Suffixes of CNAME targets hosted by services where unclaimed
+// resources can be registered by anyone, making dangling records takeover candidates
+var DefaultTakeoverProviders = []string{
+	"s3.amazonaws.com",
+	"cloudfront.net",
+	"elasticbeanstalk.com",
+	"azurewebsites.net",
+	"cloudapp.net",
+	"blob.core.windows.net",
+	"trafficmanager.net",
+	"herokuapp.com",
+	"herokudns.com",
+	"github.io",
+	"bitbucket.io",
+	"ghost.io",
+	"pantheonsite.io",
+	"myshopify.com",
+	"surge.sh",
+	"zendesk.com",
+	"wordpress.com",
+	"fastly.net",
+	"unbouncepages.com",
+	"readme.io",
+}
+
+// DanglingCNAME - Describes a CNAME record whose target does not exist
+type DanglingCNAME struct {
+	// The final target of the CNAME chain
+	Target string
+
+	// The takeover-prone provider matching the target, when there is one
+	Provider string
+}
+
+// DetectDangling - Returns true if names with CNAME targets that do not exist are reported
+func (ds *DNSService) DetectDangling() bool {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.detectDangling
+}
+
+// SetDetectDangling - Causes names with a CNAME chain ending at a target that does not exist
+// to be reported with the Dangling field set, as candidates for subdomain takeover
+func (ds *DNSService) SetDetectDangling(enabled bool) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.detectDangling = enabled
+}
+
+// TakeoverProviders - Returns the CNAME target suffixes that identify takeover-prone providers
+func (ds *DNSService) TakeoverProviders() []string {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return append([]string{}, ds.takeoverProviders...)
+}
+
+// SetTakeoverProviders - Sets the CNAME target suffixes that identify takeover-prone providers
+func (ds *DNSService) SetTakeoverProviders(suffixes []string) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.takeoverProviders = append([]string{}, suffixes...)
+}
+
+// takeoverProvider returns the provider suffix matching the target, or an empty string
+func (ds *DNSService) takeoverProvider(target string) string {
+	target = strings.ToLower(target)
+
+	for _, suffix := range ds.TakeoverProviders() {
+		suffix = strings.ToLower(suffix)
+		if target == suffix || strings.HasSuffix(target, "."+suffix) {
+			return suffix
+		}
+	}
+	return ""
+}
+
+// sendDangling reports the name when it failed to resolve because its CNAME target does not exist
+func (ds *DNSService) sendDangling(req *AmassRequest, server string) {
+	chain, target, err := ds.recursiveCNAME(req.Domain, req.Name, server)
+	if err != nil || len(chain) == 0 {
+		return
+	}
+
+	if _, err := ds.cachedQuery(target, server, "A"); ClassifyError(err) != ErrNXDOMAIN {
+		return
+	}
+
+	result := &AmassRequest{
+		Name:       req.Name,
+		Domain:     req.Domain,
+		Tag:        req.Tag,
+		Source:     req.Source,
+		Provenance: provenanceOf(req),
+		Records:    chain,
+		Round:      req.Round,
+		Dangling: &DanglingCNAME{
+			Target:   target,
+			Provider: ds.takeoverProvider(target),
+		},
+	}
+	ds.goRequestWork(req, func() { ds.sendOut(result) })
+}
@@ -0,0 +1,93 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/caffix/recon"
+)
+
+func TestDanglingCNAME(t *testing.T) {
+	srv, out, done := newTestService(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		switch {
+		case qtype == "CNAME" && name == "assets.example.com":
+			return []recon.DNSAnswer{{Name: name, Type: 5, TTL: 60, Data: "example-assets.s3.amazonaws.com"}}, nil
+		case name == "example-assets.s3.amazonaws.com" || name == "gone.example.com":
+			return nil, testNXDOMAIN(name)
+		}
+		return nil, testNoRecords(name)
+	})
+	defer done()
+
+	srv.SetDetectDangling(true)
+	srv.Start()
+
+	srv.performDNSRequest(&AmassRequest{Name: "assets.example.com", Domain: "example.com", Tag: SEARCH})
+	srv.performDNSRequest(&AmassRequest{Name: "gone.example.com", Domain: "example.com", Tag: SEARCH})
+
+	results := make(map[string]*AmassRequest)
+	timeout := time.After(500 * time.Millisecond)
+loop:
+	for {
+		select {
+		case req := <-out:
+			results[req.Name] = req
+		case <-timeout:
+			break loop
+		}
+	}
+
+	req, found := results["assets.example.com"]
+	if !found || req.Dangling == nil {
+		t.Fatalf("The dangling CNAME was not reported")
+	}
+	if req.Dangling.Target != "example-assets.s3.amazonaws.com" || req.Dangling.Provider != "s3.amazonaws.com" {
+		t.Errorf("The dangling CNAME was reported as %+v", req.Dangling)
+	}
+	if _, found := results["gone.example.com"]; found {
+		t.Errorf("The name without a CNAME record was reported as dangling")
+	}
+}
+
+func TestDanglingResultTracked(t *testing.T) {
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		if qtype == "CNAME" && name == "assets.example.com" {
+			return []recon.DNSAnswer{{Name: name, Type: 5, TTL: 60, Data: "example-assets.s3.amazonaws.com"}}, nil
+		}
+		return nil, testNXDOMAIN(name)
+	})()
+
+	out := make(chan *AmassRequest)
+	srv := NewDNSService(make(chan *AmassRequest), out)
+	srv.SetWildcardDetection(false)
+	srv.SetDetectDangling(true)
+	srv.Start()
+	defer srv.Stop()
+
+	srv.performDNSRequest(&AmassRequest{Name: "assets.example.com", Domain: "example.com", Tag: SEARCH})
+
+	// The result waiting for the consumer keeps the service busy
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if err := srv.WaitUntilIdle(ctx); err == nil {
+		t.Fatalf("The service was idle before the dangling CNAME was delivered")
+	}
+
+	select {
+	case req := <-out:
+		if req.Dangling == nil {
+			t.Errorf("The result was delivered as %+v", req)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("The dangling CNAME was not reported")
+	}
+	ctx2, cancel2 := context.WithTimeout(context.Background(), time.Second)
+	defer cancel2()
+	if err := srv.WaitUntilIdle(ctx2); err != nil {
+		t.Errorf("The service was not idle after the result was delivered: %v", err)
+	}
+}
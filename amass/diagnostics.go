@@ -0,0 +1,62 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"errors"
+)
+
+// ErrWildcardMatch - The name resolved, but was suppressed for matching a wildcard or a blacklisted address
+var ErrWildcardMatch = errors.New("The name matched a wildcard and was suppressed")
+
+// ResolutionError - Describes why a name dispatched from the queue did not produce a result
+type ResolutionError struct {
+	Name   string
+	Domain string
+
+	// The last server queried for the name, which is empty when no server was queried
+	Server string
+
+	// One of the typed errors, such as ErrNXDOMAIN, ErrTimeout or ErrWildcardMatch
+	Err error
+}
+
+func (e *ResolutionError) Error() string {
+	msg := e.Name + ": " + e.Err.Error()
+	if e.Server != "" {
+		msg += " (" + e.Server + ")"
+	}
+	return msg
+}
+
+// ErrorOutput - Returns the channel receiving the failed resolutions
+func (ds *DNSService) ErrorOutput() chan error {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.errOutput
+}
+
+// SetErrorOutput - Sets the channel receiving a *ResolutionError for each name that failed to
+// resolve or was suppressed. The errors are dropped while the channel is full, so a slow consumer
+// does not stall the service
+func (ds *DNSService) SetErrorOutput(errs chan error) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.errOutput = errs
+}
+
+// sendError reports the failed resolution without blocking
+func (ds *DNSService) sendError(req *AmassRequest, server string, err error) {
+	errs := ds.ErrorOutput()
+	if errs == nil {
+		return
+	}
+
+	select {
+	case errs <- &ResolutionError{Name: req.Name, Domain: req.Domain, Server: server, Err: err}:
+	default:
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"testing"
+	"time"
+
+	"github.com/caffix/recon"
+)
+
+func TestErrorOutput(t *testing.T) {
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		if name == "timeout.example.com" {
+			return nil, ErrTimeout
+		}
+		return nil, testNXDOMAIN(name)
+	})()
+
+	errs := make(chan error, 10)
+	srv := NewDNSService(make(chan *AmassRequest), make(chan *AmassRequest, 10))
+	srv.SetWildcardDetection(false)
+	srv.SetMaxRetries(0)
+	srv.SetErrorOutput(errs)
+	srv.Start()
+	defer srv.Stop()
+
+	srv.performDNSRequest(&AmassRequest{Name: "missing.example.com", Domain: "example.com", Tag: SEARCH})
+	srv.performDNSRequest(&AmassRequest{Name: "timeout.example.com", Domain: "example.com", Tag: SEARCH})
+
+	expected := map[string]error{
+		"missing.example.com": ErrNXDOMAIN,
+		"timeout.example.com": ErrTimeout,
+	}
+	for range expected {
+		select {
+		case err := <-errs:
+			re, ok := err.(*ResolutionError)
+			if !ok {
+				t.Fatalf("The error %v was not a ResolutionError", err)
+			}
+			if re.Err != expected[re.Name] || re.Server == "" {
+				t.Errorf("The failure of %s was reported as %v from %q", re.Name, re.Err, re.Server)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("The failed resolutions were not reported")
+		}
+	}
+
+	// A full channel does not block the service
+	srv.SetErrorOutput(make(chan error))
+	done := make(chan struct{})
+	go func() {
+		srv.performDNSRequest(&AmassRequest{Name: "missing.example.com", Domain: "example.com", Tag: SEARCH})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("The service blocked on the error channel")
+	}
+}
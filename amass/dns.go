@@ -4,9 +4,14 @@
 package amass
 
 import (
+	"context"
 	"errors"
-	"math/rand"
+	"fmt"
+	"log"
+	"math"
+	"net"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/caffix/amass/amass/stringset"
@@ -17,6 +22,38 @@ const (
 	maxNameLen  = 253
 	maxLabelLen = 63
 
+	// The default time allowed for each DNS query
+	defaultQueryTimeout = 3 * time.Second
+
+	// The default number of different servers tried after a SERVFAIL response
+	defaultServFailRetries = 2
+
+	// The default number of different servers tried after other failed queries
+	defaultMaxRetries = 2
+
+	// The default maximum number of CNAME records followed for a name
+	defaultMaxCNAMEDepth = 10
+
+	// The time allowed for each server to respond when the servers are checked
+	defaultProbeTimeout = 2 * time.Second
+
+	// The default number of wildcard match requests waiting for a worker, and the number of workers
+	defaultWildcardBuffer  = 50
+	defaultWildcardWorkers = 1
+
+	// The default number of unlikely names probed for each subdomain, and how many must agree
+	defaultWildcardProbes    = 3
+	defaultWildcardAgreement = 3
+
+	// The default limit on results emitted for a single resolved name
+	defaultMaxEmissions = 1000
+
+	// The default minimum entropy, in bits, of the labels generated for wildcard probes
+	defaultMinProbeEntropy = 40.0
+
+	// The number of labels generated before giving up on meeting the minimum entropy
+	maxProbeAttempts = 10
+
 	ldhChars = "abcdefghijklmnopqrstuvwxyz0123456789-"
 )
 
@@ -51,355 +88,2500 @@ var knownPublicServers = []string{
 	//"64.6.65.6:53",       // Verisign Secondary
 }
 
-// Public & free DNS servers
-var usableServers []string
+// Public & free DNS servers, or the servers provided by the user
+var usableServers []string
+
+// All the servers that have been configured, including those currently out of rotation
+var configuredServers []string
+
+// Protects the servers, since servers are selected from many goroutines
+var serversLock sync.RWMutex
+
+// resolveDNS performs the UDP queries without EDNS0 options, and can be replaced during testing
+var resolveDNS = reconQuery
+
+// reconQuery performs the query using recon, giving up by the deadline of the context.
+// Since recon cannot be interrupted, the abandoned query finishes in the background
+func reconQuery(ctx context.Context, name, server, qtype string) ([]recon.DNSAnswer, error) {
+	if err := ctx.Err(); err != nil {
+		return []recon.DNSAnswer{}, contextError(err)
+	}
+
+	// Buffered, so the query does not block once it has been abandoned
+	result := make(chan *exchangeResult, 1)
+	go func() {
+		answers, err := recon.ResolveDNS(name, server, qtype)
+		result <- &exchangeResult{answers: answers, err: err}
+	}()
+
+	select {
+	case r := <-result:
+		return r.answers, r.err
+	case <-ctx.Done():
+		return []recon.DNSAnswer{}, contextError(ctx.Err())
+	}
+}
+
+// contextError translates the error of a finished context into the resolution errors
+func contextError(err error) error {
+	if err == context.Canceled {
+		return ErrCanceled
+	}
+	return ErrTimeout
+}
+
+// Ensures the public servers are checked once, unless servers have been provided
+var checkServers sync.Once
+
+// Set once SetNameservers has replaced the public servers, protected by serversLock
+var customServers bool
+
+func init() {
+	// The servers are checked when first needed, so importing the package does not wait on the network
+	configuredServers = knownPublicServers
+	usableServers = append([]string{}, knownPublicServers...)
+}
+
+/* DNS processing routines */
+
+// InitNameservers - Checks the known public servers in parallel, and resolves names against the
+// servers that responded. This is performed automatically when a server is first needed, unless
+// SetNameservers has been called, and returns early with the error of the context when it is done.
+// The servers provided to SetNameservers are kept, and the public servers are not checked
+func InitNameservers(ctx context.Context) error {
+	checkServers.Do(func() {})
+
+	serversLock.RLock()
+	custom := customServers
+	serversLock.RUnlock()
+	if custom {
+		return nil
+	}
+
+	working, err := probeServers(ctx, knownPublicServers)
+	if err != nil {
+		return err
+	}
+	if len(working) == 0 {
+		return errors.New("None of the public nameservers responded")
+	}
+
+	serversLock.Lock()
+	defer serversLock.Unlock()
+
+	// SetNameservers may have been called during the check
+	if !customServers {
+		configuredServers = knownPublicServers
+		usableServers = working
+	}
+	return nil
+}
+
+// ensureNameservers checks the public servers the first time servers are needed
+func ensureNameservers() {
+	checkServers.Do(func() {
+		if working, err := probeServers(context.Background(), knownPublicServers); err == nil && len(working) > 0 {
+			serversLock.Lock()
+			usableServers = working
+			serversLock.Unlock()
+		}
+	})
+}
+
+// probeServers resolves a well-known name against each server in parallel, each within the probe
+// timeout, and returns the servers that responded in their original order. Every probe has ended
+// by the time it returns
+func probeServers(ctx context.Context, servers []string) ([]string, error) {
+	ok := make([]bool, len(servers))
+
+	var wg sync.WaitGroup
+	for i, server := range servers {
+		wg.Add(1)
+		go func(i int, server string) {
+			defer wg.Done()
+
+			pctx, cancel := context.WithTimeout(ctx, defaultProbeTimeout)
+			defer cancel()
+
+			_, err := resolveDNS(pctx, "google.com", server, "A")
+			// Answers arriving after the timeout are not trusted
+			ok[i] = err == nil && pctx.Err() == nil
+		}(i, server)
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return []string{}, err
+	}
+
+	var working []string
+	for i, server := range servers {
+		if ok[i] {
+			working = append(working, server)
+		}
+	}
+	return working, nil
+}
+
+// Nameservers - Returns the servers that names are currently resolved against
+func Nameservers() []string {
+	ensureNameservers()
+
+	serversLock.RLock()
+	defer serversLock.RUnlock()
+
+	return append([]string{}, usableServers...)
+}
+
+// currentNameservers returns the servers in use without checking the public servers first
+func currentNameservers() []string {
+	serversLock.RLock()
+	defer serversLock.RUnlock()
+
+	return append([]string{}, usableServers...)
+}
+
+// SetNameservers - Replaces the public servers with the provided servers (host:port).
+// Each server is checked by resolving a well-known name, and the servers that fail
+// are dropped and listed in the returned error. When no server passes, the current
+// servers remain in use
+func SetNameservers(servers []string) error {
+	var valid, failed []string
+	// The provided servers replace the public servers, which no longer need to be checked
+	checkServers.Do(func() {})
+
+	for _, server := range servers {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			failed = append(failed, server)
+			continue
+		}
+		valid = append(valid, server)
+	}
+
+	working, _ := probeServers(context.Background(), valid)
+	for _, server := range valid {
+		if !containsServer(working, server) {
+			failed = append(failed, server)
+		}
+	}
+
+	if len(working) > 0 {
+		serversLock.Lock()
+		customServers = true
+		configuredServers = valid
+		usableServers = working
+		serverFailures = make(map[string]int)
+		serverRefusals = make(map[string]int)
+		serverQuarantine = make(map[string]time.Time)
+		serversLock.Unlock()
+	}
+
+	if len(failed) > 0 {
+		return errors.New("The following nameservers failed the check: " + strings.Join(failed, ", "))
+	}
+	if len(working) == 0 {
+		return errors.New("No nameservers were provided")
+	}
+	return nil
+}
+
+// NextNameserver - Selects a server as determined by the selection mode, which by default favors
+// the servers that have been responding quickly. When a per-server rate has been set, this waits
+// until a server is within its rate
+func NextNameserver() string {
+	return selectNameserver(Nameservers, func(servers []string) string {
+		return weightedServer(servers, defaultRand)
+	})
+}
+
+// nextNameserver - Selects a server using the random source of the service,
+// or the next server in order when round-robin selection has been set
+func (ds *DNSService) nextNameserver() string {
+	if ds.SelectionMode() == RoundRobinSelection {
+		return selectNameserver(ds.nameservers, ds.roundRobinServer)
+	}
+
+	rng := ds.random()
+	return selectNameserver(ds.nameservers, func(servers []string) string {
+		return weightedServer(servers, rng)
+	})
+}
+
+// roundRobinServer selects the server following the one selected last by the service
+func (ds *DNSService) roundRobinServer(servers []string) string {
+	ds.Lock()
+	defer ds.Unlock()
+
+	server := servers[ds.roundRobin%len(servers)]
+	ds.roundRobin++
+	return server
+}
+
+func selectNameserver(list func() []string, choose func([]string) string) string {
+	for {
+		servers := withoutQuarantined(list())
+
+		server, wait := limiter.acquire(servers, choose)
+		if server != "" {
+			return server
+		}
+		time.Sleep(wait)
+	}
+}
+
+//-------------------------------------------------------------------------------------------
+// DNSService implementation
+
+type wildcard struct {
+	Req *AmassRequest
+	Ans chan bool
+}
+
+// ConflictPolicy - Determines how names reached through a CNAME chain are
+// reported when they resolve to a different address on their own
+type ConflictPolicy int
+
+const (
+	// Report the address obtained through the CNAME chain
+	PreferCNAME ConflictPolicy = iota
+
+	// Report the address obtained by resolving the name directly
+	PreferDirect
+
+	// Report both addresses when they differ, with each result flagged as a conflict
+	EmitBothFlagged
+)
+
+// SelectionMode - Determines how the servers used for each query are chosen
+type SelectionMode int
+
+const (
+	// Select a random server from the usable public servers
+	RandomSelection SelectionMode = iota
+
+	// Try the fallback servers in order until one of them succeeds
+	FallbackSelection
+
+	// Cycle through the usable public servers in order, so each receives an even share
+	RoundRobinSelection
+)
+
+// RecordMode - Determines which address records are requested for each name
+type RecordMode int
+
+const (
+	// Request both the A and AAAA records
+	RecordBoth RecordMode = iota
+
+	// Only request the A records
+	RecordAOnly
+
+	// Only request the AAAA records
+	RecordAAAAOnly
+)
+
+// queryTypes returns the query types used to obtain the address records
+func (m RecordMode) queryTypes() []string {
+	switch m {
+	case RecordAOnly:
+		return []string{"A"}
+	case RecordAAAAOnly:
+		return []string{"AAAA"}
+	}
+	return []string{"A", "AAAA"}
+}
+
+type DNSService struct {
+	BaseAmassService
+
+	// Cancelling the context stops the service
+	ctx context.Context
+
+	frequency time.Duration
+
+	// The bounds of the frequency when it adapts to the failure rate, and the outcomes observed
+	minFrequency, maxFrequency time.Duration
+	rateOutcomes, rateFailures int
+
+	// The time allowed for each DNS query before it is abandoned
+	queryTimeout time.Duration
+
+	// The random source used to generate wildcard probes and select servers
+	rng *lockedRand
+
+	// Answers kept to avoid repeating identical queries, and the maximum time they are kept
+	cache    *answerCache
+	cacheTTL time.Duration
+
+	// Which address records are requested for each name
+	recordMode RecordMode
+
+	// Determines if reverse lookups are performed on the resolved addresses
+	reverseDNS bool
+
+	// Determines if the mail exchangers of the resolved names are obtained
+	mailExchangers bool
+
+	// Determines if TXT records are obtained and parsed for SPF hostnames
+	parseSPF bool
+
+	// Determines if the CAA records of the domain are attached to the results
+	fetchCAA bool
+
+	// Determines if private and reserved addresses are removed from the results
+	excludePrivate bool
+
+	// Addresses that are treated as wildcards for every zone
+	blacklist *stringset.StringSet
+
+	// Addresses that are never treated as wildcard matches
+	whitelist *stringset.StringSet
+
+	// Determines if the zone of each resolved name is determined using SOA queries
+	lookupSOA bool
+
+	// The wall-clock limit for the scan, and whether it ended by reaching the limit
+	maxDuration      time.Duration
+	deadlineExceeded bool
+
+	// Determines if the letters of query names are randomly cased
+	use0x20 bool
+
+	// Determines if queries are reported through the callback instead of being sent
+	dryRun   bool
+	onDryRun func(name, qtype, server string)
+	// The subdomains whose wildcard probes have been reported during the dry run
+	plannedProbes map[string]struct{}
+
+	// Decides which names are resolved, in addition to the names that have been seen
+	nameFilter func(name string) bool
+
+	// Called at each interval with a snapshot of the counters
+	heartbeatInterval time.Duration
+	heartbeat         func(*DNSStats)
+
+	// Rewrites each name before the duplicate check
+	canonicalize func(name string) string
+
+	// Determines if dangling CNAME records are reported, and the providers prone to takeovers
+	detectDangling    bool
+	takeoverProviders []string
+
+	// How often the servers are checked
+	healthInterval time.Duration
+
+	// Requests are sent through this channel to check DNS wildcard matches,
+	// and the number of goroutines receiving from it
+	wildcards       chan *wildcard
+	wildcardWorkers int
+
+	// The results of wildcard detection, shared by the workers
+	knownWildcards *wildcardCache
+
+	// Set when the queries must not affect the server selection
+	detached bool
+
+	// Receives the failed resolutions, when it has been set
+	errOutput chan error
+
+	// Determines if the variations of each resolved name are resolved
+	mutate bool
+
+	// The domains considered in scope in addition to the domain of each request
+	scopeDomains []string
+
+	// The order in which the queued names are resolved, by tag
+	tagPriorities map[string]int
+
+	// Determines if names are emitted before the wildcard detection for their subdomains completes
+	asyncWildcards bool
+
+	// Receives the provisional names found to match a wildcard, when it has been set
+	retractions chan *AmassRequest
+
+	// The number of distinct servers that must agree on a resolution
+	confirmServers int
+
+	// Receives the names discovered outside of the domain, when it has been set
+	outOfScope chan *AmassRequest
+
+	// Names discovered while resolving are sent through this channel to be queued
+	requeue chan *AmassRequest
+
+	// The names waiting in the queue and the goroutines performing work, used to detect idleness
+	queued  int
+	pending int
+
+	// The maximum number of names resolved at the same time
+	maxConcurrency int
+
+	// The service labels queried for SRV records under each domain
+	srvProbes []string
+
+	// The maximum number of names remembered to avoid resolving them again
+	filterLimit int
+
+	// Names shared with other services, so they are only resolved once
+	sharedFilter *stringset.StringSet
+
+	// Determines if CNAME chains are only followed while within the domain, and how far
+	sameDomainCNAME bool
+	maxCNAMEDepth   int
+
+	// CNAME records with empty or invalid targets
+	malformed []recon.DNSAnswer
+
+	// Index of the names discovered on each address
+	addresses *addressIndex
+
+	// Counters describing the work performed by the service, and where metrics are exported
+	stats   *dnsStats
+	metrics MetricsExporter
+
+	// Performs the individual DNS queries
+	resolver Resolver
+
+	// Determines if the queue is finished when the service stops, and is set once draining begins
+	drainOnStop bool
+	draining    bool
+
+	// Determines if the output channel is closed once the service has stopped, and protects
+	// the sends on the channel from the close
+	closeOutput  bool
+	outputLock   sync.RWMutex
+	outputClosed bool
+
+	// How conflicting CNAME and direct resolutions are reconciled
+	conflictPolicy ConflictPolicy
+
+	// The maximum number of results emitted for a single resolved name
+	maxEmissions int
+
+	// The last discovery round that will be resolved
+	maxRound int
+
+	// The minimum entropy, in bits, of the labels generated for wildcard probes
+	minProbeEntropy float64
+
+	// Determines if resolved names are checked against wildcards
+	wildcardDetect bool
+
+	// The unlikely names probed for each subdomain, and how many must agree on a wildcard
+	wildcardProbes    int
+	wildcardAgreement int
+
+	// How long wildcard detection results are cached, and where re-evaluations are reported
+	wildcardTTL     time.Duration
+	wildcardChanges chan *WildcardChange
+
+	// Called once for each subdomain found to have a wildcard
+	wildcardCallback func(sub string, answers []string)
+
+	// Determines if names are resolved against the authoritative servers of their domain,
+	// and if the recursive answers are compared with the authoritative answers
+	authoritative bool
+	compareAuth   bool
+	auth          *authServers
+
+	// The number of different servers tried after a SERVFAIL response, and after other failures
+	servfailRetries int
+	maxRetries      int
+
+	// How servers are selected, the ordered servers used by FallbackSelection,
+	// and the number of servers selected by RoundRobinSelection
+	selection       SelectionMode
+	fallbackServers []string
+	roundRobin      int
+
+	// What happens to results when the consumer cannot keep up
+	outputPolicy OutputPolicy
+	dropped      int64
+	spillPath    string
+	spill        *diskBuffer
+	spillFailed  bool
+
+	// Periodic persistence of the service state for crash recovery
+	checkpointPath     string
+	checkpointInterval time.Duration
+	restore            *Checkpoint
+	journal            *resultJournal
+	inflight           map[*AmassRequest]*inflightRequest
+	requeued           map[*AmassRequest]struct{}
+	checkpointBusy     bool
+
+	// Names periodically re-resolved to detect infrastructure changes
+	monitorInterval time.Duration
+	monitorNames    []string
+	changes         chan *AddressChange
+
+	// Resolution over several transports with the answers merged
+	mergeTransports bool
+	extraTransports []string
+
+	// Randomized delay between a name entering the queue and being resolved
+	minDispatchDelay time.Duration
+	maxDispatchDelay time.Duration
+}
+
+func NewDNSService(in, out chan *AmassRequest) *DNSService {
+	ds := &DNSService{
+		frequency:         5 * time.Millisecond,
+		wildcards:         make(chan *wildcard, defaultWildcardBuffer),
+		wildcardWorkers:   defaultWildcardWorkers,
+		requeue:           make(chan *AmassRequest, 50),
+		addresses:         newAddressIndex(),
+		stats:             newDNSStats(),
+		rng:               newLockedRand(nil),
+		wildcardDetect:    true,
+		wildcardProbes:    defaultWildcardProbes,
+		wildcardAgreement: defaultWildcardAgreement,
+		takeoverProviders: DefaultTakeoverProviders,
+		blacklist:         stringset.NewStringSet(),
+		whitelist:         stringset.NewStringSet(),
+		cache:             newAnswerCache(),
+		cacheTTL:          defaultCacheTTL,
+		metrics:           NoopExporter{},
+		canonicalize:      DefaultCanonicalizer,
+		tagPriorities:     DefaultTagPriorities,
+		resolver:          DefaultResolver{},
+		auth:              newAuthServers(),
+		maxEmissions:      defaultMaxEmissions,
+		minProbeEntropy:   defaultMinProbeEntropy,
+		servfailRetries:   defaultServFailRetries,
+		maxRetries:        defaultMaxRetries,
+		maxCNAMEDepth:     defaultMaxCNAMEDepth,
+		queryTimeout:      defaultQueryTimeout,
+	}
+
+	ds.BaseAmassService = *NewBaseAmassService("DNS Service", ds)
+
+	ds.knownWildcards = newWildcardCache(ds.wildcardDetection)
+	ds.knownWildcards.ttl = ds.WildcardTTL
+	ds.knownWildcards.onChange = ds.sendWildcardChange
+	ds.knownWildcards.onDetect = ds.reportWildcard
+
+	ds.input = in
+	ds.output = out
+	return ds
+}
+
+// NewDNSServiceWithContext - Returns a DNSService that is stopped when the context is cancelled,
+// which also abandons the queries in progress
+func NewDNSServiceWithContext(ctx context.Context, in, out chan *AmassRequest) *DNSService {
+	ds := NewDNSService(in, out)
+
+	ds.ctx = ctx
+	return ds
+}
+
+func (ds *DNSService) OnStart() error {
+	ds.BaseAmassService.OnStart()
+
+	if ds.ctx != nil {
+		go ds.watchContext()
+	}
+	go ds.processRequests()
+	// The workers share the cache, so each subdomain is still only probed once
+	for i := 0; i < ds.WildcardWorkers(); i++ {
+		go ds.processWildcardMatches()
+	}
+	go ds.processMonitoring()
+	go ds.processHealthChecks()
+	go ds.processHeartbeat()
+	return nil
+}
+
+func (ds *DNSService) OnStop() error {
+	ds.BaseAmassService.OnStop()
+
+	if ds.DrainOnStop() {
+		ds.Lock()
+		ds.draining = true
+		ds.Unlock()
+		// A paused service would never empty its queue, so the dispatch is resumed to drain it
+		ds.Resume()
+		// The queue and in-flight requests are finished before the loops are broken
+		ds.WaitUntilIdle(context.Background())
+	}
+	if ds.CloseOutputOnStop() {
+		go ds.closeOutputChannel()
+	}
+	return nil
+}
+
+// NameFilter - Returns the function deciding which names are resolved, or nil when there is none
+func (ds *DNSService) NameFilter() func(name string) bool {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.nameFilter
+}
+
+// SetNameFilter - Sets a function that is called with each name before it is queued,
+// and names are dropped when it returns false. A nil function resolves every name
+func (ds *DNSService) SetNameFilter(keep func(name string) bool) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.nameFilter = keep
+}
+
+// DefaultCanonicalizer - Lowercases the name and strips a single trailing dot
+func DefaultCanonicalizer(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".")
+}
+
+// NameCanonicalizer - Returns the function rewriting each name before it is queued
+func (ds *DNSService) NameCanonicalizer() func(name string) string {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.canonicalize
+}
+
+// SetNameCanonicalizer - Sets a function that rewrites each name before the duplicate check, so
+// variant spellings, such as IDN names and their punycode, collapse into a single query. A nil
+// function restores DefaultCanonicalizer
+func (ds *DNSService) SetNameCanonicalizer(fn func(name string) string) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	if fn == nil {
+		fn = DefaultCanonicalizer
+	}
+	ds.canonicalize = fn
+}
+
+// MaxDuration - Returns the wall-clock limit after which no more names are resolved
+func (ds *DNSService) MaxDuration() time.Duration {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.maxDuration
+}
+
+// SetMaxDuration - Sets the wall-clock limit, measured from Start, after which the queued names
+// are abandoned and no more names are resolved. This must be set before Start, and zero means no limit
+func (ds *DNSService) SetMaxDuration(d time.Duration) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.maxDuration = d
+}
+
+// DeadlineExceeded - Returns true if the scan ended by reaching the maximum duration,
+// rather than by resolving all the names
+func (ds *DNSService) DeadlineExceeded() bool {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.deadlineExceeded
+}
+
+// deadlineTimer returns the channel that signals the maximum duration, which is nil when there is no limit
+func (ds *DNSService) deadlineTimer() (<-chan time.Time, func()) {
+	d := ds.MaxDuration()
+	if d <= 0 {
+		return nil, func() {}
+	}
+
+	t := time.NewTimer(d)
+	return t.C, func() { t.Stop() }
+}
+
+// DrainOnStop - Returns true if Stop finishes the queued names before returning
+func (ds *DNSService) DrainOnStop() bool {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.drainOnStop
+}
+
+// SetDrainOnStop - Determines if Stop stops accepting input, and then waits for the
+// queued names and in-flight requests to be resolved. By default, they are abandoned
+func (ds *DNSService) SetDrainOnStop(drain bool) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.drainOnStop = drain
+}
+
+// acceptInput returns the channel providing new names, which is nil while the service drains
+func (ds *DNSService) acceptInput() <-chan *AmassRequest {
+	ds.Lock()
+	defer ds.Unlock()
+
+	if ds.draining {
+		return nil
+	}
+	return ds.BaseAmassService.Input()
+}
+
+// watchContext stops the service once the context has been cancelled
+func (ds *DNSService) watchContext() {
+	select {
+	case <-ds.ctx.Done():
+		if !ds.IsStopped() {
+			ds.Stop()
+		}
+	case <-ds.Quit():
+	}
+}
+
+func (ds *DNSService) Frequency() time.Duration {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.frequency
+}
+
+func (ds *DNSService) SetFrequency(freq time.Duration) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.frequency = freq
+}
+
+// ReverseDNS - Returns true if reverse lookups are performed on the resolved addresses
+func (ds *DNSService) ReverseDNS() bool {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.reverseDNS
+}
+
+// SetReverseDNS - Causes a PTR lookup to be performed on each resolved address,
+// with the names discovered within the domain being queued for resolution
+func (ds *DNSService) SetReverseDNS(enabled bool) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.reverseDNS = enabled
+}
+
+// MailExchangers - Returns true if MX lookups are performed on the resolved names
+func (ds *DNSService) MailExchangers() bool {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.mailExchangers
+}
+
+// SetMailExchangers - Causes an MX lookup to be performed on each resolved name, with the mail
+// exchangers in scope being queued for resolution and the others reported as out of scope
+func (ds *DNSService) SetMailExchangers(enabled bool) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.mailExchangers = enabled
+}
+
+// QueryTimeout - Returns the time allowed for each DNS query
+func (ds *DNSService) QueryTimeout() time.Duration {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.queryTimeout
+}
+
+// SetQueryTimeout - Sets the time allowed for each DNS query, after which the query fails
+// with ErrTimeout, so unreachable servers do not hold up the service. Zero means no limit
+func (ds *DNSService) SetQueryTimeout(timeout time.Duration) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.queryTimeout = timeout
+}
+
+// SameDomainCNAME - Returns true if CNAME chains stop being followed once they leave the domain
+func (ds *DNSService) SameDomainCNAME() bool {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.sameDomainCNAME
+}
+
+// SetSameDomainCNAME - Limits CNAME chains to hops within the request domain. The record
+// leading outside the domain is still included in the answers, but its target is not followed
+func (ds *DNSService) SetSameDomainCNAME(same bool) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.sameDomainCNAME = same
+}
+
+// ConflictPolicy - Returns the policy used for names that resolve differently through CNAME chains
+func (ds *DNSService) ConflictPolicy() ConflictPolicy {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.conflictPolicy
+}
+
+// SetConflictPolicy - Sets how names reached through CNAME chains are reconciled with direct resolution
+func (ds *DNSService) SetConflictPolicy(policy ConflictPolicy) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.conflictPolicy = policy
+}
+
+// MaxEmissions - Returns the maximum number of distinct names emitted for a single resolved name
+func (ds *DNSService) MaxEmissions() int {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.maxEmissions
+}
+
+// SetMaxEmissions - Caps the distinct names, including those in the CNAME chain, emitted for a
+// single resolved name, where zero means no limit
+func (ds *DNSService) SetMaxEmissions(max int) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.maxEmissions = max
+}
+
+// SelectionMode - Returns how the servers used for each query are chosen
+func (ds *DNSService) SelectionMode() SelectionMode {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.selection
+}
+
+// RecordMode - Returns which address records are requested for each name
+func (ds *DNSService) RecordMode() RecordMode {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.recordMode
+}
+
+// SetRecordMode - Sets which address records are requested for each name, including
+// the names used during wildcard detection, so IPv6 wildcards are caught in AAAA mode
+func (ds *DNSService) SetRecordMode(mode RecordMode) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.recordMode = mode
+}
+
+// SetSelectionMode - Sets how the servers used for each query are chosen
+func (ds *DNSService) SetSelectionMode(mode SelectionMode) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.selection = mode
+}
+
+// ServFailRetries - Returns the number of different servers tried after a SERVFAIL response
+func (ds *DNSService) ServFailRetries() int {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.servfailRetries
+}
+
+// SetServFailRetries - Sets the number of different servers tried after a SERVFAIL response,
+// which some resolvers return for valid names due to DNSSEC validation or upstream problems
+func (ds *DNSService) SetServFailRetries(retries int) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.servfailRetries = retries
+}
+
+// MaxRetries - Returns the number of different servers tried after a query fails
+// for reasons other than NXDOMAIN and SERVFAIL
+func (ds *DNSService) MaxRetries() int {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.maxRetries
+}
+
+// SetMaxRetries - Sets the number of different servers tried after a query fails, such as
+// by timing out, so a single unreliable server does not cause the name to be missed.
+// SERVFAIL responses are governed by SetServFailRetries
+func (ds *DNSService) SetMaxRetries(retries int) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.maxRetries = retries
+}
+
+// FallbackServers - Returns the servers tried in order by FallbackSelection
+func (ds *DNSService) FallbackServers() []string {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.fallbackServers
+}
+
+// SetFallbackServers - Sets the servers (host:port) tried in order by FallbackSelection
+func (ds *DNSService) SetFallbackServers(servers []string) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.fallbackServers = servers
+}
+
+// MaxRound - Returns the last discovery round that will be resolved
+func (ds *DNSService) MaxRound() int {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.maxRound
+}
+
+// SetMaxRound - Sets the last discovery round that will be resolved, where zero means no limit.
+// Requests from later rounds are dropped, which stops further expansion of the enumeration
+func (ds *DNSService) SetMaxRound(max int) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.maxRound = max
+}
+
+// MaxConcurrency - Returns the maximum number of names resolved at the same time
+func (ds *DNSService) MaxConcurrency() int {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.maxConcurrency
+}
+
+// SetMaxConcurrency - Sets the maximum number of names resolved at the same time, where
+// zero means no limit. Names remain in the queue while the limit has been reached.
+// Must be set before the service is started
+func (ds *DNSService) SetMaxConcurrency(max int) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.maxConcurrency = max
+}
+
+// DispatchDelay - Returns the range of the randomized delay applied before resolving queued names
+func (ds *DNSService) DispatchDelay() (time.Duration, time.Duration) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.minDispatchDelay, ds.maxDispatchDelay
+}
+
+// SetDispatchDelay - Sets the range of the randomized delay between a name being discovered
+// and becoming eligible for resolution, which avoids recognizable bursts of queries
+func (ds *DNSService) SetDispatchDelay(min, max time.Duration) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	if max < min {
+		max = min
+	}
+	ds.minDispatchDelay = min
+	ds.maxDispatchDelay = max
+}
+
+// readyTime returns when a name entering the queue can be dispatched for resolution
+func (ds *DNSService) readyTime() time.Time {
+	min, max := ds.DispatchDelay()
+
+	delay := min
+	if max > min {
+		delay += time.Duration(ds.random().Int63n(int64(max - min)))
+	}
+	return time.Now().Add(delay)
+}
+
+func (ds *DNSService) sendOut(req *AmassRequest) {
+	req.Name = trim252F(req.Name)
+	ds.addresses.Insert(req.Address, req.Name)
+	for _, addr := range req.Addresses {
+		ds.addresses.Insert(addr, req.Name)
+	}
+	ds.deliver(req)
+	ds.SetActive(true)
+}
+
+// queueName sends a name discovered by the service back into the queue for resolution
+func (ds *DNSService) queueName(req *AmassRequest) {
+	// The name is outstanding work until processRequests has added it to the queue
+	ds.trackWork(1)
+	ds.startRequeue(req)
+
+	select {
+	case ds.requeue <- req:
+	case <-ds.Quit():
+		ds.trackWork(-1)
+	}
+}
+
+func (ds *DNSService) processRequests() {
+	// Filter for not double-checking subdomain names
+	filter := newNameFilter(ds.FilterLimit())
+	// Domains that have been seen in the input
+	domains := make(map[string]struct{})
+	// Resume from a checkpoint when one has been provided
+	queue := newRequestQueue()
+	restored, pending := ds.restoreState(filter)
+	for _, req := range restored {
+		queue.Push(req, ds.priorities()[req.Tag])
+	}
+	ds.setQueued(queue.Len())
+
+	freq := ds.Frequency()
+	t := time.NewTicker(freq)
+	defer func() { t.Stop() }()
+
+	check := time.NewTicker(5 * time.Second)
+	defer check.Stop()
+
+	checkpoint, stopCheckpoint := ds.checkpointTicker()
+	defer stopCheckpoint()
+	defer ds.closeJournal()
+
+	deadline, stopDeadline := ds.deadlineTimer()
+	defer stopDeadline()
+
+	// Limits the names being resolved at the same time
+	var sem chan struct{}
+	if max := ds.MaxConcurrency(); max > 0 {
+		sem = make(chan struct{}, max)
+	}
+
+	enqueue := func(add *AmassRequest) {
+		// Nothing more is resolved once the maximum duration has been reached
+		if ds.DeadlineExceeded() {
+			return
+		}
+
+		add.Name = ds.NameCanonicalizer()(trim252F(add.Name))
+		// Malformed names would only waste queries on the resolvers
+		if add.Name != "" && !validName(add.Name) {
+			ds.stats.invalidName()
+			return
+		}
+		if keep := ds.NameFilter(); add.Name != "" && keep != nil && !keep(add.Name) {
+			ds.stats.filteredName()
+			return
+		}
+		// Stop expanding once the maximum discovery round has been reached
+		if max := ds.MaxRound(); max > 0 && add.Round > max {
+			return
+		}
+
+		if add.Name != "" && !filter.Contains(add.Name) {
+			filter.Insert(add.Name)
+			// Another service sharing the filter is responsible for the name
+			if !ds.claimName(add.Name) {
+				return
+			}
+			// Discover the nameservers as each new domain arrives
+			if _, found := domains[add.Domain]; add.Domain != "" && !found {
+				domains[add.Domain] = struct{}{}
+				domain, round := add.Domain, add.Round
+				ds.goWork(func() { ds.sendNameservers(domain, round) })
+				ds.goWork(func() { ds.sendSRVTargets(domain, round) })
+				if ds.Authoritative() {
+					ds.goWork(func() { ds.nameserversFor(domain) })
+				}
+			}
+			// Names waiting on the dispatch delay are kept apart until they become eligible
+			if min, max := ds.DispatchDelay(); max > 0 || min > 0 {
+				queue.PushDelayed(add, ds.priorities()[add.Tag], ds.readyTime())
+			} else {
+				queue.Push(add, ds.priorities()[add.Tag])
+			}
+			ds.setQueued(queue.Len())
+			ds.MetricsExporter().SetGauge(MetricQueueDepth, float64(queue.Len()), nil)
+			// Mark the service as active
+			ds.BaseAmassService.SetActive(true)
+		}
+	}
+	// The discovered names that had not entered the queue are checked like new names
+	for _, add := range pending {
+		enqueue(add)
+	}
+loop:
+	for {
+		select {
+		case add := <-ds.acceptInput():
+			enqueue(add)
+		case add := <-ds.requeue: // Names discovered by the service itself
+			ds.finishRequeue(add)
+			enqueue(add)
+			// The name was counted as work while waiting to enter the queue
+			ds.trackWork(-1)
+		case <-t.C: // Pops a DNS name off the queue for resolution
+			// The frequency may have been changed or adapted to the failure rate
+			if f := ds.Frequency(); f != freq && f > 0 {
+				t.Stop()
+				t = time.NewTicker(f)
+				freq = f
+			}
+			// The queued names are kept while the service is paused
+			if ds.IsPaused() {
+				continue
+			}
+			if next, pos, found := queue.Next(time.Now()); found {
+				// Stale requests are not worth the queries once the queue has backed up
+				if !next.Deadline.IsZero() && time.Now().After(next.Deadline) {
+					ds.stats.expiredRequest()
+				} else if next.Domain != "" && sem != nil {
+					// The name remains in the queue while the limit has been reached
+					select {
+					case sem <- struct{}{}:
+					default:
+						continue
+					}
+					ds.startRequest(next)
+					ds.goWork(func() {
+						ds.performDNSRequest(next)
+						ds.finishRequest(next)
+						<-sem
+					})
+				} else if next.Domain != "" {
+					ds.startRequest(next)
+					ds.goWork(func() {
+						ds.performDNSRequest(next)
+						ds.finishRequest(next)
+					})
+				}
+				queue.Remove(pos)
+				ds.setQueued(queue.Len())
+				ds.MetricsExporter().SetGauge(MetricQueueDepth, float64(queue.Len()), nil)
+			}
+		case <-check.C:
+			if queue.Len() == 0 {
+				// Mark the service as not active
+				ds.SetActive(false)
+			}
+		case <-deadline:
+			ds.Lock()
+			ds.deadlineExceeded = true
+			ds.Unlock()
+			// The names that have not been dispatched are abandoned
+			queue.Clear()
+			ds.setQueued(0)
+			ds.MetricsExporter().SetGauge(MetricQueueDepth, 0, nil)
+			ds.SetActive(false)
+		case <-checkpoint:
+			ds.saveCheckpoint(queue.Requests(), filter)
+		case <-ds.Quit():
+			break loop
+		}
+	}
+}
+
+func (ds *DNSService) performDNSRequest(req *AmassRequest) {
+	// Requests dispatched as the service stops are not performed
+	select {
+	case <-ds.Quit():
+		return
+	default:
+	}
+	ds.SetActive(true)
+
+	var err error
+	var server string
+	var answers []recon.DNSAnswer
+	var transports []string
+	if ds.MergeTransports() {
+		server = ds.queryServers(req.Domain)[0]
+		answers, transports, err = ds.resolveAllTransports(req.Domain, req.Name, server)
+	} else {
+		answers, server, err = ds.resolveName(req.Domain, req.Name)
+	}
+	ds.adaptRate(err)
+	// Truncated CNAME chains still provide the addresses of the name reached at the maximum depth
+	truncated := err == ErrCNAMEDepth
+	if truncated {
+		err = nil
+	}
+	if err != nil {
+		// The wildcard detection the name would have required is reported as well
+		if err == ErrDryRun {
+			ds.planWildcardProbes(req, server)
+		}
+		ds.sendError(req, server, err)
+		// Names expected to resolve are reported when they have disappeared
+		if req.Expected != "" && (err == ErrNXDOMAIN || err == ErrNoRecords) {
+			ds.sendMissing(req)
+		}
+		// The name may only fail to resolve because the target of its CNAME does not exist
+		if err == ErrNXDOMAIN && ds.DetectDangling() {
+			ds.sendDangling(req, ds.nextNameserver())
+		}
+		return
+	}
+
+	if ds.ExcludePrivateIPs() {
+		// Names that only resolve to reserved addresses are not part of the external attack surface
+		if answers = withoutReserved(answers); recon.GetARecordData(answers) == "" {
+			return
+		}
+	}
+	// Pull the IP address out of the DNS answers
+	ipstr := recon.GetARecordData(answers)
+	if ipstr == "" {
+		ds.sendError(req, server, ErrNoRecords)
+		if req.Expected != "" {
+			ds.sendMissing(req)
+		}
+		return
+	}
+	req.Address = ipstr
+	// Load-balanced hosts often have several addresses, and the first is arbitrary
+	req.Addresses = sortedStrings(addressSet(answers))
+	req.Truncated = truncated
+
+	validation := ValidationNone
+	if req.Expected != "" {
+		validation = ValidationMismatched
+		if addressSet(answers).Contains(req.Expected) {
+			validation = ValidationMatched
+		}
+	}
+
+	// Parking addresses shared across unrelated zones are dropped like wildcards, whatever the source
+	if ds.blacklisted(append([]string{req.Address}, req.Addresses...)) {
+		ds.sendError(req, server, ErrWildcardMatch)
+		ds.stats.wildcardSuppression(req.Domain)
+		ds.MetricsExporter().AddCounter(MetricWildcardSuppressions, 1, map[string]string{"domain": req.Domain})
+		return
+	}
+
+	// Names the confirmation servers disagree on are not trusted
+	if !ds.confirmResolution(req.Name, answers, server) {
+		return
+	}
+
+	match := ds.checkWildcards(req, server)
+	// If the name didn't come from a search, check it doesn't match a wildcard IP address
+	if req.Tag != SEARCH && match {
+		ds.sendError(req, server, ErrWildcardMatch)
+		ds.stats.wildcardSuppression(req.Domain)
+		ds.MetricsExporter().AddCounter(MetricWildcardSuppressions, 1, map[string]string{"domain": req.Domain})
+		return
+	}
+	// Mail infrastructure often reveals additional names
+	if ds.MailExchangers() {
+		ds.goRequestWork(req, func() { ds.sendMailExchangers(req, server) })
+	}
+	if ds.ReverseDNS() {
+		ds.goRequestWork(req, func() { ds.sendReverseNames(req, server) })
+	}
+	if ds.MutateNames() {
+		ds.goRequestWork(req, func() { ds.sendMutations(req) })
+	}
+
+	var discrepancy *Discrepancy
+	if ds.CompareAuthoritative() {
+		discrepancy = ds.compareResolution(req.Domain, req.Name, answers, server)
+	}
+
+	var txt []string
+	if ds.ParseSPF() {
+		txt, _ = ds.dnsQueryTXT(req.Name, server)
+		ds.goRequestWork(req, func() { ds.sendSPFNames(req, txt) })
+	}
+
+	records := answers
+	if ds.FetchCAA() {
+		if caa, err := ds.dnsQueryCAA(req.Domain, server); err == nil && len(caa) > 0 {
+			records = append(append([]recon.DNSAnswer{}, answers...), caa...)
+		}
+	}
+
+	var soa *SOARecord
+	lookupSOA := ds.LookupSOA()
+	if lookupSOA {
+		soa, _ = ds.zoneOf(req.Name, server)
+	}
+
+	chain := cnameChain(answers)
+	var emitted, dropped int
+	max := ds.MaxEmissions()
+	// Each name is emitted once, since the result already carries all of its addresses
+	handled := make(map[string]struct{})
+	// Return the successfully resolved names + address. Every in-scope name in the chain is
+	// reported, such as b.example.com in a.example.com -> b.example.com -> c.provider.net
+	for _, record := range answers {
+		if _, found := handled[record.Name]; found {
+			continue
+		}
+		handled[record.Name] = struct{}{}
+
+		if ds.scopeOf(record.Name, req.Domain) == "" {
+			// Third-party names in the chain, such as CDNs, are reported separately when requested
+			related := discovered(ProvenanceCNAME, record.Name, req.Domain, req.Round)
+			related.Address = ipstr
+			related.Server = server
+			ds.sendOutOfScope(related)
+			continue
+		}
+		// The suffix does not reveal zones delegated to other owners
+		if record.Name != req.Name && lookupSOA && !ds.sameOwnership(record.Name, req.Domain, server) {
+			continue
+		}
+		// Protect against pathological responses spawning excessive goroutines
+		if max > 0 && emitted >= max {
+			dropped++
+			continue
+		}
+		emitted++
+
+		if record.Name != req.Name {
+			ds.sendChainName(req, record.Name, ipstr, server, chain)
+			continue
+		}
+
+		result := &AmassRequest{
+			Name:        record.Name,
+			Domain:      req.Domain,
+			Address:     ipstr,
+			Tag:         req.Tag,
+			Source:      req.Source,
+			Provenance:  provenanceOf(req),
+			Expected:    req.Expected,
+			Validation:  validation,
+			Discrepancy: discrepancy,
+			Addresses:   req.Addresses,
+			Truncated:   req.Truncated,
+			Transports:  transports,
+			Records:     records,
+			Chain:       chain,
+			TXT:         txt,
+			TTL:         minTTL(answers),
+			Server:      server,
+			SOA:         soa,
+			Round:       req.Round,
+			Provisional: req.Provisional,
+		}
+		ds.goRequestWork(req, func() { ds.sendOut(result) })
+	}
+
+	if dropped > 0 {
+		log.Printf("%s: dropped %d results for %s after reaching the limit of %d", ds, dropped, req.Name, max)
+	}
+}
+
+// sendMissing - Reports that a name expected to resolve no longer does
+func (ds *DNSService) sendMissing(req *AmassRequest) {
+	result := &AmassRequest{
+		Name:       req.Name,
+		Domain:     req.Domain,
+		Tag:        req.Tag,
+		Source:     req.Source,
+		Provenance: provenanceOf(req),
+		Expected:   req.Expected,
+		Validation: ValidationMissing,
+		Round:      req.Round,
+	}
+	ds.goRequestWork(req, func() { ds.sendOut(result) })
+}
+
+// sendChainName - Emits a name discovered in the answers for another name, reconciling
+// the address obtained through the chain with the address the name resolves to directly
+func (ds *DNSService) sendChainName(req *AmassRequest, name, addr, server string, chain []ChainHop) {
+	domain := ds.scopeOf(name, req.Domain)
+	emit := func(addr string, conflict bool) {
+		r := discovered(ProvenanceCNAME, name, domain, req.Round+1)
+		r.Address = addr
+		r.Conflict = conflict
+		r.Chain = chainFrom(chain, name)
+		ds.goRequestWork(req, func() { ds.sendOut(r) })
+	}
+
+	policy := ds.ConflictPolicy()
+	if policy == PreferCNAME {
+		emit(addr, false)
+		return
+	}
+
+	var direct string
+	if answers, err := ds.dnsQuery(req.Domain, name, server); err == nil || err == ErrCNAMEDepth {
+		direct = recon.GetARecordData(answers)
+	}
+
+	switch policy {
+	case PreferDirect:
+		if direct != "" {
+			addr = direct
+		}
+		emit(addr, false)
+	case EmitBothFlagged:
+		conflict := direct != "" && direct != addr
+
+		emit(addr, conflict)
+		if conflict {
+			emit(direct, true)
+		}
+	}
+}
+
+// queryServers - Returns the servers that will be tried, in order, when resolving a name
+func (ds *DNSService) queryServers(domain string) []string {
+	if domain != "" && ds.Authoritative() {
+		if servers := ds.nameserversFor(domain); len(servers) > 0 {
+			// Fall back to a public server when the authoritative servers are unreachable
+			return append(append([]string{}, servers...), ds.nextNameserver())
+		}
+	}
+
+	if ds.SelectionMode() == FallbackSelection {
+		if servers := ds.FallbackServers(); len(servers) > 0 {
+			return servers
+		}
+	}
+	return []string{ds.nextNameserver()}
+}
+
+// ResolveName - Synchronously resolves the name using one of the public servers, following the
+// CNAME chain and obtaining the A and AAAA records, without starting a DNSService. ErrCNAMEDepth
+// is returned with the answers when the chain was longer than the maximum depth
+func ResolveName(domain, name string) ([]recon.DNSAnswer, error) {
+	ds := NewDNSService(nil, nil)
+
+	return ds.dnsQuery(domain, name, NextNameserver())
+}
+
+// ResolveVia - Synchronously resolves the name like ResolveName, but using the provided server
+// (host:port). The server selection, such as the observed latencies, is not affected, which makes
+// it suitable for comparing the answers of several servers
+func ResolveVia(domain, name, server string) ([]recon.DNSAnswer, error) {
+	ds := NewDNSService(nil, nil)
+	ds.detached = true
+
+	return ds.dnsQuery(domain, name, server)
+}
+
+// resolveName - Performs the DNS query against the selected servers until one of them succeeds.
+// The server that provided the answers is returned along with them, or the last server queried on failure
+func (ds *DNSService) resolveName(domain, name string) ([]recon.DNSAnswer, string, error) {
+	var err error
+	var server string
+
+	servers := ds.queryServers(domain)
+	sfRetries, retries := ds.ServFailRetries(), ds.MaxRetries()
+	for i := 0; i < len(servers); i++ {
+		var answers []recon.DNSAnswer
+
+		server = servers[i]
+		answers, err = ds.dnsQuery(domain, name, server)
+		ds.checkServerResponse(server, err)
+		if err == nil || err == ErrCNAMEDepth {
+			return answers, server, err
+		}
+		// Another server will not make the name exist or fix the zone, and the service may have stopped
+		if err == ErrNXDOMAIN || err == ErrCNAMELoop || err == ErrCanceled || err == ErrDryRun {
+			break
+		}
+		if i < len(servers)-1 {
+			continue
+		}
+		// Try a different server before giving up, since some servers fail on valid names
+		// and others are unreliable. SERVFAIL responses have a separate limit
+		var next string
+		if err == ErrServFail && sfRetries > 0 {
+			sfRetries--
+			next = ds.differentNameserver(servers)
+		} else if err != ErrServFail && retries > 0 {
+			retries--
+			next = ds.differentNameserver(servers)
+		}
+		if next != "" {
+			servers = append(servers, next)
+			ds.MetricsExporter().AddCounter(MetricQueryRetries, 1, map[string]string{"server": server})
+		}
+	}
+	return []recon.DNSAnswer{}, server, err
+}
+
+// differentNameserver returns a usable public server not already in the list, or an empty string
+func (ds *DNSService) differentNameserver(tried []string) string {
+	servers := ds.nameservers()
+	if len(servers) == 0 {
+		return ""
+	}
+
+	// Begin at a random server, so the load is spread across them
+	start := ds.random().Intn(len(servers))
+	for i := 0; i < len(servers); i++ {
+		server := servers[(start+i)%len(servers)]
+
+		if !containsServer(tried, server) {
+			return server
+		}
+	}
+	return ""
+}
+
+// dnsQuery - Performs the DNS resolution and pulls names out of the errors or answers
+func (ds *DNSService) dnsQuery(domain, name, server string) ([]recon.DNSAnswer, error) {
+	var resolved bool
+
+	answers, name, err := ds.recursiveCNAME(domain, name, server)
+	if err != nil && err != ErrCNAMEDepth {
+		return []recon.DNSAnswer{}, err
+	}
+	// The name reached at the maximum depth is still resolved when the chain was truncated
+	truncated := err == ErrCNAMEDepth
+	// Obtain the DNS answers for the A and/or AAAA records related to the name
+	var errs []error
+	for _, qtype := range ds.RecordMode().queryTypes() {
+		ans, err := ds.cachedQuery(name, server, qtype)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		answers = append(answers, ans...)
+		resolved = true
+	}
+
+	if !resolved {
+		return []recon.DNSAnswer{}, queryError(errs...)
+	}
+	if truncated {
+		return answers, ErrCNAMEDepth
+	}
+	return answers, nil
+}
+
+// query - Performs a single DNS query and records the metrics for it
+func (ds *DNSService) query(name, server, qtype string) ([]recon.DNSAnswer, error) {
+	if ds.DryRun() {
+		return []recon.DNSAnswer{}, ds.simulateQuery(name, server, qtype)
+	}
+	// Each query sent to the server takes a token, whatever path selected the server
+	if err := ds.waitForToken(server); err != nil {
+		return []recon.DNSAnswer{}, err
+	}
+
+	start := time.Now()
+	sent := name
+	use0x20 := ds.Use0x20()
+	if use0x20 {
+		sent = randomizeCase(name, ds.random())
+	}
+
+	answers, err := ds.timedExchange(sent, server, qtype)
+	if err == nil && use0x20 {
+		answers, err = verifyCase(name, sent, answers)
+	}
+	if !ds.detached {
+		recordLatency(server, time.Since(start))
+	}
+	ds.stats.queryResult(err)
+
+	m := ds.MetricsExporter()
+	labels := map[string]string{"server": server, "type": qtype}
+	m.AddCounter(MetricQueries, 1, labels)
+	if err == nil {
+		m.AddCounter(MetricQuerySuccesses, 1, labels)
+	} else {
+		m.AddCounter(MetricQueryFailures, 1, labels)
+	}
+	m.Observe(MetricQueryLatency, time.Since(start).Seconds(), map[string]string{"server": server})
+	return answers, err
+}
+
+type exchangeResult struct {
+	answers []recon.DNSAnswer
+	err     error
+}
+
+// timedExchange performs the query, giving up once the query timeout has been reached or the service
+// has been stopped. Resolvers implementing ContextResolver also end the query by the timeout, and when
+// the context of the service is cancelled or the service is stopped
+func (ds *DNSService) timedExchange(name, server, qtype string) ([]recon.DNSAnswer, error) {
+	parent := ds.ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+	// The abandoned query is cancelled once the exchange returns
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	if timeout := ds.QueryTimeout(); timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// Buffered, so the query does not block once it has been abandoned
+	result := make(chan *exchangeResult, 1)
+	r := ds.Resolver()
+	go func() {
+		answers, err := resolveWith(ctx, r, name, server, qtype)
+		// Large answer sets only fit in a TCP response
+		if ClassifyError(err) == ErrTruncated {
+			if tr, ok := r.(tcpContextResolver); ok {
+				answers, err = tr.resolveTCPContext(ctx, name, server, qtype)
+			} else if tr, ok := r.(TCPResolver); ok {
+				answers, err = tr.ResolveTCP(name, server, qtype)
+			}
+		}
+		result <- &exchangeResult{answers: answers, err: err}
+	}()
+
+	select {
+	case r := <-result:
+		return r.answers, r.err
+	case <-ctx.Done():
+		if parent.Err() != nil {
+			return []recon.DNSAnswer{}, ErrCanceled
+		}
+		return []recon.DNSAnswer{}, ErrTimeout
+	case <-ds.Quit():
+		return []recon.DNSAnswer{}, ErrCanceled
+	}
+}
+
+// resolveWith performs the query using the resolver, passing the context when the resolver accepts it
+func resolveWith(ctx context.Context, r Resolver, name, server, qtype string) ([]recon.DNSAnswer, error) {
+	if cr, ok := r.(ContextResolver); ok {
+		return cr.ResolveContext(ctx, name, server, qtype)
+	}
+	return r.Resolve(name, server, qtype)
+}
+
+// dnsQueryMX - Obtains the mail exchanger records for the name, with the targets as the data
+func (ds *DNSService) dnsQueryMX(name, server string) ([]recon.DNSAnswer, error) {
+	answers, err := ds.query(name, server, "MX")
+	if err != nil {
+		return []recon.DNSAnswer{}, queryError(err)
+	}
+
+	var mx []recon.DNSAnswer
+	for _, a := range answers {
+		// The preference may be provided along with the target
+		fields := strings.Fields(a.Data)
+		if len(fields) == 0 || !validTarget(fields[len(fields)-1]) {
+			continue
+		}
+
+		a.Data = strings.TrimSuffix(fields[len(fields)-1], ".")
+		mx = append(mx, a)
+	}
+	return mx, nil
+}
+
+// sendMailExchangers queues the mail exchangers within the domain for resolution,
+// and reports the mail exchangers outside of the domain as out of scope
+func (ds *DNSService) sendMailExchangers(req *AmassRequest, server string) {
+	answers, err := ds.dnsQueryMX(req.Name, server)
+	if err != nil {
+		return
+	}
+
+	for _, a := range answers {
+		if domain := ds.scopeOf(a.Data, req.Domain); domain != "" {
+			ds.queueName(discovered(ProvenanceMX, a.Data, domain, req.Round+1))
+			continue
+		}
+
+		mx := discovered(ProvenanceMX, a.Data, req.Domain, req.Round+1)
+		if !ds.sendOutOfScope(mx) {
+			mx.OutOfScope = true
+			ds.goRequestWork(req, func() { ds.sendOut(mx) })
+		}
+	}
+}
+
+// sendReverseNames queues the names within the domain that were discovered by a PTR lookup
+func (ds *DNSService) sendReverseNames(req *AmassRequest, server string) {
+	ptr := reverseName(req.Address)
+	if ptr == "" {
+		return
+	}
+
+	answers, err := ds.query(ptr, server, "PTR")
+	if err != nil {
+		return
+	}
+
+	for _, a := range answers {
+		name := strings.TrimSuffix(a.Data, ".")
+		if name == req.Name || !validTarget(name) {
+			continue
+		}
+
+		if domain := ds.scopeOf(name, req.Domain); domain != "" {
+			ds.queueName(discovered(ProvenanceReverseDNS, name, domain, req.Round+1))
+		}
+	}
+}
+
+// reverseName returns the name used for the PTR lookup of the address
+func reverseName(addr string) string {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return ""
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa", ip4[3], ip4[2], ip4[1], ip4[0])
+	}
+
+	const hex = "0123456789abcdef"
+	var labels []string
+	for i := len(ip) - 1; i >= 0; i-- {
+		labels = append(labels, string(hex[ip[i]&0xf]), string(hex[ip[i]>>4]))
+	}
+	return strings.Join(labels, ".") + ".ip6.arpa"
+}
+
+// recursiveCNAME follows the CNAME chain, returning the records and the last name in the chain.
+// ErrCNAMELoop is returned when the chain refers back to an earlier name. Chains longer than the
+// maximum depth are truncated, and ErrCNAMEDepth is returned with the name reached at the maximum depth
+func (ds *DNSService) recursiveCNAME(domain, name, server string) ([]recon.DNSAnswer, string, error) {
+	var answers []recon.DNSAnswer
+
+	start := name
+	max := ds.MaxCNAMEDepth()
+	sameDomain := ds.SameDomainCNAME()
+	visited := map[string]struct{}{strings.ToLower(name): struct{}{}}
+	// Recursively resolve the CNAME records
+	for i := 0; ; i++ {
+		a, err := ds.cachedQuery(name, server, "CNAME")
+		if err != nil || len(a) == 0 {
+			break
+		}
+		cname, found := cnameRecord(name, a)
+		if !found {
+			break
+		}
+		// Do not send queries for the garbage in broken zones
+		if !validTarget(cname.Data) {
+			ds.addMalformed(cname)
+			break
+		}
+		if i >= max {
+			log.Printf("%s: stopped following the CNAME chain of %s after %d records", ds, start, max)
+			return answers, name, ErrCNAMEDepth
+		}
+
+		answers = append(answers, cname)
+		// Misconfigured zones can refer back to an earlier name in the chain
+		target := strings.ToLower(strings.TrimSuffix(cname.Data, "."))
+		if _, found := visited[target]; found {
+			return answers, name, ErrCNAMELoop
+		}
+		visited[target] = struct{}{}
+		// Stop following the chain once it leaves the domain, but keep the record
+		if sameDomain && domain != "" && !withinDomain(cname.Data, domain) {
+			break
+		}
+		name = cname.Data
+	}
+	return answers, name, nil
+}
+
+// cnameRecord returns the CNAME record for the name among the answers. When the name is below
+// a DNAME record and the server did not provide the CNAME, it is synthesized from the DNAME
+func cnameRecord(name string, answers []recon.DNSAnswer) (recon.DNSAnswer, bool) {
+	for _, a := range answers {
+		if a.Type == 5 {
+			return a, true
+		}
+	}
+
+	lower := strings.ToLower(strings.TrimSuffix(name, "."))
+	for _, a := range answers {
+		if a.Type != 39 {
+			continue
+		}
+
+		// The DNAME redirects the names below the owner, but not the owner itself
+		owner := strings.ToLower(strings.TrimSuffix(a.Name, "."))
+		if !strings.HasSuffix(lower, "."+owner) {
+			continue
+		}
+		return recon.DNSAnswer{
+			Name: name,
+			Type: 5,
+			TTL:  a.TTL,
+			Data: strings.TrimSuffix(lower, owner) + strings.TrimSuffix(a.Data, "."),
+		}, true
+	}
+
+	if answers[0].Type == 39 {
+		return recon.DNSAnswer{}, false
+	}
+	return answers[0], true
+}
+
+// MaxCNAMEDepth - Returns the maximum number of CNAME records followed for a name
+func (ds *DNSService) MaxCNAMEDepth() int {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.maxCNAMEDepth
+}
+
+// SetMaxCNAMEDepth - Sets the maximum number of CNAME records followed for a name.
+// Longer chains are truncated, the name reached at the maximum depth is resolved and the results are flagged as Truncated
+func (ds *DNSService) SetMaxCNAMEDepth(depth int) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.maxCNAMEDepth = depth
+}
+
+// validTarget checks that the record data is a usable name for further queries
+func validTarget(target string) bool {
+	target = strings.TrimSuffix(target, ".")
+	if target == "" || len(target) > maxNameLen {
+		return false
+	}
+
+	for _, label := range strings.Split(target, ".") {
+		if label == "" || len(label) > maxLabelLen {
+			return false
+		}
+
+		for _, c := range strings.ToLower(label) {
+			// Underscores are permitted for service and DKIM names
+			if !strings.ContainsRune(ldhChars, c) && c != '_' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// validName checks that the input name can be queried, where labels
+// must also not begin or end with a hyphen
+func validName(name string) bool {
+	if !validTarget(name) {
+		return false
+	}
+
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return false
+		}
+	}
+	return true
+}
+
+// MalformedRecords - Returns the CNAME records with empty or invalid targets that stopped a chain
+func (ds *DNSService) MalformedRecords() []recon.DNSAnswer {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return append([]recon.DNSAnswer{}, ds.malformed...)
+}
+
+func (ds *DNSService) addMalformed(record recon.DNSAnswer) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.malformed = append(ds.malformed, record)
+}
+
+// Typed errors describing why a name could not be resolved
+var (
+	ErrNXDOMAIN   = errors.New("The name does not exist (NXDOMAIN)")
+	ErrTimeout    = errors.New("The DNS query timed out")
+	ErrRefused    = errors.New("The DNS server refused the query")
+	ErrNoRecords  = errors.New("The name exists, but has no records of the requested type")
+	ErrTruncated  = errors.New("The DNS response was truncated")
+	ErrServFail   = errors.New("The DNS server failed to complete the query (SERVFAIL)")
+	ErrCanceled   = errors.New("The DNS query was abandoned as the service stopped")
+	ErrCNAMELoop  = errors.New("The CNAME chain refers back to an earlier name")
+	ErrCNAMEDepth = errors.New("The CNAME chain exceeds the maximum depth and was truncated")
+)
+
+// ClassifyError - Maps an error returned by the resolver to one of the typed resolution errors.
+// Errors that do not fall within a known category are returned unchanged
+func ClassifyError(err error) error {
+	if err == nil {
+		return nil
+	}
 
-func init() {
-	usableServers = testPublicServers()
+	switch err {
+	case ErrNXDOMAIN, ErrTimeout, ErrRefused, ErrNoRecords, ErrTruncated, ErrServFail, ErrCanceled,
+		ErrCNAMELoop, ErrCNAMEDepth, ErrCaseMismatch, ErrDryRun, ErrWildcardMatch:
+		return err
+	}
+
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return ErrTimeout
+	}
+
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "nxdomain"):
+		return ErrNXDOMAIN
+	case strings.Contains(msg, "servfail"):
+		return ErrServFail
+	case strings.Contains(msg, "refused"):
+		return ErrRefused
+	case strings.Contains(msg, "timeout"), strings.Contains(msg, "timed out"):
+		return ErrTimeout
+	case strings.Contains(msg, "truncated"):
+		return ErrTruncated
+	case strings.Contains(msg, "0 records"), strings.Contains(msg, "no records"):
+		return ErrNoRecords
+	}
+	return err
 }
 
-/* DNS processing routines */
+// queryError selects the most informative typed error from failed queries for the same name
+func queryError(errs ...error) error {
+	var result error
 
-func testPublicServers() []string {
-	var working []string
+	for _, err := range errs {
+		err = ClassifyError(err)
+		// The name not existing is conclusive
+		if err == ErrNXDOMAIN {
+			return err
+		}
 
-	for _, server := range knownPublicServers {
-		_, err := recon.ResolveDNS("google.com", server, "A")
-		if err == nil {
-			working = append(working, server)
+		if result == nil || result == ErrNoRecords {
+			result = err
 		}
 	}
-	return working
+	return result
 }
 
-func Nameservers() []string {
-	return usableServers
+//--------------------------------------------------------------------------------------------
+// Wildcard detection
+
+// WildcardType - Describes how a subdomain responds to queries for names that do not exist
+type WildcardType int
+
+const (
+	// Queries for unlikely names return NXDOMAIN
+	WildcardNone WildcardType = iota
+
+	// Queries for unlikely names return the same records
+	WildcardAnswers
+
+	// Queries for unlikely names return NOERROR without any records (NODATA)
+	WildcardNoData
+)
+
+type dnsWildcard struct {
+	Type        WildcardType
+	HasWildcard bool
+	Answers     *stringset.StringSet
+
+	// When the entry needs to be re-evaluated, where the zero value never expires
+	Expires time.Time
+
+	// Set for entries provided by LoadWildcards instead of detection
+	Loaded bool
 }
 
-// NextNameserver - Requests the next server from the goroutine
-func NextNameserver() string {
-	num := rand.Int()
-	selection := num % len(usableServers)
+// WildcardChange - Reports the re-evaluation of an expired wildcard cache entry
+type WildcardChange struct {
+	// The subdomain that was re-evaluated
+	Subdomain string
+
+	// The wildcard state before and after the re-evaluation
+	OldType    WildcardType
+	OldAnswers []string
+	NewType    WildcardType
+	NewAnswers []string
 
-	return usableServers[selection]
+	// True when the re-evaluation produced a different result
+	Changed bool
 }
 
-//-------------------------------------------------------------------------------------------
-// DNSService implementation
+func wildcardAnswers(w *dnsWildcard) []string {
+	if w.Answers == nil {
+		return []string{}
+	}
+	return sortedStrings(w.Answers)
+}
 
-type wildcard struct {
-	Req *AmassRequest
-	Ans chan bool
+func wildcardsEqual(first, second *dnsWildcard) bool {
+	if first.Type != second.Type {
+		return false
+	}
+	if first.Answers == nil || second.Answers == nil {
+		return first.Answers == second.Answers
+	}
+	return first.Answers.Equal(second.Answers) && second.Answers.Equal(first.Answers)
 }
 
-type DNSService struct {
-	BaseAmassService
+// wildcardCache holds the results of wildcard detection per subdomain, and
+// coordinates detections in progress so each subdomain is only probed once
+type wildcardCache struct {
+	sync.Mutex
+	entries map[string]*dnsWildcard
 
-	frequency time.Duration
-	// Requests are sent through this channel to check DNS wildcard matches
-	wildcards chan *wildcard
+	// Subdomains currently being probed, closed once the result is cached
+	inflight map[string]chan struct{}
+
+	// Performs the wildcard detection for subdomains not in the cache
+	detect func(sub, root string) *dnsWildcard
+
+	// Returns how long entries remain valid, where zero means they never expire
+	ttl func() time.Duration
+
+	// Called when an expired entry has been re-evaluated
+	onChange func(change *WildcardChange)
+
+	// Called when a wildcard is first detected for a subdomain
+	onDetect func(sub string, entry *dnsWildcard)
 }
 
-func NewDNSService(in, out chan *AmassRequest) *DNSService {
-	ds := &DNSService{
-		frequency: 5 * time.Millisecond,
-		wildcards: make(chan *wildcard, 50),
+func newWildcardCache(detect func(sub, root string) *dnsWildcard) *wildcardCache {
+	return &wildcardCache{
+		entries:  make(map[string]*dnsWildcard),
+		inflight: make(map[string]chan struct{}),
+		detect:   detect,
 	}
+}
 
-	ds.BaseAmassService = *NewBaseAmassService("DNS Service", ds)
+// cached returns the wildcard entry for the subdomain without performing detection,
+// or nil when the subdomain has not been probed or the entry has expired
+func (wc *wildcardCache) cached(sub string) *dnsWildcard {
+	wc.Lock()
+	defer wc.Unlock()
 
-	ds.input = in
-	ds.output = out
-	return ds
+	entry, found := wc.entries[sub]
+	if !found || (!entry.Expires.IsZero() && !time.Now().Before(entry.Expires)) {
+		return nil
+	}
+	return entry
 }
 
-func (ds *DNSService) OnStart() error {
-	ds.BaseAmassService.OnStart()
+// get returns the cached wildcard entry for the subdomain, performing detection if necessary.
+// Concurrent callers for the same uncached subdomain wait for, and share, a single detection
+func (wc *wildcardCache) get(sub, root string) *dnsWildcard {
+	wc.Lock()
+	old, found := wc.entries[sub]
+	if found && (old.Expires.IsZero() || time.Now().Before(old.Expires)) {
+		wc.Unlock()
+		return old
+	}
+	// Check if another goroutine is already performing detection for this subdomain
+	if wait, found := wc.inflight[sub]; found {
+		wc.Unlock()
+		<-wait
+
+		wc.Lock()
+		defer wc.Unlock()
+		return wc.entries[sub]
+	}
+	wait := make(chan struct{})
+	wc.inflight[sub] = wait
+	wc.Unlock()
+
+	entry := wc.detect(sub, root)
+	if wc.ttl != nil {
+		if ttl := wc.ttl(); ttl > 0 {
+			entry.Expires = time.Now().Add(ttl)
+		}
+	}
 
-	go ds.processRequests()
-	go ds.processWildcardMatches()
-	return nil
+	wc.Lock()
+	wc.entries[sub] = entry
+	delete(wc.inflight, sub)
+	wc.Unlock()
+	// Release the goroutines waiting on this detection
+	close(wait)
+
+	if !found && entry.HasWildcard && wc.onDetect != nil {
+		wc.onDetect(sub, entry)
+	}
+
+	if found && wc.onChange != nil {
+		wc.onChange(&WildcardChange{
+			Subdomain:  sub,
+			OldType:    old.Type,
+			OldAnswers: wildcardAnswers(old),
+			NewType:    entry.Type,
+			NewAnswers: wildcardAnswers(entry),
+			Changed:    !wildcardsEqual(old, entry),
+		})
+	}
+	return entry
 }
 
-func (ds *DNSService) OnStop() error {
-	ds.BaseAmassService.OnStop()
-	return nil
+// DNSWildcardMatch - Checks subdomains in the wildcard cache for matches on the IP address
+func (ds *DNSService) dnsWildcardMatch(req *AmassRequest) bool {
+	// The subdomains that have already been probed do not need a worker
+	if match, complete := ds.cachedWildcardMatch(req); complete {
+		return match
+	}
+
+	answer := make(chan bool, 2)
+
+	// The workers are gone once the service has stopped
+	select {
+	case ds.wildcards <- &wildcard{Req: req, Ans: answer}:
+	case <-ds.Quit():
+		return false
+	}
+	// The workers may have stopped after receiving the request, without answering it
+	select {
+	case match := <-answer:
+		return match
+	case <-ds.Quit():
+		return false
+	}
 }
 
-func (ds *DNSService) Frequency() time.Duration {
+// WildcardDetection - Returns true if resolved names are checked against wildcards
+func (ds *DNSService) WildcardDetection() bool {
 	ds.Lock()
 	defer ds.Unlock()
 
-	return ds.frequency
+	return ds.wildcardDetect
 }
 
-func (ds *DNSService) SetFrequency(freq time.Duration) {
+// SetWildcardDetection - Determines if resolved names are checked against wildcards. Disabling
+// the detection avoids the probe queries on zones that are known to not use wildcards
+func (ds *DNSService) SetWildcardDetection(enabled bool) {
 	ds.Lock()
 	defer ds.Unlock()
 
-	ds.frequency = freq
+	ds.wildcardDetect = enabled
 }
 
-func (ds *DNSService) sendOut(req *AmassRequest) {
-	req.Name = trim252F(req.Name)
+// WildcardProbes - Returns the number of unlikely names probed for each subdomain,
+// and how many of them must agree for a wildcard to be detected
+func (ds *DNSService) WildcardProbes() (probes, agreement int) {
+	ds.Lock()
+	defer ds.Unlock()
 
-	ds.Output() <- req
-	ds.SetActive(true)
+	return ds.wildcardProbes, ds.wildcardAgreement
 }
 
-func (ds *DNSService) processRequests() {
-	var queue []*AmassRequest
+// SetWildcardProbes - Sets the number of unlikely names probed for each subdomain, and how many
+// of them must provide overlapping answers for a wildcard to be detected. Requiring fewer than
+// all of them catches wildcards that rotate among a pool of addresses, or that differ by depth
+func (ds *DNSService) SetWildcardProbes(probes, agreement int) {
+	ds.Lock()
+	defer ds.Unlock()
 
-	// Filter for not double-checking subdomain names
-	filter := make(map[string]struct{})
+	if probes < 1 {
+		probes = 1
+	}
+	if agreement < 1 {
+		agreement = 1
+	} else if agreement > probes {
+		agreement = probes
+	}
+	ds.wildcardProbes = probes
+	ds.wildcardAgreement = agreement
+}
 
-	t := time.NewTicker(ds.Frequency())
-	defer t.Stop()
+// MinProbeEntropy - Returns the minimum entropy, in bits, of the labels generated for wildcard probes
+func (ds *DNSService) MinProbeEntropy() float64 {
+	ds.Lock()
+	defer ds.Unlock()
 
-	check := time.NewTicker(5 * time.Second)
-	defer check.Stop()
-loop:
-	for {
-		select {
-		case add := <-ds.Input():
-			add.Name = trim252F(add.Name)
-
-			if _, found := filter[add.Name]; add.Name != "" && !found {
-				filter[add.Name] = struct{}{}
-				queue = append(queue, add)
-				// Mark the service as active
-				ds.BaseAmassService.SetActive(true)
-			}
-		case <-t.C: // Pops a DNS name off the queue for resolution
-			if len(queue) > 0 {
-				next := queue[0]
-				if next.Domain != "" {
-					go ds.performDNSRequest(next)
-				}
-				// Remove the first slice element
-				if len(queue) > 1 {
-					queue = queue[1:]
-				} else {
-					queue = []*AmassRequest{}
-				}
-			}
-		case <-check.C:
-			if len(queue) == 0 {
-				// Mark the service as not active
-				ds.SetActive(false)
-			}
-		case <-ds.Quit():
-			break loop
-		}
-	}
+	return ds.minProbeEntropy
 }
 
-func (ds *DNSService) performDNSRequest(req *AmassRequest) {
-	ds.SetActive(true)
-	answers, err := dnsQuery(req.Domain, req.Name, NextNameserver())
-	if err != nil {
-		return
-	}
-	// Pull the IP address out of the DNS answers
-	ipstr := recon.GetARecordData(answers)
-	if ipstr == "" {
-		return
-	}
-	req.Address = ipstr
+// SetMinProbeEntropy - Sets the minimum entropy, in bits, of the labels generated for wildcard
+// probes. Labels below the threshold are regenerated, so probes are unlikely to collide with real names
+func (ds *DNSService) SetMinProbeEntropy(bits float64) {
+	ds.Lock()
+	defer ds.Unlock()
 
-	match := ds.dnsWildcardMatch(req)
-	// If the name didn't come from a search, check it doesn't match a wildcard IP address
-	if req.Tag != SEARCH && match {
-		return
-	}
-	// Return the successfully resolved names + address
-	for _, record := range answers {
-		if !strings.HasSuffix(record.Name, req.Domain) {
-			continue
-		}
+	ds.minProbeEntropy = bits
+}
 
-		tag := DNS
-		source := "DNS"
-		if record.Name == req.Name {
-			tag = req.Tag
-			source = req.Source
-		}
+// WildcardTTL - Returns how long wildcard detection results are cached
+func (ds *DNSService) WildcardTTL() time.Duration {
+	ds.Lock()
+	defer ds.Unlock()
 
-		go ds.sendOut(&AmassRequest{
-			Name:    record.Name,
-			Domain:  req.Domain,
-			Address: ipstr,
-			Tag:     tag,
-			Source:  source,
-		})
-	}
+	return ds.wildcardTTL
 }
 
-// dnsQuery - Performs the DNS resolution and pulls names out of the errors or answers
-func dnsQuery(domain, name, server string) ([]recon.DNSAnswer, error) {
-	var resolved bool
+// SetWildcardTTL - Sets how long wildcard detection results are cached before
+// the subdomain is probed again, where zero means results never expire
+func (ds *DNSService) SetWildcardTTL(ttl time.Duration) {
+	ds.Lock()
+	defer ds.Unlock()
 
-	answers, name := recursiveCNAME(name, server)
-	// Obtain the DNS answers for the A records related to the name
-	ans, err := recon.ResolveDNS(name, server, "A")
-	if err == nil {
-		answers = append(answers, ans...)
-		resolved = true
-	}
-	// Obtain the DNS answers for the AAAA records related to the name
-	ans, err = recon.ResolveDNS(name, server, "AAAA")
-	if err == nil {
-		answers = append(answers, ans...)
-		resolved = true
-	}
+	ds.wildcardTTL = ttl
+}
 
-	if !resolved {
-		return []recon.DNSAnswer{}, errors.New("No A or AAAA records resolved for the name")
+// SetWildcardChangeOutput - Sets the channel that is notified each time an
+// expired wildcard cache entry is re-evaluated
+func (ds *DNSService) SetWildcardChangeOutput(out chan *WildcardChange) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.wildcardChanges = out
+}
+
+// SetWildcardCallback - Sets the function called once for each subdomain found to have a
+// wildcard, along with the answers provided by the wildcard
+func (ds *DNSService) SetWildcardCallback(callback func(sub string, answers []string)) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.wildcardCallback = callback
+}
+
+func (ds *DNSService) reportWildcard(sub string, entry *dnsWildcard) {
+	ds.Lock()
+	callback := ds.wildcardCallback
+	ds.Unlock()
+
+	if callback != nil {
+		callback(sub, wildcardAnswers(entry))
 	}
-	return answers, nil
 }
 
-func recursiveCNAME(name, server string) ([]recon.DNSAnswer, string) {
-	var answers []recon.DNSAnswer
+func (ds *DNSService) sendWildcardChange(change *WildcardChange) {
+	ds.Lock()
+	out := ds.wildcardChanges
+	ds.Unlock()
 
-	// Recursively resolve the CNAME records
-	for i := 0; i < 10; i++ {
-		a, err := recon.ResolveDNS(name, server, "CNAME")
-		if err != nil {
-			break
+	if out == nil {
+		return
+	}
+
+	ds.goWork(func() {
+		select {
+		case out <- change:
+		case <-ds.Quit():
 		}
+	})
+}
 
-		answers = append(answers, a[0])
-		name = a[0].Data
-	}
-	return answers, name
+// WildcardWorkers - Returns the number of goroutines receiving wildcard match requests
+func (ds *DNSService) WildcardWorkers() int {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.wildcardWorkers
 }
 
-//--------------------------------------------------------------------------------------------
-// Wildcard detection
+// SetWildcardWorkers - Sets the number of goroutines receiving wildcard match requests,
+// and must be called before Start. Values less than one are ignored
+func (ds *DNSService) SetWildcardWorkers(n int) {
+	ds.Lock()
+	defer ds.Unlock()
 
-type dnsWildcard struct {
-	HasWildcard bool
-	Answers     *stringset.StringSet
+	if n > 0 {
+		ds.wildcardWorkers = n
+	}
 }
 
-// DNSWildcardMatch - Checks subdomains in the wildcard cache for matches on the IP address
-func (ds *DNSService) dnsWildcardMatch(req *AmassRequest) bool {
-	answer := make(chan bool, 2)
+// SetWildcardBuffer - Sets the number of wildcard match requests that can wait for a worker
+// before resolved names block, and must be called before Start
+func (ds *DNSService) SetWildcardBuffer(size int) {
+	ds.Lock()
+	defer ds.Unlock()
 
-	ds.wildcards <- &wildcard{
-		Req: req,
-		Ans: answer,
+	if size < 0 {
+		size = 0
 	}
-	return <-answer
+	ds.wildcards = make(chan *wildcard, size)
 }
 
 // Goroutine that keeps track of DNS wildcards discovered
 func (ds *DNSService) processWildcardMatches() {
-	wildcards := make(map[string]*dnsWildcard)
+	wildcards := ds.knownWildcards
 loop:
 	for {
 		select {
 		case req := <-ds.wildcards:
+			// The number of workers bounds the subdomains being probed at the same time
 			r := req.Req
-			req.Ans <- matchesWildcard(r.Name, r.Domain, r.Address, wildcards)
+			addrs := r.Addresses
+			if len(addrs) == 0 {
+				addrs = []string{r.Address}
+			}
+			req.Ans <- matchesWildcard(r.Name, r.Domain, addrs, wildcards)
 		case <-ds.Quit():
 			break loop
 		}
 	}
 }
 
-func matchesWildcard(name, root, ip string, wildcards map[string]*dnsWildcard) bool {
+// matchesWildcard returns true when every address of the name is provided by a wildcard
+func matchesWildcard(name, root string, addrs []string, wildcards *wildcardCache) bool {
 	var answer bool
 
-	base := len(strings.Split(root, "."))
-	// Obtain all parts of the subdomain name
-	labels := strings.Split(name, ".")
-
-	for i := len(labels) - base; i > 0; i-- {
-		sub := strings.Join(labels[i:], ".")
-
+	// The first subdomain evaluated is the root domain, which catches wildcards at the zone apex
+	for _, sub := range wildcardLevels(name, root) {
 		// See if detection has been performed for this subdomain
-		w, found := wildcards[sub]
-		if !found {
-			entry := &dnsWildcard{
-				HasWildcard: false,
-				Answers:     nil,
-			}
-
-			if ss := wildcardDetection(sub, root); ss != nil {
-				entry.HasWildcard = true
-				entry.Answers = ss
-			}
-
-			w = entry
-			wildcards[sub] = w
-		}
+		w := wildcards.get(sub, root)
 		// Check if the subdomain and address in question match a wildcard
-		if w.HasWildcard && w.Answers.Contains(ip) {
+		if w.HasWildcard && w.Answers.ContainsAll(addrs) {
 			answer = true
 		}
 	}
 	return answer
 }
 
-// wildcardDetection detects if a domain returns an IP
-// address for "bad" names, and if so, which address is used
-func wildcardDetection(sub, root string) *stringset.StringSet {
-	var result *stringset.StringSet
+// wildcardDetection detects if a domain returns an IP address or an empty
+// NOERROR response for "bad" names, and if so, which addresses are used
+func (ds *DNSService) wildcardDetection(sub, root string) *dnsWildcard {
+	result := &dnsWildcard{Type: WildcardNone}
+	probes, agreement := ds.WildcardProbes()
 
-	server := NextNameserver()
-	// Three unlikely names will be checked for this subdomain
-	ss1 := checkForWildcard(sub, root, server)
-	if ss1 == nil {
+	server := ds.queryServers(root)[0]
+	// Most subdomains do not have a wildcard, so the first probe is checked alone
+	t1, ss1 := ds.checkForWildcard(sub, root, server, 1)
+	if t1 == WildcardNone && probes-1 < agreement {
 		return result
 	}
-	ss2 := checkForWildcard(sub, root, server)
-	if ss2 == nil {
-		return result
+
+	types := make([]WildcardType, probes)
+	sets := make([]*stringset.StringSet, probes)
+	types[0], sets[0] = t1, ss1
+	// The remaining unlikely names are checked at the same time, alternating their depth
+	var wg sync.WaitGroup
+	for i := 1; i < probes; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			types[i], sets[i] = ds.checkForWildcard(sub, root, server, i%2+1)
+		}(i)
+	}
+	wg.Wait()
+
+	var nodata int
+	var answering []*stringset.StringSet
+	for i, t := range types {
+		switch t {
+		case WildcardNoData:
+			nodata++
+		case WildcardAnswers:
+			if !sets[i].Empty() {
+				answering = append(answering, sets[i])
+			}
+		}
 	}
-	ss3 := checkForWildcard(sub, root, server)
-	if ss3 == nil {
+
+	// Wildcards rotating among a pool of addresses provide overlapping answers
+	if agreeing := overlappingAnswers(answering); len(agreeing) >= agreement {
+		result.Type = WildcardAnswers
+		result.HasWildcard = true
+		result.Answers = stringset.NewStringSet()
+		for _, ss := range agreeing {
+			result.Answers.AddAll(ss.ToStrings())
+		}
 		return result
 	}
-	// If they all provide the same records, we have a wildcard
-	if !ss1.Empty() && (ss1.Equal(ss2) && ss2.Equal(ss3)) {
-		result = ss1
+	// Names that exist without records are a separate category from addressed wildcards
+	if nodata >= agreement {
+		result.Type = WildcardNoData
 	}
 	return result
 }
 
-func checkForWildcard(sub, root, server string) *stringset.StringSet {
-	var ss *stringset.StringSet
+// overlappingAnswers returns the answer sets sharing at least one address with another set
+func overlappingAnswers(sets []*stringset.StringSet) []*stringset.StringSet {
+	var agreeing []*stringset.StringSet
+
+	// A single answer can only agree with itself
+	if len(sets) == 1 {
+		return sets
+	}
+
+	for i, ss := range sets {
+		for j, other := range sets {
+			if i != j && ss.ContainsAny(other.ToStrings()) {
+				agreeing = append(agreeing, ss)
+				break
+			}
+		}
+	}
+	return agreeing
+}
 
-	name := unlikelyName(sub)
-	if name != "" {
-		if ans, err := dnsQuery(root, name, server); err == nil {
-			ss = answersToStringSet(ans)
+// checkForWildcard queries an unlikely name with the number of random labels below the subdomain
+func (ds *DNSService) checkForWildcard(sub, root, server string, depth int) (WildcardType, *stringset.StringSet) {
+	name := sub
+	for i := 0; i < depth; i++ {
+		// Names too long for another label are probed at the depth reached
+		next := ds.probeName(name)
+		if next == "" {
+			break
 		}
+		name = next
 	}
-	return ss
+	if name == sub {
+		// Labels left short by a long subdomain cannot reach the minimum entropy
+		log.Printf("%s: unable to generate a wildcard probe for %s with %.1f bits of entropy",
+			ds, sub, ds.MinProbeEntropy())
+		return WildcardNone, nil
+	}
+
+	ans, err := ds.dnsQuery(root, name, server)
+	if err == ErrNoRecords {
+		return WildcardNoData, nil
+	} else if err != nil && err != ErrCNAMEDepth {
+		return WildcardNone, nil
+	}
+	return WildcardAnswers, answersToStringSet(ans)
+}
+
+// probeName - Generates an unlikely name with a first label meeting the minimum entropy
+func (ds *DNSService) probeName(sub string) string {
+	min := ds.MinProbeEntropy()
+
+	for i := 0; i < maxProbeAttempts; i++ {
+		name := unlikelyName(sub, ds.random())
+		if name == "" {
+			break
+		}
+
+		label := strings.SplitN(name, ".", 2)[0]
+		if labelEntropy(label) >= min {
+			return name
+		}
+	}
+	return ""
+}
+
+// labelEntropy returns the Shannon entropy of the label in total bits
+func labelEntropy(label string) float64 {
+	if label == "" {
+		return 0
+	}
+
+	counts := make(map[rune]int)
+	for _, c := range label {
+		counts[c]++
+	}
+
+	var perChar float64
+	length := float64(len(label))
+	for _, count := range counts {
+		p := float64(count) / length
+		perChar -= p * math.Log2(p)
+	}
+	return perChar * length
 }
 
-func unlikelyName(sub string) string {
+func unlikelyName(sub string, rng *lockedRand) string {
 	var newlabel string
 	ldh := []byte(ldhChars)
 	ldhLen := len(ldh)
 
-	// Determine the max label length
-	l := maxNameLen - len(sub)
+	// Determine the max label length, leaving room for the separating dot
+	l := maxNameLen - len(sub) - 1
 	if l > maxLabelLen {
 		l = maxLabelLen / 2
 	} else if l < 1 {
 		return ""
 	}
 	// Shuffle our LDH characters
-	rand.Shuffle(ldhLen, func(i, j int) {
+	rng.Shuffle(ldhLen, func(i, j int) {
 		ldh[i], ldh[j] = ldh[j], ldh[i]
 	})
 
 	for i := 0; i < l; i++ {
-		sel := rand.Int() % ldhLen
+		sel := rng.Intn(ldhLen)
 
 		// The first nor last char may be a hyphen
 		if (i == 0 || i == l-1) && ldh[sel] == '-' {
@@ -407,11 +2589,42 @@ func unlikelyName(sub string) string {
 		}
 		newlabel = newlabel + string(ldh[sel])
 	}
+	// A skipped character can leave a hyphen at either end
+	newlabel = strings.Trim(newlabel, "-")
 
 	if newlabel == "" {
 		return newlabel
 	}
-	return newlabel + "." + sub
+	// Resolvers reject names exceeding the limits, which would waste the probe
+	name := newlabel + "." + sub
+	if !validName(name) {
+		return ""
+	}
+	return name
+}
+
+// addressSet returns the A and AAAA record data from the answers
+func addressSet(answers []recon.DNSAnswer) *stringset.StringSet {
+	ss := stringset.NewStringSet()
+
+	for _, a := range answers {
+		if a.Type == 1 || a.Type == 28 {
+			ss.Add(a.Data)
+		}
+	}
+	return ss
+}
+
+// minTTL returns the smallest TTL among the answers, which is how long the whole chain remains valid
+func minTTL(answers []recon.DNSAnswer) int {
+	var ttl int
+
+	for i, a := range answers {
+		if i == 0 || a.TTL < ttl {
+			ttl = a.TTL
+		}
+	}
+	return ttl
 }
 
 func answersToStringSet(answers []recon.DNSAnswer) *stringset.StringSet {
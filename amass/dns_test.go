@@ -4,8 +4,20 @@
 package amass
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/caffix/amass/amass/stringset"
 	"github.com/caffix/recon"
 )
 
@@ -19,3 +31,1906 @@ func TestDNSPublicServers(t *testing.T) {
 		}
 	}
 }
+
+// useTestResolver replaces the DNS resolution with the provided function
+// and returns a function that restores the original resolver and servers
+func useTestResolver(fn func(name, server, qtype string) ([]recon.DNSAnswer, error)) func() {
+	origResolve := resolveDNS
+	origServers := usableServers
+	origConfigured := configuredServers
+	origCustom := customServers
+	origMaxFailures := maxServerFailures
+	origCooldown := serverCooldown
+
+	resolveDNS = nil
+	if fn != nil {
+		resolveDNS = func(ctx context.Context, name, server, qtype string) ([]recon.DNSAnswer, error) {
+			return fn(name, server, qtype)
+		}
+	}
+	// The public servers are not checked once the servers have been replaced
+	checkServers.Do(func() {})
+	usableServers = []string{"192.0.2.1:53"}
+	configuredServers = []string{"192.0.2.1:53"}
+	serverFailures = make(map[string]int)
+	serverRefusals = make(map[string]int)
+	serverQuarantine = make(map[string]time.Time)
+	serverLatency = make(map[string]*NameserverStat)
+	return func() {
+		resolveDNS = origResolve
+		usableServers = origServers
+		configuredServers = origConfigured
+		customServers = origCustom
+		maxServerFailures = origMaxFailures
+		serverCooldown = origCooldown
+		serverFailures = make(map[string]int)
+		serverRefusals = make(map[string]int)
+		serverQuarantine = make(map[string]time.Time)
+		serverLatency = make(map[string]*NameserverStat)
+	}
+}
+
+// newTestService returns a service resolving names through the function, with wildcard detection
+// disabled, along with its output channel and a function stopping the service and restoring the resolver
+func newTestService(fn func(name, server, qtype string) ([]recon.DNSAnswer, error)) (*DNSService, chan *AmassRequest, func()) {
+	restore := useTestResolver(fn)
+
+	out := make(chan *AmassRequest, 10)
+	srv := NewDNSService(make(chan *AmassRequest), out)
+	srv.SetWildcardDetection(false)
+	return srv, out, func() {
+		if srv.IsStarted() && !srv.IsStopped() {
+			srv.Stop()
+		}
+		// The goroutines of the service must not use the resolver once it has been restored
+		waitForWork(srv)
+		restore()
+	}
+}
+
+// waitForWork waits for the goroutines performing work for the service to return
+func waitForWork(srv *DNSService) {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		srv.Lock()
+		pending := srv.pending
+		srv.Unlock()
+
+		if pending == 0 {
+			return
+		}
+	}
+}
+
+func testNXDOMAIN(name string) error {
+	return errors.New("DNS query for " + name + " returned error NXDOMAIN")
+}
+
+func testNoRecords(name string) error {
+	return errors.New("DNS query for " + name + " returned 0 records")
+}
+
+func TestWildcardDetectionNXDOMAIN(t *testing.T) {
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		return nil, testNXDOMAIN(name)
+	})()
+
+	w := NewDNSService(nil, nil).wildcardDetection("example.com", "example.com")
+	if w.Type != WildcardNone || w.HasWildcard {
+		t.Errorf("NXDOMAIN responses were classified as wildcard type %d", w.Type)
+	}
+}
+
+func TestWildcardDetectionNoData(t *testing.T) {
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		return nil, testNoRecords(name)
+	})()
+
+	w := NewDNSService(nil, nil).wildcardDetection("example.com", "example.com")
+	if w.Type != WildcardNoData {
+		t.Errorf("NODATA responses were classified as wildcard type %d", w.Type)
+	}
+	if w.HasWildcard {
+		t.Errorf("NODATA responses were treated as an addressed wildcard")
+	}
+}
+
+func TestWildcardDetectionAnswers(t *testing.T) {
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		if qtype != "A" {
+			return nil, testNoRecords(name)
+		}
+		return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "192.0.2.100"}}, nil
+	})()
+
+	w := NewDNSService(nil, nil).wildcardDetection("example.com", "example.com")
+	if w.Type != WildcardAnswers || !w.HasWildcard {
+		t.Errorf("Wildcard answers were classified as wildcard type %d", w.Type)
+	}
+	if !w.Answers.Contains("192.0.2.100") {
+		t.Errorf("The wildcard answers did not include the expected address")
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected error
+	}{
+		{testNXDOMAIN("foo.example.com"), ErrNXDOMAIN},
+		{testNoRecords("foo.example.com"), ErrNoRecords},
+		{errors.New("DNS query for foo.example.com returned error REFUSED"), ErrRefused},
+		{errors.New("DNS query for foo.example.com returned error SERVFAIL"), ErrServFail},
+		{errors.New("read udp 192.0.2.1:53: i/o timeout"), ErrTimeout},
+		{errors.New("dns: response truncated"), ErrTruncated},
+		{ErrTimeout, ErrTimeout},
+		{nil, nil},
+	}
+
+	for _, test := range tests {
+		if err := ClassifyError(test.err); err != test.expected {
+			t.Errorf("ClassifyError(%v) returned %v, expected %v", test.err, err, test.expected)
+		}
+	}
+
+	other := errors.New("something unexpected")
+	if err := ClassifyError(other); err != other {
+		t.Errorf("ClassifyError changed an unknown error into %v", err)
+	}
+}
+
+// conflictResolver answers www.example.com through a CNAME to lb.example.com
+// with a different address than lb.example.com resolves to directly
+func conflictResolver(name, server, qtype string) ([]recon.DNSAnswer, error) {
+	if qtype == "A" {
+		switch name {
+		case "www.example.com":
+			return []recon.DNSAnswer{
+				{Name: "www.example.com", Type: 5, TTL: 60, Data: "lb.example.com"},
+				{Name: "lb.example.com", Type: 1, TTL: 60, Data: "192.0.2.2"},
+			}, nil
+		case "lb.example.com":
+			return []recon.DNSAnswer{{Name: "lb.example.com", Type: 1, TTL: 60, Data: "192.0.2.1"}}, nil
+		}
+		return nil, testNXDOMAIN(name)
+	}
+	return nil, testNoRecords(name)
+}
+
+func collectConflictResults(t *testing.T, policy ConflictPolicy) map[string][]*AmassRequest {
+	srv, out, done := newTestService(conflictResolver)
+	defer done()
+
+	srv.SetConflictPolicy(policy)
+	srv.Start()
+
+	srv.performDNSRequest(&AmassRequest{
+		Name:   "www.example.com",
+		Domain: "example.com",
+		Tag:    SEARCH,
+		Source: "Test",
+	})
+
+	results := make(map[string][]*AmassRequest)
+	timeout := time.After(time.Second)
+loop:
+	for {
+		select {
+		case req := <-out:
+			results[req.Name] = append(results[req.Name], req)
+		case <-timeout:
+			break loop
+		}
+	}
+
+	if len(results["www.example.com"]) == 0 {
+		t.Errorf("The requested name was not returned")
+	}
+	return results
+}
+
+func TestConflictPreferCNAME(t *testing.T) {
+	results := collectConflictResults(t, PreferCNAME)
+
+	lb := results["lb.example.com"]
+	if len(lb) != 1 || lb[0].Address != "192.0.2.2" {
+		t.Errorf("PreferCNAME did not return the address from the CNAME chain")
+	}
+
+	www := results["www.example.com"]
+	if len(www) == 0 || len(www[0].Records) != 2 || www[0].Records[0].Type != 5 {
+		t.Errorf("The result did not carry the records of the CNAME chain")
+	}
+}
+
+func TestConflictPreferDirect(t *testing.T) {
+	results := collectConflictResults(t, PreferDirect)
+
+	lb := results["lb.example.com"]
+	if len(lb) != 1 || lb[0].Address != "192.0.2.1" {
+		t.Errorf("PreferDirect did not return the address from the direct resolution")
+	}
+}
+
+func TestConflictEmitBothFlagged(t *testing.T) {
+	results := collectConflictResults(t, EmitBothFlagged)
+
+	lb := results["lb.example.com"]
+	if len(lb) != 2 {
+		t.Fatalf("EmitBothFlagged returned %d results for the conflicting name", len(lb))
+	}
+
+	addrs := make(map[string]bool)
+	for _, req := range lb {
+		if !req.Conflict {
+			t.Errorf("The result with address %s was not flagged as a conflict", req.Address)
+		}
+		addrs[req.Address] = true
+	}
+	if !addrs["192.0.2.1"] || !addrs["192.0.2.2"] {
+		t.Errorf("EmitBothFlagged did not return both addresses")
+	}
+}
+
+func TestProbeNameEntropy(t *testing.T) {
+	srv := NewDNSService(nil, nil)
+	min := srv.MinProbeEntropy()
+
+	for i := 0; i < 100; i++ {
+		name := srv.probeName("example.com")
+		if name == "" {
+			t.Fatalf("No probe name was generated meeting the minimum entropy of %.1f bits", min)
+		}
+
+		label := strings.SplitN(name, ".", 2)[0]
+		if e := labelEntropy(label); e < min {
+			t.Errorf("The probe label %s has %.1f bits of entropy, below the minimum of %.1f", label, e, min)
+		}
+	}
+}
+
+func TestProbeNameLowEntropy(t *testing.T) {
+	if e := labelEntropy("aaaaaaaa"); e != 0 {
+		t.Errorf("A label with a single repeated character has %.1f bits of entropy", e)
+	}
+
+	srv := NewDNSService(nil, nil)
+	// A threshold no label can meet must not produce a probe name
+	srv.SetMinProbeEntropy(10000)
+	if name := srv.probeName("example.com"); name != "" {
+		t.Errorf("The probe name %s was generated below the minimum entropy", name)
+	}
+}
+
+func TestServFailRetry(t *testing.T) {
+	bad, good := "192.0.2.1:53", "192.0.2.2:53"
+
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		if server == bad {
+			return nil, errors.New("DNS query for " + name + " returned error SERVFAIL")
+		}
+		if qtype == "A" {
+			return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "192.0.2.100"}}, nil
+		}
+		return nil, testNoRecords(name)
+	})()
+	usableServers = []string{bad, good}
+
+	srv := NewDNSService(nil, nil)
+	srv.SetSelectionMode(FallbackSelection)
+	srv.SetFallbackServers([]string{bad})
+	// The same name is resolved again after changing the retries
+	srv.SetCacheTTL(0)
+
+	answers, server, err := srv.resolveName("example.com", "www.example.com")
+	if err != nil {
+		t.Fatalf("The name was not resolved after the SERVFAIL: %v", err)
+	}
+	if server != good {
+		t.Errorf("The name was resolved by %s instead of %s", server, good)
+	}
+	if len(answers) == 0 || answers[0].Data != "192.0.2.100" {
+		t.Errorf("The expected answer was not returned")
+	}
+
+	srv.SetServFailRetries(0)
+	if _, _, err := srv.resolveName("example.com", "www.example.com"); err != ErrServFail {
+		t.Errorf("Disabling the retries returned %v instead of ErrServFail", err)
+	}
+}
+
+func TestMalformedCNAME(t *testing.T) {
+	var queried []string
+
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		queried = append(queried, name)
+
+		switch {
+		case qtype == "CNAME" && name == "www.example.com":
+			return []recon.DNSAnswer{{Name: name, Type: 5, TTL: 60, Data: ""}}, nil
+		case qtype == "A" && name == "www.example.com":
+			return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "192.0.2.100"}}, nil
+		}
+		return nil, testNoRecords(name)
+	})()
+
+	srv := NewDNSService(nil, nil)
+	answers, name, _ := srv.recursiveCNAME("example.com", "www.example.com", "192.0.2.1:53")
+	if name != "www.example.com" {
+		t.Errorf("The chain continued to the malformed target '%s'", name)
+	}
+	if len(answers) != 0 {
+		t.Errorf("The malformed record was returned in the answers")
+	}
+
+	for _, q := range queried {
+		if q == "" {
+			t.Errorf("A query was sent for the empty CNAME target")
+		}
+	}
+
+	malformed := srv.MalformedRecords()
+	if len(malformed) != 1 || malformed[0].Name != "www.example.com" {
+		t.Errorf("The malformed CNAME record was not recorded")
+	}
+}
+
+func TestNextReady(t *testing.T) {
+	now := time.Now()
+	first := &AmassRequest{Name: "a.example.com"}
+	second := &AmassRequest{Name: "b.example.com"}
+	third := &AmassRequest{Name: "c.example.com"}
+	queue := newRequestQueue()
+	queue.PushDelayed(first, 0, now.Add(time.Hour))
+	queue.PushDelayed(second, 0, now.Add(-time.Second))
+	queue.PushDelayed(third, 1, now.Add(time.Minute))
+
+	if queue.Len() != 3 || len(queue.Requests()) != 3 {
+		t.Errorf("The delayed names were not counted as queued")
+	}
+	next, pos, found := queue.Next(now)
+	if !found || next != second {
+		t.Fatalf("The delayed name was selected for dispatch")
+	}
+	queue.Remove(pos)
+
+	if _, _, found := queue.Next(now); found {
+		t.Errorf("A name was selected for dispatch before becoming eligible")
+	}
+	// The names join their priority as they become eligible
+	if next, _, found := queue.Next(now.Add(2 * time.Hour)); !found || next != third {
+		t.Errorf("The eligible names were not dispatched by priority")
+	}
+}
+
+func TestSetNameservers(t *testing.T) {
+	good, bad := "192.0.2.10:53", "192.0.2.11:53"
+
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		if server == bad {
+			return nil, errors.New("DNS query for " + name + " timed out")
+		}
+		return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "192.0.2.100"}}, nil
+	})()
+
+	err := SetNameservers([]string{good, bad, "192.0.2.12"})
+	if err == nil || !strings.Contains(err.Error(), bad) || !strings.Contains(err.Error(), "192.0.2.12") {
+		t.Errorf("The failed nameservers were not reported: %v", err)
+	}
+
+	servers := Nameservers()
+	if len(servers) != 1 || servers[0] != good || NextNameserver() != good {
+		t.Errorf("The nameservers were set to %v", servers)
+	}
+}
+
+func TestMailExchangersSetting(t *testing.T) {
+	var lock sync.Mutex
+	var lookups int
+	srv, _, done := newTestService(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		switch qtype {
+		case "MX":
+			lock.Lock()
+			lookups++
+			lock.Unlock()
+		case "A":
+			return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "192.0.2.1"}}, nil
+		}
+		return nil, testNoRecords(name)
+	})
+	defer done()
+	srv.Start()
+
+	srv.performDNSRequest(&AmassRequest{Name: "www.example.com", Domain: "example.com", Tag: SEARCH})
+	waitForWork(srv)
+	lock.Lock()
+	if lookups != 0 {
+		t.Errorf("%d MX lookups were performed before they were enabled", lookups)
+	}
+	lock.Unlock()
+
+	srv.SetMailExchangers(true)
+	srv.performDNSRequest(&AmassRequest{Name: "ftp.example.com", Domain: "example.com", Tag: SEARCH})
+	waitForWork(srv)
+	lock.Lock()
+	defer lock.Unlock()
+	if lookups != 1 {
+		t.Errorf("%d MX lookups were performed for the resolved name instead of 1", lookups)
+	}
+}
+
+func TestMailExchangers(t *testing.T) {
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		if qtype == "MX" {
+			return []recon.DNSAnswer{
+				{Name: name, Type: 15, TTL: 60, Data: "10 mx1.example.com."},
+				{Name: name, Type: 15, TTL: 60, Data: "20 mx.mailprovider.net."},
+			}, nil
+		}
+		return nil, testNoRecords(name)
+	})()
+
+	out := make(chan *AmassRequest, 10)
+	srv := NewDNSService(nil, out)
+	srv.sendMailExchangers(&AmassRequest{Name: "example.com", Domain: "example.com"}, "192.0.2.1:53")
+
+	select {
+	case req := <-srv.requeue:
+		if req.Name != "mx1.example.com" || req.Source != "MX" || req.OutOfScope {
+			t.Errorf("The in-scope mail exchanger was queued as %+v", req)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("The in-scope mail exchanger was not queued")
+	}
+
+	select {
+	case req := <-out:
+		if req.Name != "mx.mailprovider.net" || !req.OutOfScope {
+			t.Errorf("The out of scope mail exchanger was reported as %+v", req)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("The out of scope mail exchanger was not reported")
+	}
+}
+
+func TestQueryTimeout(t *testing.T) {
+	defer useTestResolver(nil)()
+
+	ended := make(chan struct{}, 10)
+	resolveDNS = func(ctx context.Context, name, server, qtype string) ([]recon.DNSAnswer, error) {
+		defer func() { ended <- struct{}{} }()
+
+		select {
+		case <-time.After(500 * time.Millisecond):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "192.0.2.100"}}, nil
+	}
+
+	srv := NewDNSService(nil, nil)
+	if srv.QueryTimeout() != defaultQueryTimeout {
+		t.Errorf("The query timeout defaulted to %v", srv.QueryTimeout())
+	}
+
+	srv.SetQueryTimeout(50 * time.Millisecond)
+	start := time.Now()
+	if _, err := srv.dnsQuery("example.com", "www.example.com", "192.0.2.1:53"); err != ErrTimeout {
+		t.Errorf("The slow query returned %v instead of ErrTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 400*time.Millisecond {
+		t.Errorf("The queries were not abandoned after the timeout, taking %v", elapsed)
+	}
+
+	// The abandoned queries end with the timeout, well before the resolver would have answered
+	for i := 0; i < srv.Stats().Queries; i++ {
+		select {
+		case <-ended:
+		case <-time.After(250 * time.Millisecond):
+			t.Fatalf("The abandoned query was still running")
+		}
+	}
+}
+
+func TestFallbackServers(t *testing.T) {
+	first, second, third := "192.0.2.1:53", "192.0.2.2:53", "192.0.2.3:53"
+
+	var lock sync.Mutex
+	queried := make(map[string]int)
+	srv, _, done := newTestService(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		lock.Lock()
+		queried[server]++
+		lock.Unlock()
+
+		switch {
+		case server == first && name == "missing.example.com":
+			return nil, testNXDOMAIN(name)
+		case server == first:
+			return nil, ErrTimeout
+		case qtype != "A":
+			return nil, testNoRecords(name)
+		}
+		return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "192.0.2.100"}}, nil
+	})
+	defer done()
+
+	srv.SetFallbackServers([]string{first, second, third})
+	srv.SetSelectionMode(FallbackSelection)
+
+	answers, server, err := srv.resolveName("example.com", "www.example.com")
+	if err != nil || len(answers) == 0 || server != second {
+		t.Errorf("The name was resolved by %s with error %v instead of the second server", server, err)
+	}
+
+	if _, _, err := srv.resolveName("example.com", "missing.example.com"); err != ErrNXDOMAIN {
+		t.Errorf("The missing name returned %v", err)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if queried[third] != 0 {
+		t.Errorf("The third server was queried after an earlier server answered")
+	}
+}
+
+func TestRetryDifferentServer(t *testing.T) {
+	bad, good := "192.0.2.1:53", "192.0.2.2:53"
+
+	var queried []string
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		if qtype == "A" {
+			queried = append(queried, server)
+		}
+		if server == bad {
+			return nil, ErrTimeout
+		}
+		if qtype == "A" {
+			return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "192.0.2.100"}}, nil
+		}
+		return nil, testNoRecords(name)
+	})()
+	usableServers = []string{bad, good}
+
+	srv := NewDNSService(nil, nil)
+	srv.SetSelectionMode(FallbackSelection)
+	srv.SetFallbackServers([]string{bad})
+	// The same name is resolved again after changing the retries
+	srv.SetCacheTTL(0)
+
+	if _, server, err := srv.resolveName("example.com", "www.example.com"); err != nil || server != good {
+		t.Errorf("The name was not resolved by a different server after the timeout: %v", err)
+	}
+
+	queried = nil
+	srv.SetMaxRetries(0)
+	if _, _, err := srv.resolveName("example.com", "www.example.com"); err != ErrTimeout {
+		t.Errorf("Disabling the retries returned %v instead of ErrTimeout", err)
+	}
+	if len(queried) != 1 {
+		t.Errorf("%d servers were queried with the retries disabled", len(queried))
+	}
+}
+
+func TestReverseName(t *testing.T) {
+	tests := map[string]string{
+		"192.0.2.10":  "10.2.0.192.in-addr.arpa",
+		"2001:db8::1": "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa",
+		"invalid":     "",
+	}
+
+	for addr, expected := range tests {
+		if name := reverseName(addr); name != expected {
+			t.Errorf("The reverse name for %s was %s instead of %s", addr, name, expected)
+		}
+	}
+}
+
+func TestReverseDNS(t *testing.T) {
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		if qtype == "PTR" && name == "10.2.0.192.in-addr.arpa" {
+			return []recon.DNSAnswer{
+				{Name: name, Type: 12, TTL: 60, Data: "host1.example.com."},
+				{Name: name, Type: 12, TTL: 60, Data: "host.other.net."},
+			}, nil
+		}
+		return nil, testNoRecords(name)
+	})()
+
+	srv := NewDNSService(nil, nil)
+	srv.sendReverseNames(&AmassRequest{
+		Name:    "www.example.com",
+		Domain:  "example.com",
+		Address: "192.0.2.10",
+	}, "192.0.2.1:53")
+
+	if len(srv.requeue) != 1 {
+		t.Fatalf("%d names were queued instead of the single in-scope name", len(srv.requeue))
+	}
+	if req := <-srv.requeue; req.Name != "host1.example.com" || req.Round != 1 {
+		t.Errorf("The PTR name was queued as %+v", req)
+	}
+}
+
+func TestContextCancellation(t *testing.T) {
+	started, release, finished := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		close(started)
+		<-release
+		close(finished)
+		return nil, testNoRecords(name)
+	})()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	srv := NewDNSServiceWithContext(ctx, make(chan *AmassRequest), nil)
+	srv.SetQueryTimeout(0)
+	srv.Start()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := srv.query("www.example.com", "192.0.2.1:53", "A")
+		done <- err
+	}()
+	<-started
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != ErrCanceled {
+			t.Errorf("The query in progress returned %v instead of ErrCanceled", err)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Errorf("The query in progress was not abandoned after the context was cancelled")
+	}
+
+	// The query gives up on the cancelled context before the service has been stopped
+	for deadline := time.Now().Add(500 * time.Millisecond); !srv.IsStopped() && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if !srv.IsStopped() {
+		t.Errorf("The service was not stopped after the context was cancelled")
+	}
+
+	// The abandoned query must not outlive the test resolver
+	close(release)
+	<-finished
+}
+
+// blockingResolver waits for the context of each query to be cancelled
+type blockingResolver struct {
+	canceled chan struct{}
+}
+
+func (r *blockingResolver) Resolve(name, server, qtype string) ([]recon.DNSAnswer, error) {
+	return r.ResolveContext(context.Background(), name, server, qtype)
+}
+
+func (r *blockingResolver) ResolveContext(ctx context.Context, name, server, qtype string) ([]recon.DNSAnswer, error) {
+	<-ctx.Done()
+	r.canceled <- struct{}{}
+	return nil, ctx.Err()
+}
+
+func TestContextCancelsResolver(t *testing.T) {
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		t.Errorf("The query for %s bypassed the resolver of the service", name)
+		return nil, testNXDOMAIN(name)
+	})()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	srv := NewDNSServiceWithContext(ctx, make(chan *AmassRequest), nil)
+	r := &blockingResolver{canceled: make(chan struct{}, 1)}
+	srv.SetResolver(r)
+	srv.SetQueryTimeout(0)
+
+	done := make(chan struct{})
+	go func() {
+		srv.query("www.example.com", "192.0.2.1:53", "A")
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-r.canceled:
+	case <-time.After(500 * time.Millisecond):
+		t.Errorf("The resolution in progress did not see the cancellation of the context")
+	}
+	<-done
+}
+
+func TestMatchesWildcardAddresses(t *testing.T) {
+	wildcards := newWildcardCache(func(sub, root string) *dnsWildcard {
+		answers := stringset.NewStringSet()
+		answers.AddAll([]string{"192.0.2.1", "192.0.2.2"})
+
+		return &dnsWildcard{Type: WildcardAnswers, HasWildcard: true, Answers: answers}
+	})
+
+	if !matchesWildcard("www.example.com", "example.com", []string{"192.0.2.2", "192.0.2.1"}, wildcards) {
+		t.Errorf("The name with only wildcard addresses was not matched")
+	}
+	if matchesWildcard("lb.example.com", "example.com", []string{"192.0.2.1", "192.0.2.3"}, wildcards) {
+		t.Errorf("The name with an address not provided by the wildcard was matched")
+	}
+}
+
+func TestCNAMELoop(t *testing.T) {
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		if qtype == "CNAME" {
+			return []recon.DNSAnswer{{Name: name, Type: 5, TTL: 60, Data: name + "."}}, nil
+		}
+		return nil, testNoRecords(name)
+	})()
+
+	srv := NewDNSService(nil, nil)
+	if _, err := srv.dnsQuery("example.com", "loop.example.com", "192.0.2.1:53"); err != ErrCNAMELoop {
+		t.Errorf("The self-referential CNAME returned %v instead of ErrCNAMELoop", err)
+	}
+}
+
+func TestSameDomainCNAME(t *testing.T) {
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		if qtype != "CNAME" {
+			return nil, testNoRecords(name)
+		}
+		switch name {
+		case "www.example.com":
+			return []recon.DNSAnswer{{Name: name, Type: 5, TTL: 60, Data: "Edge.Example.COM."}}, nil
+		case "Edge.Example.COM.":
+			return []recon.DNSAnswer{{Name: name, Type: 5, TTL: 60, Data: "edge.notexample.com."}}, nil
+		case "edge.notexample.com.":
+			return []recon.DNSAnswer{{Name: name, Type: 5, TTL: 60, Data: "cdn.provider.net."}}, nil
+		}
+		return nil, testNoRecords(name)
+	})()
+
+	srv := NewDNSService(nil, nil)
+	srv.SetSameDomainCNAME(true)
+
+	answers, name, err := srv.recursiveCNAME("example.com", "www.example.com", "192.0.2.1:53")
+	if err != nil {
+		t.Fatalf("The chain returned %v", err)
+	}
+	// The hop written in another case and with the trailing dot is still within the domain
+	if len(answers) != 2 || name != "Edge.Example.COM." {
+		t.Errorf("The chain stopped at %s after %d records", name, len(answers))
+	}
+}
+
+func TestCNAMEDepth(t *testing.T) {
+	// Each name in the chain has a CNAME to a name with one more label
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		if qtype == "CNAME" {
+			return []recon.DNSAnswer{{Name: name, Type: 5, TTL: 60, Data: "a." + name}}, nil
+		}
+		return nil, testNoRecords(name)
+	})()
+
+	srv := NewDNSService(nil, nil)
+	srv.SetMaxCNAMEDepth(3)
+
+	answers, name, err := srv.recursiveCNAME("example.com", "www.example.com", "192.0.2.1:53")
+	if err != ErrCNAMEDepth {
+		t.Errorf("The long chain returned %v instead of ErrCNAMEDepth", err)
+	}
+	if len(answers) != 3 {
+		t.Errorf("%d CNAME records were followed with a maximum depth of 3", len(answers))
+	}
+	if name != "a.a.a.www.example.com" {
+		t.Errorf("The truncated chain ended with %s", name)
+	}
+}
+
+func TestTruncatedChain(t *testing.T) {
+	// The chain continues beyond the maximum depth, and every name has an address
+	srv, out, done := newTestService(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		switch qtype {
+		case "CNAME":
+			return []recon.DNSAnswer{{Name: name, Type: 5, TTL: 60, Data: "a." + name}}, nil
+		case "A":
+			return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "192.0.2.1"}}, nil
+		}
+		return nil, testNoRecords(name)
+	})
+	defer done()
+
+	srv.SetMaxCNAMEDepth(2)
+	srv.Start()
+
+	srv.performDNSRequest(&AmassRequest{
+		Name:   "www.example.com",
+		Domain: "example.com",
+		Tag:    SEARCH,
+		Source: "Test",
+	})
+	// The names in the chain are also reported
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case req := <-out:
+			if req.Name != "www.example.com" {
+				continue
+			}
+			if !req.Truncated {
+				t.Errorf("The result of the truncated chain was not flagged")
+			}
+			if req.Address != "192.0.2.1" {
+				t.Errorf("The name reached at the maximum depth resolved to %s", req.Address)
+			}
+			return
+		case <-timeout:
+			t.Fatal("The name with the truncated chain was not resolved")
+		}
+	}
+}
+
+func TestResolveName(t *testing.T) {
+	defer useTestResolver(conflictResolver)()
+
+	answers, err := ResolveName("example.com", "www.example.com")
+	if err != nil {
+		t.Fatalf("The name was not resolved: %v", err)
+	}
+	if len(answers) != 2 || answers[1].Data != "192.0.2.2" {
+		t.Errorf("ResolveName returned the answers %v", answers)
+	}
+
+	if _, err := ResolveName("example.com", "missing.example.com"); err != ErrNXDOMAIN {
+		t.Errorf("The missing name returned %v instead of ErrNXDOMAIN", err)
+	}
+}
+
+func TestRecordMode(t *testing.T) {
+	var lock sync.Mutex
+	var types []string
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		lock.Lock()
+		types = append(types, qtype)
+		lock.Unlock()
+
+		switch qtype {
+		case "A":
+			return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "192.0.2.100"}}, nil
+		case "AAAA":
+			return []recon.DNSAnswer{{Name: name, Type: 28, TTL: 60, Data: "2001:db8::100"}}, nil
+		}
+		return nil, testNoRecords(name)
+	})()
+
+	srv := NewDNSService(nil, nil)
+	srv.SetRecordMode(RecordAOnly)
+
+	answers, err := srv.dnsQuery("example.com", "www.example.com", "192.0.2.1:53")
+	if err != nil || len(answers) != 1 || answers[0].Type != 1 {
+		t.Errorf("A-only mode returned the answers %v", answers)
+	}
+	srv.wildcardDetection("example.com", "example.com")
+	for _, qtype := range types {
+		if qtype == "AAAA" {
+			t.Errorf("An AAAA query was sent in A-only mode")
+			break
+		}
+	}
+
+	srv.SetRecordMode(RecordAAAAOnly)
+	answers, err = srv.dnsQuery("example.com", "www.example.com", "192.0.2.1:53")
+	if err != nil || len(answers) != 1 || answers[0].Type != 28 {
+		t.Errorf("AAAA-only mode returned the answers %v", answers)
+	}
+}
+
+func TestApexWildcard(t *testing.T) {
+	// Every name under the apex resolves to the same address
+	srv, out, done := newTestService(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		if qtype == "A" && strings.HasSuffix(name, ".example.com") {
+			return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "192.0.2.50"}}, nil
+		}
+		return nil, testNoRecords(name)
+	})
+	defer done()
+	srv.SetWildcardDetection(true)
+
+	srv.Start()
+
+	srv.performDNSRequest(&AmassRequest{Name: "www.example.com", Domain: "example.com", Tag: BRUTE})
+	select {
+	case req := <-out:
+		t.Errorf("The name %s matching the apex wildcard was not filtered", req.Name)
+	case <-time.After(250 * time.Millisecond):
+	}
+
+	srv.performDNSRequest(&AmassRequest{Name: "www.example.com", Domain: "example.com", Tag: SEARCH})
+	select {
+	case <-out:
+	case <-time.After(time.Second):
+		t.Errorf("The name obtained from a search was filtered by the apex wildcard")
+	}
+
+	if stats := srv.Stats(); stats.Domains["example.com"].WildcardSuppressed != 1 {
+		t.Errorf("The apex wildcard suppression was not counted")
+	}
+}
+
+func TestDeterministicProbeNames(t *testing.T) {
+	first, second := NewDNSService(nil, nil), NewDNSService(nil, nil)
+	first.SetRand(rand.New(rand.NewSource(42)))
+	second.SetRand(rand.New(rand.NewSource(42)))
+
+	for i := 0; i < 5; i++ {
+		name := first.probeName("example.com")
+		if other := second.probeName("example.com"); name != other {
+			t.Errorf("The seeded sources generated %s and %s", name, other)
+		}
+
+		label := strings.TrimSuffix(name, ".example.com")
+		if label == name || label == "" || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			t.Errorf("The probe name %s has an unexpected shape", name)
+		}
+		for _, c := range label {
+			if !strings.ContainsRune(ldhChars, c) {
+				t.Errorf("The probe label %s contains the character %c", label, c)
+			}
+		}
+	}
+}
+
+func TestWildcardCallback(t *testing.T) {
+	var detections int
+	wildcards := newWildcardCache(func(sub, root string) *dnsWildcard {
+		answers := stringset.NewStringSet()
+		answers.Add("192.0.2.50")
+
+		return &dnsWildcard{Type: WildcardAnswers, HasWildcard: true, Answers: answers}
+	})
+
+	var reported []string
+	srv := NewDNSService(nil, nil)
+	srv.SetWildcardCallback(func(sub string, answers []string) {
+		detections++
+		reported = append(reported, sub)
+		if len(answers) != 1 || answers[0] != "192.0.2.50" {
+			t.Errorf("The wildcard was reported with the answers %v", answers)
+		}
+	})
+	wildcards.onDetect = srv.reportWildcard
+
+	for i := 0; i < 3; i++ {
+		matchesWildcard("www.example.com", "example.com", []string{"192.0.2.50"}, wildcards)
+	}
+	if detections != 1 || reported[0] != "example.com" {
+		t.Errorf("The wildcard was reported %d times for %v", detections, reported)
+	}
+}
+
+func TestMaxConcurrency(t *testing.T) {
+	var lock sync.Mutex
+	var active, peak int
+
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		if qtype != "A" || !strings.HasPrefix(name, "host") {
+			return nil, testNoRecords(name)
+		}
+
+		lock.Lock()
+		active++
+		if active > peak {
+			peak = active
+		}
+		lock.Unlock()
+
+		time.Sleep(50 * time.Millisecond)
+
+		lock.Lock()
+		active--
+		lock.Unlock()
+		return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "192.0.2.100"}}, nil
+	})()
+
+	in := make(chan *AmassRequest)
+	out := make(chan *AmassRequest, 50)
+	srv := NewDNSService(in, out)
+	srv.SetFrequency(time.Millisecond)
+	srv.SetMaxConcurrency(3)
+	srv.Start()
+	defer srv.Stop()
+
+	for i := 0; i < 20; i++ {
+		in <- &AmassRequest{Name: fmt.Sprintf("host%d.example.com", i), Domain: "example.com", Tag: SEARCH}
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv.WaitUntilIdle(ctx)
+
+	lock.Lock()
+	defer lock.Unlock()
+	if peak > 3 {
+		t.Errorf("%d names were resolved at the same time with a limit of 3", peak)
+	}
+}
+
+func TestDisableWildcardDetection(t *testing.T) {
+	var queries int
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		queries++
+		return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "192.0.2.50"}}, nil
+	})()
+
+	srv := NewDNSService(nil, nil)
+	if !srv.WildcardDetection() {
+		t.Errorf("Wildcard detection was not enabled by default")
+	}
+
+	srv.SetWildcardDetection(false)
+	req := &AmassRequest{Name: "www.example.com", Domain: "example.com", Address: "192.0.2.50"}
+	if srv.dnsWildcardMatch(req) {
+		t.Errorf("The name matched a wildcard with detection disabled")
+	}
+	if queries != 0 {
+		t.Errorf("%d queries were sent with wildcard detection disabled", queries)
+	}
+}
+
+func TestMinimumTTL(t *testing.T) {
+	srv, out, done := newTestService(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		if qtype == "A" && name == "www.example.com" {
+			return []recon.DNSAnswer{
+				{Name: "www.example.com", Type: 5, TTL: 300, Data: "lb.example.com"},
+				{Name: "lb.example.com", Type: 1, TTL: 30, Data: "192.0.2.1"},
+			}, nil
+		}
+		return nil, testNoRecords(name)
+	})
+	defer done()
+
+	srv.Start()
+
+	srv.performDNSRequest(&AmassRequest{Name: "www.example.com", Domain: "example.com", Tag: SEARCH})
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case req := <-out:
+			if req.Name != "www.example.com" {
+				continue
+			}
+			if req.TTL != 30 {
+				t.Errorf("The result had a TTL of %d instead of the chain minimum", req.TTL)
+			}
+			return
+		case <-timeout:
+			t.Fatalf("The requested name was not returned")
+		}
+	}
+}
+
+func TestValidName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"www.example.com", true},
+		{"www.example.com.", true},
+		{"_dmarc.example.com", true},
+		{"my-host.example.com", true},
+		{strings.Repeat("a", 63) + ".example.com", true},
+		{strings.Repeat("a", 64) + ".example.com", false},
+		{strings.Repeat("a.", 126) + "example.com", false},
+		{"-www.example.com", false},
+		{"www-.example.com", false},
+		{"www..example.com", false},
+		{"www example.com", false},
+		{"w*w.example.com", false},
+	}
+
+	for _, test := range tests {
+		if got := validName(test.name); got != test.valid {
+			t.Errorf("validName(%q) returned %t instead of %t", test.name, got, test.valid)
+		}
+	}
+}
+
+func TestInvalidNamesDropped(t *testing.T) {
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		return nil, testNXDOMAIN(name)
+	})()
+
+	in := make(chan *AmassRequest)
+	srv := NewDNSService(in, make(chan *AmassRequest, 10))
+	srv.Start()
+	defer srv.Stop()
+
+	in <- &AmassRequest{Name: "-bad.example.com", Domain: "example.com"}
+	in <- &AmassRequest{Name: strings.Repeat("a", 64) + ".example.com", Domain: "example.com"}
+	in <- &AmassRequest{Name: "www.example.com", Domain: "example.com"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	srv.WaitUntilIdle(ctx)
+
+	if invalid := srv.Stats().Invalid; invalid != 2 {
+		t.Errorf("%d invalid names were counted instead of 2", invalid)
+	}
+}
+
+func TestDrainOnStop(t *testing.T) {
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		if qtype == "A" {
+			return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "192.0.2.1"}}, nil
+		}
+		return nil, testNoRecords(name)
+	})()
+
+	in := make(chan *AmassRequest)
+	out := make(chan *AmassRequest, 50)
+	srv := NewDNSService(in, out)
+	srv.SetWildcardDetection(false)
+	srv.SetDrainOnStop(true)
+	srv.Start()
+
+	names := 5
+	for i := 0; i < names; i++ {
+		in <- &AmassRequest{Name: fmt.Sprintf("host%d.example.com", i), Domain: "example.com", Tag: SEARCH}
+	}
+	srv.Stop()
+
+	seen := stringset.NewStringSet()
+	timeout := time.After(time.Second)
+loop:
+	for {
+		select {
+		case req := <-out:
+			if strings.HasPrefix(req.Name, "host") {
+				seen.Add(req.Name)
+			}
+		case <-timeout:
+			break loop
+		}
+	}
+	if n := len(seen.ToStrings()); n != names {
+		t.Errorf("Only %d of the %d queued names were resolved before stopping", n, names)
+	}
+}
+
+func TestDrainOnStopPaused(t *testing.T) {
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		if qtype == "A" {
+			return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "192.0.2.1"}}, nil
+		}
+		return nil, testNoRecords(name)
+	})()
+
+	in := make(chan *AmassRequest)
+	out := make(chan *AmassRequest, 50)
+	srv := NewDNSService(in, out)
+	srv.SetWildcardDetection(false)
+	srv.SetDrainOnStop(true)
+	srv.Start()
+	srv.Pause()
+
+	in <- &AmassRequest{Name: "www.example.com", Domain: "example.com", Tag: SEARCH}
+
+	stopped := make(chan struct{})
+	go func() {
+		srv.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Stop did not return while the service was paused")
+	}
+
+	var found bool
+	for len(out) > 0 {
+		if req := <-out; req.Name == "www.example.com" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("The name queued while paused was not resolved before stopping")
+	}
+}
+
+func TestRoundRobinSelection(t *testing.T) {
+	servers := []string{"192.0.2.1:53", "192.0.2.2:53", "192.0.2.3:53"}
+
+	defer useTestResolver(nil)()
+	usableServers = servers
+
+	srv := NewDNSService(nil, nil)
+	srv.SetSelectionMode(RoundRobinSelection)
+
+	counts := make(map[string]int)
+	for i := 0; i < 30; i++ {
+		s := srv.nextNameserver()
+		if expected := servers[i%len(servers)]; s != expected {
+			t.Fatalf("Selection %d returned %s instead of %s", i, s, expected)
+		}
+		counts[s]++
+	}
+	for _, s := range servers {
+		if counts[s] != 10 {
+			t.Errorf("The servers were not selected evenly: %v", counts)
+			break
+		}
+	}
+}
+
+func TestAnsweringServer(t *testing.T) {
+	bad, good := "192.0.2.1:53", "192.0.2.2:53"
+
+	srv, out, done := newTestService(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		if server == bad {
+			return nil, ErrTimeout
+		}
+		if qtype == "A" && name == "www.example.com" {
+			return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "192.0.2.100"}}, nil
+		}
+		return nil, testNoRecords(name)
+	})
+	defer done()
+	usableServers = []string{bad, good}
+
+	srv.SetSelectionMode(FallbackSelection)
+	srv.SetFallbackServers([]string{bad})
+	srv.Start()
+
+	srv.performDNSRequest(&AmassRequest{Name: "www.example.com", Domain: "example.com", Tag: SEARCH})
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case req := <-out:
+			if req.Name != "www.example.com" {
+				continue
+			}
+			if req.Server != good {
+				t.Errorf("The result reported %s instead of the server that answered", req.Server)
+			}
+			return
+		case <-timeout:
+			t.Fatalf("The requested name was not returned")
+		}
+	}
+}
+
+func TestWildcardWorkers(t *testing.T) {
+	probes := func(workers int) int {
+		var lock sync.Mutex
+		var count int
+		defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+			if !strings.HasPrefix(name, "host") {
+				lock.Lock()
+				count++
+				lock.Unlock()
+			}
+			return nil, testNXDOMAIN(name)
+		})()
+
+		srv := NewDNSService(make(chan *AmassRequest), make(chan *AmassRequest, 10))
+		srv.SetWildcardWorkers(workers)
+		srv.SetWildcardBuffer(5)
+		srv.Start()
+		defer srv.Stop()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				srv.dnsWildcardMatch(&AmassRequest{
+					Name:    fmt.Sprintf("host%d.example.com", i),
+					Domain:  "example.com",
+					Address: "192.0.2.1",
+				})
+			}(i)
+		}
+		wg.Wait()
+
+		lock.Lock()
+		defer lock.Unlock()
+		return count
+	}
+
+	if single, several := probes(1), probes(4); single == 0 || several != single {
+		t.Errorf("Four workers sent %d probes, while a single worker sent %d", several, single)
+	}
+}
+
+func TestWildcardWorkersBoundProbes(t *testing.T) {
+	var lock sync.Mutex
+	var active, peak int
+	srv, _, done := newTestService(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		lock.Lock()
+		active++
+		if active > peak {
+			peak = active
+		}
+		lock.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		lock.Lock()
+		active--
+		lock.Unlock()
+		return nil, testNXDOMAIN(name)
+	})
+	defer done()
+
+	srv.SetWildcardDetection(true)
+	srv.SetWildcardWorkers(2)
+	srv.Start()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			srv.dnsWildcardMatch(&AmassRequest{
+				Name:    fmt.Sprintf("www.sub%d.example.com", i),
+				Domain:  "example.com",
+				Address: "192.0.2.1",
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	lock.Lock()
+	defer lock.Unlock()
+	if peak > 2 {
+		t.Errorf("%d probes were sent at the same time by two workers", peak)
+	}
+}
+
+func TestChainIntermediateNames(t *testing.T) {
+	srv, out, done := newTestService(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		switch {
+		case qtype == "CNAME" && name == "a.example.com":
+			return []recon.DNSAnswer{{Name: name, Type: 5, TTL: 60, Data: "b.example.com"}}, nil
+		case qtype == "CNAME" && name == "b.example.com":
+			return []recon.DNSAnswer{{Name: name, Type: 5, TTL: 60, Data: "c.provider.net"}}, nil
+		case qtype == "A" && name == "c.provider.net":
+			return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "203.0.113.5"}}, nil
+		}
+		return nil, testNoRecords(name)
+	})
+	defer done()
+
+	srv.SetRecordMode(RecordAOnly)
+	srv.Start()
+
+	srv.performDNSRequest(&AmassRequest{Name: "a.example.com", Domain: "example.com", Tag: SEARCH})
+
+	results := make(map[string]*AmassRequest)
+	timeout := time.After(500 * time.Millisecond)
+loop:
+	for {
+		select {
+		case req := <-out:
+			results[req.Name] = req
+		case <-timeout:
+			break loop
+		}
+	}
+
+	for _, name := range []string{"a.example.com", "b.example.com"} {
+		if req, found := results[name]; !found || req.Address != "203.0.113.5" {
+			t.Errorf("The in-scope name %s in the CNAME chain was not reported", name)
+		}
+	}
+	if _, found := results["c.provider.net"]; found {
+		t.Errorf("The out of scope target of the CNAME chain was reported")
+	}
+}
+
+func TestExpectedAddress(t *testing.T) {
+	srv, out, done := newTestService(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		if qtype == "A" && name != "gone.example.com" {
+			return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "192.0.2.1"}}, nil
+		}
+		return nil, testNXDOMAIN(name)
+	})
+	defer done()
+	srv.Start()
+
+	expected := map[string]ValidationStatus{
+		"same.example.com":  ValidationMatched,
+		"moved.example.com": ValidationMismatched,
+		"gone.example.com":  ValidationMissing,
+		"www.example.com":   ValidationNone,
+	}
+	for _, req := range []*AmassRequest{
+		{Name: "same.example.com", Domain: "example.com", Expected: "192.0.2.1"},
+		{Name: "moved.example.com", Domain: "example.com", Expected: "192.0.2.2"},
+		{Name: "gone.example.com", Domain: "example.com", Expected: "192.0.2.3"},
+		{Name: "www.example.com", Domain: "example.com"},
+	} {
+		req.Tag = SEARCH
+		srv.performDNSRequest(req)
+	}
+
+	for range expected {
+		select {
+		case req := <-out:
+			if status, found := expected[req.Name]; !found || req.Validation != status {
+				t.Errorf("%s was reported with the validation status %d", req.Name, req.Validation)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Not every name was reported")
+		}
+	}
+}
+
+func TestMaxEmissions(t *testing.T) {
+	// www.example.com -> a.example.com -> b.example.com, which has five addresses
+	emitted := func(max int) map[string]int {
+		srv, out, done := newTestService(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+			switch {
+			case qtype == "CNAME" && name == "www.example.com":
+				return []recon.DNSAnswer{{Name: name, Type: 5, TTL: 60, Data: "a.example.com"}}, nil
+			case qtype == "CNAME" && name == "a.example.com":
+				return []recon.DNSAnswer{{Name: name, Type: 5, TTL: 60, Data: "b.example.com"}}, nil
+			case qtype == "A" && name == "b.example.com":
+				var answers []recon.DNSAnswer
+				for i := 1; i <= 5; i++ {
+					answers = append(answers, recon.DNSAnswer{Name: name, Type: 1, TTL: 60, Data: fmt.Sprintf("192.0.2.%d", i)})
+				}
+				return answers, nil
+			}
+			return nil, testNoRecords(name)
+		})
+		defer done()
+
+		srv.SetMaxEmissions(max)
+		srv.Start()
+		srv.performDNSRequest(&AmassRequest{Name: "www.example.com", Domain: "example.com", Tag: SEARCH})
+
+		names := make(map[string]int)
+		timeout := time.After(200 * time.Millisecond)
+		for {
+			select {
+			case req := <-out:
+				names[req.Name]++
+			case <-timeout:
+				return names
+			}
+		}
+	}
+
+	if names := emitted(2); len(names) != 2 {
+		t.Errorf("%d names were emitted for the name with a limit of 2", len(names))
+	}
+	names := emitted(0)
+	if len(names) != 3 {
+		t.Errorf("%d names were emitted for the chain of three names without a limit", len(names))
+	}
+	// The addresses of a name are carried by a single result
+	for name, n := range names {
+		if n != 1 {
+			t.Errorf("%s was emitted %d times", name, n)
+		}
+	}
+}
+
+func TestMaxRound(t *testing.T) {
+	resolved := func(max int) map[string]int {
+		defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+			switch {
+			case qtype == "NS" && name == "example.com":
+				return []recon.DNSAnswer{{Name: name, Type: 2, TTL: 60, Data: "ns1.example.com."}}, nil
+			case qtype == "A":
+				return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "192.0.2.1"}}, nil
+			}
+			return nil, testNoRecords(name)
+		})()
+
+		in := make(chan *AmassRequest)
+		out := make(chan *AmassRequest, 10)
+		srv := NewDNSService(in, out)
+		srv.SetWildcardDetection(false)
+		srv.SetMaxRound(max)
+		srv.Start()
+		defer func() {
+			srv.Stop()
+			waitForWork(srv)
+		}()
+
+		in <- &AmassRequest{Name: "www.example.com", Domain: "example.com", Tag: SEARCH, Round: 1}
+		in <- &AmassRequest{Name: "deep.example.com", Domain: "example.com", Tag: SEARCH, Round: 2}
+
+		rounds := make(map[string]int)
+		timeout := time.After(500 * time.Millisecond)
+		for {
+			select {
+			case req := <-out:
+				rounds[req.Name] = req.Round
+			case <-timeout:
+				return rounds
+			}
+		}
+	}
+
+	// The nameserver discovered from the first round belongs to the second round
+	rounds := resolved(1)
+	if len(rounds) != 1 || rounds["www.example.com"] != 1 {
+		t.Errorf("The rounds after the limit were resolved: %v", rounds)
+	}
+
+	rounds = resolved(0)
+	if rounds["www.example.com"] != 1 || rounds["deep.example.com"] != 2 || rounds["ns1.example.com"] != 2 {
+		t.Errorf("The names were resolved in the rounds %v", rounds)
+	}
+}
+
+func TestMaxDuration(t *testing.T) {
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		return nil, testNXDOMAIN(name)
+	})()
+
+	in := make(chan *AmassRequest)
+	srv := NewDNSService(in, make(chan *AmassRequest, 10))
+	// The names are dispatched too slowly to finish before the deadline
+	srv.SetFrequency(time.Minute)
+	srv.SetMaxDuration(100 * time.Millisecond)
+	srv.Start()
+	defer srv.Stop()
+
+	for i := 0; i < 3; i++ {
+		in <- &AmassRequest{Name: fmt.Sprintf("host%d.example.com", i), Domain: "example.com"}
+	}
+	if srv.DeadlineExceeded() {
+		t.Errorf("The deadline was reported before it was reached")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := srv.WaitUntilIdle(ctx); err != nil {
+		t.Errorf("The service did not become idle after the deadline: %v", err)
+	}
+	if !srv.DeadlineExceeded() {
+		t.Errorf("The scan did not report ending at the deadline")
+	}
+}
+
+func TestNameFilter(t *testing.T) {
+	var lock sync.Mutex
+	queried := make(map[string]bool)
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		lock.Lock()
+		queried[name] = true
+		lock.Unlock()
+		return nil, testNXDOMAIN(name)
+	})()
+
+	in := make(chan *AmassRequest)
+	srv := NewDNSService(in, make(chan *AmassRequest, 10))
+	srv.SetNameFilter(func(name string) bool {
+		return !strings.Contains(name, "test")
+	})
+	srv.Start()
+	defer srv.Stop()
+
+	in <- &AmassRequest{Name: "test1.example.com", Domain: "example.com"}
+	in <- &AmassRequest{Name: "www.example.com", Domain: "example.com"}
+	// Once this is received, the earlier names have been queued
+	in <- &AmassRequest{Name: "mail.example.com", Domain: "example.com"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	srv.WaitUntilIdle(ctx)
+
+	lock.Lock()
+	defer lock.Unlock()
+	if queried["test1.example.com"] || !queried["www.example.com"] {
+		t.Errorf("The name filter was not applied: %v", queried)
+	}
+	if rejected := srv.Stats().Rejected; rejected != 1 {
+		t.Errorf("%d names were counted as rejected instead of 1", rejected)
+	}
+}
+
+func TestInitNameservers(t *testing.T) {
+	working := knownPublicServers[0]
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		time.Sleep(100 * time.Millisecond)
+		if server != working {
+			return nil, ErrTimeout
+		}
+		return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "192.0.2.1"}}, nil
+	})()
+
+	start := time.Now()
+	if err := InitNameservers(context.Background()); err != nil {
+		t.Fatalf("The public servers were not checked: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Checking %d servers took %v, so they were not checked in parallel", len(knownPublicServers), elapsed)
+	}
+	if servers := Nameservers(); len(servers) != 1 || servers[0] != working {
+		t.Errorf("The servers that failed the check were kept: %v", servers)
+	}
+
+	if servers := configuredServers; len(servers) != len(knownPublicServers) {
+		t.Errorf("The configured servers were not replaced by the public servers: %v", servers)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := InitNameservers(ctx); err != context.Canceled {
+		t.Errorf("The cancelled check returned %v", err)
+	}
+
+	// The servers provided by the user are kept
+	if err := SetNameservers([]string{working}); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitNameservers(context.Background()); err != nil {
+		t.Errorf("The check returned %v", err)
+	}
+	if servers := Nameservers(); len(servers) != 1 || servers[0] != working || len(configuredServers) != 1 {
+		t.Errorf("The provided servers were replaced: %v", servers)
+	}
+}
+
+func TestWildcardDetectionRotating(t *testing.T) {
+	pool := []string{"192.0.2.10", "192.0.2.11", "192.0.2.12"}
+	var lock sync.Mutex
+	var count int
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		if qtype != "A" {
+			return nil, testNoRecords(name)
+		}
+
+		lock.Lock()
+		defer lock.Unlock()
+		// Each answer provides two addresses of the pool, which are never identical twice in a row
+		count++
+		return []recon.DNSAnswer{
+			{Name: name, Type: 1, TTL: 60, Data: pool[count%3]},
+			{Name: name, Type: 1, TTL: 60, Data: pool[(count+1)%3]},
+		}, nil
+	})()
+
+	srv := NewDNSService(nil, nil)
+	srv.SetRecordMode(RecordAOnly)
+	srv.SetWildcardProbes(5, 3)
+	if probes, agreement := srv.WildcardProbes(); probes != 5 || agreement != 3 {
+		t.Errorf("WildcardProbes returned %d and %d instead of 5 and 3", probes, agreement)
+	}
+
+	w := srv.wildcardDetection("example.com", "example.com")
+	if !w.HasWildcard {
+		t.Fatalf("The rotating wildcard was not detected")
+	}
+	if !w.Answers.ContainsAll(pool) {
+		t.Errorf("The wildcard answers did not include the whole pool: %v", w.Answers.ToStrings())
+	}
+}
+
+func TestWildcardDetectionAgreement(t *testing.T) {
+	var lock sync.Mutex
+	var count int
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		// Only two of the probes receive an answer
+		if count++; qtype != "A" || count > 2 {
+			return nil, testNXDOMAIN(name)
+		}
+		return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "192.0.2.100"}}, nil
+	})()
+
+	srv := NewDNSService(nil, nil)
+	srv.SetRecordMode(RecordAOnly)
+	srv.SetWildcardProbes(5, 3)
+	if w := srv.wildcardDetection("example.com", "example.com"); w.HasWildcard {
+		t.Errorf("A wildcard was detected without enough probes agreeing")
+	}
+}
+
+func TestRequestDeadline(t *testing.T) {
+	var lock sync.Mutex
+	var queried []string
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		queried = append(queried, name)
+		return nil, testNXDOMAIN(name)
+	})()
+
+	in := make(chan *AmassRequest)
+	srv := NewDNSService(in, make(chan *AmassRequest, 10))
+	srv.SetWildcardDetection(false)
+	srv.Start()
+	defer srv.Stop()
+
+	in <- &AmassRequest{Name: "stale.example.com", Domain: "example.com", Tag: SEARCH, Deadline: time.Now().Add(-time.Second)}
+	in <- &AmassRequest{Name: "fresh.example.com", Domain: "example.com", Tag: SEARCH, Deadline: time.Now().Add(time.Hour)}
+	// Ensures the earlier names have been added to the queue
+	in <- &AmassRequest{Name: "www.example.com", Domain: "example.com", Tag: SEARCH}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.WaitUntilIdle(ctx); err != nil {
+		t.Fatalf("WaitUntilIdle returned %v", err)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	for _, name := range queried {
+		if name == "stale.example.com" {
+			t.Errorf("The expired request was resolved")
+		}
+	}
+	if len(queried) == 0 {
+		t.Errorf("The requests without an expired deadline were not resolved")
+	}
+	if stats := srv.Stats(); stats.Expired != 1 {
+		t.Errorf("The expired requests were counted %d times instead of once", stats.Expired)
+	}
+}
+
+func TestNameCanonicalizer(t *testing.T) {
+	var lock sync.Mutex
+	queried := make(map[string]int)
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		lock.Lock()
+		if qtype == "CNAME" {
+			queried[name]++
+		}
+		lock.Unlock()
+		return nil, testNXDOMAIN(name)
+	})()
+
+	if name := DefaultCanonicalizer("WWW.Example.COM."); name != "www.example.com" {
+		t.Errorf("DefaultCanonicalizer returned %s", name)
+	}
+
+	in := make(chan *AmassRequest)
+	srv := NewDNSService(in, make(chan *AmassRequest, 10))
+	srv.SetWildcardDetection(false)
+	srv.SetNameCanonicalizer(func(name string) string {
+		name = DefaultCanonicalizer(name)
+		// Stands in for the punycode encoding of IDN names
+		return strings.Replace(name, "bücher", "xn--bcher-kva", 1)
+	})
+	srv.Start()
+	defer srv.Stop()
+
+	for _, name := range []string{"Bücher.example.com.", "bücher.example.com", "xn--bcher-kva.example.com"} {
+		in <- &AmassRequest{Name: name, Domain: "example.com", Tag: SEARCH}
+	}
+	// Once this is received, the earlier names have been queued
+	in <- &AmassRequest{Name: "mail.example.com", Domain: "example.com", Tag: SEARCH}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	srv.WaitUntilIdle(ctx)
+
+	lock.Lock()
+	defer lock.Unlock()
+	if n := queried["xn--bcher-kva.example.com"]; n != 1 {
+		t.Errorf("The variant spellings were resolved %d times instead of once: %v", n, queried)
+	}
+}
+
+func TestUnlikelyNameLimits(t *testing.T) {
+	rng := newLockedRand(nil)
+	label := strings.Repeat("a", 61)
+
+	for _, sub := range []string{
+		"example.com",
+		strings.Repeat(label+".", 3) + "example.com",
+		strings.Repeat(label+".", 3) + strings.Repeat("b", 50) + ".com",
+		strings.Repeat(label+".", 3) + strings.Repeat("b", 54) + ".com",
+		strings.Repeat(label+".", 4) + "com",
+	} {
+		for i := 0; i < 100; i++ {
+			name := unlikelyName(sub, rng)
+			if name == "" {
+				continue
+			}
+			if len(name) > maxNameLen {
+				t.Fatalf("The probe name for a subdomain of %d characters was %d characters", len(sub), len(name))
+			}
+			if !validName(name) {
+				t.Fatalf("The probe name %s was not a valid DNS name", name)
+			}
+		}
+	}
+
+	// No label fits before a subdomain at the limit
+	if name := unlikelyName(strings.Repeat(label+".", 3)+strings.Repeat("b", 62)+".com", rng); name != "" {
+		t.Errorf("A probe name of %d characters was returned", len(name))
+	}
+}
+
+func TestProbeFailureLogged(t *testing.T) {
+	var queries int32
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		atomic.AddInt32(&queries, 1)
+		return nil, testNXDOMAIN(name)
+	})()
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	// Only a few characters remain for the label of the probe
+	sub := strings.Repeat(strings.Repeat("a", 61)+".", 3) + strings.Repeat("b", 57) + ".com"
+	srv := NewDNSService(nil, nil)
+	srv.SetMinProbeEntropy(20)
+
+	if wt, _ := srv.checkForWildcard(sub, "com", "192.0.2.1:53", 1); wt != WildcardNone {
+		t.Errorf("The subdomain was reported with wildcard type %v", wt)
+	}
+	if atomic.LoadInt32(&queries) != 0 {
+		t.Errorf("A query was sent without a probe name")
+	}
+	if !strings.Contains(buf.String(), "unable to generate a wildcard probe") {
+		t.Errorf("The missing probe was not logged: %q", buf.String())
+	}
+}
+
+func TestDNAMESynthesis(t *testing.T) {
+	srv, out, done := newTestService(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		switch {
+		case qtype == "CNAME" && strings.HasSuffix(name, ".old.example.com"):
+			// The server only provides the DNAME for the subtree
+			return []recon.DNSAnswer{{Name: "old.example.com", Type: 39, TTL: 120, Data: "new.example.com."}}, nil
+		case qtype == "A" && name == "www.new.example.com":
+			return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "203.0.113.7"}}, nil
+		}
+		return nil, testNoRecords(name)
+	})
+	defer done()
+
+	srv.SetRecordMode(RecordAOnly)
+
+	answers, err := srv.dnsQuery("example.com", "www.old.example.com", "192.0.2.1:53")
+	if err != nil || recon.GetARecordData(answers) != "203.0.113.7" {
+		t.Fatalf("The name below the DNAME did not resolve: %v", err)
+	}
+	if answers[0].Type != 5 || answers[0].Name != "www.old.example.com" || answers[0].Data != "www.new.example.com" {
+		t.Errorf("The CNAME was synthesized as %+v", answers[0])
+	}
+
+	srv.Start()
+	srv.performDNSRequest(&AmassRequest{Name: "www.old.example.com", Domain: "example.com", Tag: SEARCH})
+
+	results := make(map[string]bool)
+	timeout := time.After(500 * time.Millisecond)
+loop:
+	for {
+		select {
+		case req := <-out:
+			results[req.Name] = true
+		case <-timeout:
+			break loop
+		}
+	}
+	if !results["www.old.example.com"] || !results["www.new.example.com"] {
+		t.Errorf("The names in the synthesized chain were not reported: %v", results)
+	}
+}
+
+func TestResolveVia(t *testing.T) {
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		if qtype != "A" {
+			return nil, testNoRecords(name)
+		}
+		if server == "198.51.100.53:53" {
+			return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "198.51.100.66"}}, nil
+		}
+		return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "192.0.2.100"}}, nil
+	})()
+
+	answers, err := ResolveVia("example.com", "www.example.com", "198.51.100.53:53")
+	if err != nil || recon.GetARecordData(answers) != "198.51.100.66" {
+		t.Errorf("The name was not resolved against the provided server: %v %v", answers, err)
+	}
+	if _, found := NameserverStats()["198.51.100.53:53"]; found {
+		t.Errorf("The query through ResolveVia affected the server selection")
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"errors"
+)
+
+// ErrDryRun - The query was not sent, since the service is performing a dry run
+var ErrDryRun = errors.New("The DNS query was not sent during the dry run")
+
+// DryRun - Returns true if queries are reported instead of being sent
+func (ds *DNSService) DryRun() bool {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.dryRun
+}
+
+// SetDryRun - Causes the queries, including the wildcard probes, to be reported through the dry
+// run callback and counted in the stats instead of being sent. Each query fails with ErrDryRun,
+// and the public servers are not checked before being selected
+func (ds *DNSService) SetDryRun(enabled bool) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.dryRun = enabled
+}
+
+// SetDryRunCallback - Sets the function called with each query that would have been sent
+func (ds *DNSService) SetDryRunCallback(fn func(name, qtype, server string)) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.onDryRun = fn
+}
+
+// simulateQuery reports the query that would have been sent
+func (ds *DNSService) simulateQuery(name, server, qtype string) error {
+	ds.Lock()
+	fn := ds.onDryRun
+	ds.Unlock()
+
+	if fn != nil {
+		fn(name, qtype, server)
+	}
+	ds.stats.queryResult(ErrDryRun)
+	ds.MetricsExporter().AddCounter(MetricQueries, 1, map[string]string{"server": server, "type": qtype})
+	return ErrDryRun
+}
+
+// nameservers returns the servers used by the service. The public servers are not checked
+// during a dry run, since the check sends a query to each of them
+func (ds *DNSService) nameservers() []string {
+	if ds.DryRun() {
+		return currentNameservers()
+	}
+	return Nameservers()
+}
+
+// planWildcardProbes reports the wildcard probes that resolving the name would have sent,
+// once for each subdomain, without storing detection results in the wildcard cache
+func (ds *DNSService) planWildcardProbes(req *AmassRequest, server string) {
+	if !ds.WildcardDetection() || req.Domain == "" {
+		return
+	}
+
+	probes, _ := ds.WildcardProbes()
+	for _, sub := range wildcardLevels(req.Name, req.Domain) {
+		ds.Lock()
+		_, planned := ds.plannedProbes[sub]
+		if !planned {
+			if ds.plannedProbes == nil {
+				ds.plannedProbes = make(map[string]struct{})
+			}
+			ds.plannedProbes[sub] = struct{}{}
+		}
+		ds.Unlock()
+		if planned {
+			continue
+		}
+
+		// The probes alternate their depth like the detection does
+		for i := 0; i < probes; i++ {
+			ds.checkForWildcard(sub, req.Domain, server, i%2+1)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/caffix/recon"
+)
+
+func TestDryRun(t *testing.T) {
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		t.Errorf("The query for %s was sent during the dry run", name)
+		return nil, testNXDOMAIN(name)
+	})()
+
+	m := new(mockResolver)
+	srv := NewDNSService(nil, nil)
+	srv.SetResolver(m)
+	srv.SetRecordMode(RecordAOnly)
+	srv.SetDryRun(true)
+
+	var planned []string
+	srv.SetDryRunCallback(func(name, qtype, server string) {
+		planned = append(planned, name+" "+qtype+" "+server)
+	})
+
+	if _, err := srv.dnsQuery("example.com", "www.example.com", "192.0.2.1:53"); err != ErrDryRun {
+		t.Errorf("The dry run query returned %v", err)
+	}
+	if len(planned) == 0 || planned[len(planned)-1] != "www.example.com A 192.0.2.1:53" {
+		t.Errorf("The callback did not receive the planned query: %v", planned)
+	}
+	if len(m.queries) != 0 {
+		t.Errorf("The resolver received queries during the dry run: %v", m.queries)
+	}
+	if stats := srv.Stats(); stats.Queries != len(planned) || stats.Successes != 0 {
+		t.Errorf("The planned queries was not counted: %+v", stats)
+	}
+}
+
+func TestDryRunWildcardProbes(t *testing.T) {
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		t.Errorf("The query for %s was sent during the dry run", name)
+		return nil, testNXDOMAIN(name)
+	})()
+	// The public servers would be checked when first needed
+	checkServers = sync.Once{}
+	defer checkServers.Do(func() {})
+
+	srv := NewDNSService(nil, nil)
+	srv.SetResolver(new(mockResolver))
+	srv.SetRecordMode(RecordAOnly)
+	srv.SetDryRun(true)
+
+	var probes []string
+	srv.SetDryRunCallback(func(name, qtype, server string) {
+		if qtype == "A" && name != "www.example.com" && strings.HasSuffix(name, ".example.com") {
+			probes = append(probes, name)
+		}
+	})
+
+	srv.performDNSRequest(&AmassRequest{Name: "www.example.com", Domain: "example.com", Tag: BRUTE})
+	if len(probes) == 0 {
+		t.Fatalf("The wildcard probes were not reported through the callback")
+	}
+
+	// The probes of a subdomain are only reported once
+	planned := len(probes)
+	srv.performDNSRequest(&AmassRequest{Name: "ftp.example.com", Domain: "example.com", Tag: BRUTE})
+	for _, name := range probes[planned:] {
+		if name != "ftp.example.com" {
+			t.Errorf("The wildcard probe %s was reported again", name)
+		}
+	}
+	if cached := srv.knownWildcards.cached("example.com"); cached != nil {
+		t.Errorf("The dry run stored a wildcard detection result")
+	}
+}
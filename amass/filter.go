@@ -0,0 +1,119 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"container/list"
+
+	"github.com/caffix/amass/amass/stringset"
+)
+
+// nameFilter tracks the names that have already been seen. When a limit has been set,
+// the least recently seen names are evicted, which bounds the memory used on long scans
+type nameFilter struct {
+	limit int
+	names map[string]*list.Element
+	order *list.List
+}
+
+func newNameFilter(limit int) *nameFilter {
+	return &nameFilter{
+		limit: limit,
+		names: make(map[string]*list.Element),
+		order: list.New(),
+	}
+}
+
+// Contains returns true if the name has been seen, and marks it as recently seen
+func (f *nameFilter) Contains(name string) bool {
+	e, found := f.names[name]
+	if found {
+		f.order.MoveToFront(e)
+	}
+	return found
+}
+
+// Insert adds the name to the filter, evicting the least recently seen name when the filter is full
+func (f *nameFilter) Insert(name string) {
+	if f.Contains(name) {
+		return
+	}
+
+	f.names[name] = f.order.PushFront(name)
+	if f.limit > 0 && f.order.Len() > f.limit {
+		oldest := f.order.Back()
+
+		f.order.Remove(oldest)
+		delete(f.names, oldest.Value.(string))
+	}
+}
+
+// Len returns the number of names in the filter
+func (f *nameFilter) Len() int {
+	return f.order.Len()
+}
+
+// Names returns the names in the filter, from the least recently seen
+func (f *nameFilter) Names() []string {
+	var names []string
+
+	for e := f.order.Back(); e != nil; e = e.Prev() {
+		names = append(names, e.Value.(string))
+	}
+	return names
+}
+
+// FilterLimit - Returns the maximum number of names remembered to avoid resolving them again
+func (ds *DNSService) FilterLimit() int {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.filterLimit
+}
+
+// SetFilterLimit - Sets the maximum number of names remembered to avoid resolving them again,
+// with the least recently seen names forgotten first. Zero means no limit. Must be set before
+// the service is started
+func (ds *DNSService) SetFilterLimit(limit int) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.filterLimit = limit
+}
+
+// SharedFilter - Returns the set of names shared with other services, or nil when there is none
+func (ds *DNSService) SharedFilter() *stringset.StringSet {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.sharedFilter
+}
+
+// SetSharedFilter - Sets a set of names shared by several services, so a name queued by one of
+// them is not resolved again by the others. Each service still remembers the names it has seen,
+// and the shared set is not limited by SetFilterLimit. Must be set before the service is started
+func (ds *DNSService) SetSharedFilter(names *stringset.StringSet) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.sharedFilter = names
+}
+
+// claimName adds the name to the shared filter, returning false when another service already added it
+func (ds *DNSService) claimName(name string) bool {
+	shared := ds.SharedFilter()
+	if shared == nil {
+		return true
+	}
+
+	// The check and the insertion must be atomic across the services
+	shared.Lock()
+	defer shared.Unlock()
+
+	if _, found := shared.Set[name]; found {
+		return false
+	}
+	shared.Set[name] = struct{}{}
+	return true
+}
@@ -0,0 +1,93 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/caffix/amass/amass/stringset"
+	"github.com/caffix/recon"
+)
+
+func TestFilterLimit(t *testing.T) {
+	limit := 100
+	filter := newNameFilter(limit)
+
+	for i := 0; i < 10000; i++ {
+		filter.Insert(fmt.Sprintf("host%d.example.com", i))
+		// Keep one name recently seen, so it is never evicted
+		filter.Contains("host0.example.com")
+	}
+
+	if filter.Len() != limit || len(filter.names) != limit {
+		t.Errorf("The filter grew to %d names with a limit of %d", len(filter.names), limit)
+	}
+	if !filter.Contains("host0.example.com") || !filter.Contains("host9999.example.com") {
+		t.Errorf("The recently seen names were evicted from the filter")
+	}
+	if filter.Contains("host5000.example.com") {
+		t.Errorf("The least recently seen names were not evicted from the filter")
+	}
+
+	unlimited := newNameFilter(0)
+	for i := 0; i < 1000; i++ {
+		unlimited.Insert(fmt.Sprintf("host%d.example.com", i))
+	}
+	if unlimited.Len() != 1000 {
+		t.Errorf("The unlimited filter only kept %d names", unlimited.Len())
+	}
+}
+
+func TestSharedFilter(t *testing.T) {
+	var lock sync.Mutex
+	queried := make(map[string]int)
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		lock.Lock()
+		if qtype == "CNAME" {
+			queried[name]++
+		}
+		lock.Unlock()
+		return nil, testNXDOMAIN(name)
+	})()
+
+	shared := stringset.NewStringSet()
+	var services []*DNSService
+	var inputs []chan *AmassRequest
+	for i := 0; i < 2; i++ {
+		in := make(chan *AmassRequest)
+		srv := NewDNSService(in, make(chan *AmassRequest, 10))
+		srv.SetWildcardDetection(false)
+		srv.SetSharedFilter(shared)
+		srv.Start()
+		defer srv.Stop()
+
+		services = append(services, srv)
+		inputs = append(inputs, in)
+	}
+
+	for i, in := range inputs {
+		in <- &AmassRequest{Name: "www.example.com", Domain: "example.com", Tag: SEARCH}
+		// Once this is received, the earlier name has been queued
+		in <- &AmassRequest{Name: fmt.Sprintf("host%d.example.com", i), Domain: "example.com", Tag: SEARCH}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, srv := range services {
+		srv.WaitUntilIdle(ctx)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if n := queried["www.example.com"]; n != 1 {
+		t.Errorf("The shared name was resolved %d times instead of once", n)
+	}
+	if !shared.Contains("host0.example.com") || !shared.Contains("host1.example.com") {
+		t.Errorf("The names were not added to the shared filter")
+	}
+}
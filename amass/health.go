@@ -0,0 +1,268 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// The default number of consecutive failures that take a server out of rotation
+	defaultMaxServerFailures = 3
+
+	// The number of consecutive REFUSED or SERVFAIL responses that quarantine a server
+	refusalBurst = 3
+)
+
+// Consecutive failures of each server, and the number that takes a server out of rotation,
+// protected by serversLock
+var (
+	serverFailures    = make(map[string]int)
+	maxServerFailures = defaultMaxServerFailures
+)
+
+// Consecutive REFUSED or SERVFAIL responses of each server, when the quarantined servers
+// return to rotation, and how long they are excluded, protected by serversLock
+var (
+	serverRefusals   = make(map[string]int)
+	serverQuarantine = make(map[string]time.Time)
+	serverCooldown   time.Duration
+)
+
+// HealthInterval - Returns the time between checks of the configured servers
+func (ds *DNSService) HealthInterval() time.Duration {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.healthInterval
+}
+
+// SetHealthInterval - Sets the time between checks of the configured servers, where zero
+// disables the checks. The checks are disabled by default, since every configured server is probed
+func (ds *DNSService) SetHealthInterval(interval time.Duration) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.healthInterval = interval
+}
+
+// MaxServerFailures - Returns the number of consecutive failures that take a server out of rotation
+func MaxServerFailures() int {
+	serversLock.RLock()
+	defer serversLock.RUnlock()
+
+	return maxServerFailures
+}
+
+// SetMaxServerFailures - Sets the number of consecutive failures that take a server out of rotation.
+// The servers are shared by every DNSService in the process, and so is the limit
+func SetMaxServerFailures(max int) {
+	serversLock.Lock()
+	defer serversLock.Unlock()
+
+	maxServerFailures = max
+}
+
+// ServerCooldown - Returns how long a server that is refusing queries is excluded from selection
+func ServerCooldown() time.Duration {
+	serversLock.RLock()
+	defer serversLock.RUnlock()
+
+	return serverCooldown
+}
+
+// SetServerCooldown - Sets how long a server is excluded from selection after a burst of REFUSED or
+// SERVFAIL responses, which public resolvers return when they believe they are being abused. The
+// server returns to rotation once the cooldown has passed. Zero disables the quarantine. The servers
+// are shared by every DNSService in the process, and so is the quarantine
+func SetServerCooldown(cooldown time.Duration) {
+	serversLock.Lock()
+	defer serversLock.Unlock()
+
+	serverCooldown = cooldown
+}
+
+// checkServerResponse tracks the failures of the server, since only some errors indicate a problem with the server
+func (ds *DNSService) checkServerResponse(server string, err error) {
+	switch err {
+	case nil, ErrNXDOMAIN, ErrNoRecords, ErrCNAMEDepth:
+		serverSucceeded(server)
+	case ErrTimeout:
+		serverFailed(server)
+	case ErrRefused, ErrServFail:
+		serverRefused(server)
+		serverFailed(server)
+	}
+}
+
+// serverRefused counts the refusal of the server, and quarantines it for the cooldown after a burst
+func serverRefused(server string) {
+	serversLock.Lock()
+	defer serversLock.Unlock()
+
+	serverRefusals[server]++
+	if serverCooldown <= 0 || serverRefusals[server] < refusalBurst {
+		return
+	}
+
+	delete(serverRefusals, server)
+	serverQuarantine[server] = time.Now().Add(serverCooldown)
+}
+
+// quarantined returns true if the server is cooling down after a burst of refusals
+func quarantined(server string) bool {
+	serversLock.RLock()
+	defer serversLock.RUnlock()
+
+	until, found := serverQuarantine[server]
+	return found && time.Now().Before(until)
+}
+
+// withoutQuarantined returns the servers that are not cooling down, or all of them when every server is
+func withoutQuarantined(servers []string) []string {
+	serversLock.RLock()
+	defer serversLock.RUnlock()
+
+	if len(serverQuarantine) == 0 {
+		return servers
+	}
+
+	now := time.Now()
+	var available []string
+	for _, s := range servers {
+		if until, found := serverQuarantine[s]; found && now.Before(until) {
+			continue
+		}
+		available = append(available, s)
+	}
+	if len(available) == 0 {
+		return servers
+	}
+	return available
+}
+
+// serverSucceeded resets the failures of the server, and returns it to rotation
+func serverSucceeded(server string) {
+	// Avoid the write lock in the common case of a healthy server
+	serversLock.RLock()
+	_, failing := serverFailures[server]
+	_, refusing := serverRefusals[server]
+	_, quarantined := serverQuarantine[server]
+	healthy := !failing && !refusing && !quarantined && containsServer(usableServers, server)
+	serversLock.RUnlock()
+	if healthy {
+		return
+	}
+
+	serversLock.Lock()
+	defer serversLock.Unlock()
+
+	delete(serverFailures, server)
+	delete(serverRefusals, server)
+	// The cooldown has passed once the server is answering again
+	if until, found := serverQuarantine[server]; found && time.Now().After(until) {
+		delete(serverQuarantine, server)
+	}
+	if !containsServer(usableServers, server) && containsServer(configuredServers, server) {
+		usableServers = append(usableServers, server)
+	}
+}
+
+// serverFailed counts the failure of the server, and takes it out of rotation after too many
+func serverFailed(server string) {
+	serversLock.Lock()
+	defer serversLock.Unlock()
+
+	serverFailures[server]++
+	if maxServerFailures <= 0 || serverFailures[server] < maxServerFailures {
+		return
+	}
+
+	for i, s := range usableServers {
+		// Keep at least one server in rotation
+		if s == server && len(usableServers) > 1 {
+			usableServers = append(usableServers[:i:i], usableServers[i+1:]...)
+			break
+		}
+	}
+}
+
+func containsServer(servers []string, server string) bool {
+	for _, s := range servers {
+		if s == server {
+			return true
+		}
+	}
+	return false
+}
+
+// Goroutine that periodically checks the configured servers, removing
+// servers that fail repeatedly and returning servers that have recovered
+func (ds *DNSService) processHealthChecks() {
+	interval := ds.HealthInterval()
+	if interval <= 0 {
+		return
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+loop:
+	for {
+		select {
+		case <-t.C:
+			ds.checkServers()
+		case <-ds.Quit():
+			break loop
+		}
+	}
+}
+
+// checkServers probes the configured servers through the resolver, bypassing the service
+// statistics, the metrics and the dry run, since the probes are not part of the enumeration
+func (ds *DNSService) checkServers() {
+	serversLock.RLock()
+	servers := append([]string{}, configuredServers...)
+	serversLock.RUnlock()
+
+	// The probes in progress are abandoned once the service stops
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-ds.Quit():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	r := ds.Resolver()
+	ok := make([]bool, len(servers))
+	var wg sync.WaitGroup
+	for i, server := range servers {
+		wg.Add(1)
+		go func(i int, server string) {
+			defer wg.Done()
+
+			pctx, cancel := context.WithTimeout(ctx, defaultProbeTimeout)
+			defer cancel()
+
+			_, err := resolveWith(pctx, r, "google.com", server, "A")
+			ok[i] = err == nil && pctx.Err() == nil
+		}(i, server)
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return
+	}
+	for i, server := range servers {
+		if ok[i] {
+			serverSucceeded(server)
+		} else {
+			serverFailed(server)
+		}
+	}
+}
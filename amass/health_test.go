@@ -0,0 +1,98 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"testing"
+	"time"
+
+	"github.com/caffix/recon"
+)
+
+func TestServerHealth(t *testing.T) {
+	good, bad := "192.0.2.1:53", "192.0.2.2:53"
+
+	down := true
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		if server == bad && down {
+			return nil, ErrTimeout
+		}
+		return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "192.0.2.100"}}, nil
+	})()
+	usableServers = []string{good, bad}
+	configuredServers = []string{good, bad}
+
+	srv := NewDNSService(nil, nil)
+	SetMaxServerFailures(2)
+	// The servers are only probed periodically when requested
+	if interval := srv.HealthInterval(); interval != 0 {
+		t.Errorf("The servers are checked every %v by default", interval)
+	}
+
+	srv.checkServers()
+	if len(Nameservers()) != 2 {
+		t.Errorf("The server was removed before reaching the failure limit")
+	}
+	srv.checkServers()
+	if servers := Nameservers(); len(servers) != 1 || servers[0] != good {
+		t.Errorf("The failing server was not removed: %v", servers)
+	}
+
+	down = false
+	srv.checkServers()
+	if len(Nameservers()) != 2 {
+		t.Errorf("The recovered server was not returned to rotation")
+	}
+}
+
+func TestServerCooldown(t *testing.T) {
+	throttled, healthy := "192.0.2.1:53", "192.0.2.2:53"
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		return nil, testNXDOMAIN(name)
+	})()
+	usableServers = []string{throttled, healthy}
+	configuredServers = []string{throttled, healthy}
+
+	srv := NewDNSService(nil, nil)
+	SetMaxServerFailures(0)
+	SetServerCooldown(200 * time.Millisecond)
+	for i := 0; i < refusalBurst; i++ {
+		srv.checkServerResponse(throttled, ErrRefused)
+	}
+
+	for i := 0; i < 20; i++ {
+		if server := srv.nextNameserver(); server == throttled {
+			t.Fatalf("The quarantined server was selected")
+		}
+	}
+
+	time.Sleep(250 * time.Millisecond)
+	var selected bool
+	for i := 0; i < 100 && !selected; i++ {
+		selected = srv.nextNameserver() == throttled
+	}
+	if !selected {
+		t.Errorf("The server did not return to rotation after the cooldown")
+	}
+}
+
+func TestServerHealthBypassesService(t *testing.T) {
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "192.0.2.100"}}, nil
+	})()
+	usableServers = []string{"192.0.2.1:53", "192.0.2.2:53"}
+	configuredServers = []string{"192.0.2.1:53", "192.0.2.2:53"}
+
+	srv := NewDNSService(nil, nil)
+	srv.SetDryRun(true)
+	SetMaxServerFailures(1)
+
+	srv.checkServers()
+	if len(Nameservers()) != 2 {
+		t.Errorf("The servers were removed by the checks performed during a dry run")
+	}
+	if queries := srv.Stats().Queries; queries != 0 {
+		t.Errorf("The checks were counted as %d queries of the service", queries)
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"time"
+)
+
+// SetHeartbeat - Sets the function called at each interval with a snapshot of the counters and the
+// queue depth, which can drive a progress display without polling Stats. This must be called before
+// Start, and a zero interval or nil function disables the heartbeat
+func (ds *DNSService) SetHeartbeat(interval time.Duration, fn func(*DNSStats)) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.heartbeatInterval = interval
+	ds.heartbeat = fn
+}
+
+func (ds *DNSService) processHeartbeat() {
+	ds.Lock()
+	interval, fn := ds.heartbeatInterval, ds.heartbeat
+	ds.Unlock()
+
+	if interval <= 0 || fn == nil {
+		return
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+loop:
+	for {
+		select {
+		case <-t.C:
+			fn(ds.Stats())
+		case <-ds.Quit():
+			break loop
+		}
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHeartbeat(t *testing.T) {
+	beats := make(chan *DNSStats, 10)
+	srv := NewDNSService(make(chan *AmassRequest), make(chan *AmassRequest, 10))
+	srv.SetHeartbeat(20*time.Millisecond, func(stats *DNSStats) {
+		select {
+		case beats <- stats:
+		default:
+		}
+	})
+	srv.Start()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case stats := <-beats:
+			if stats == nil || stats.Domains == nil {
+				t.Errorf("The heartbeat did not provide the counters")
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Only %d heartbeats were received", i)
+		}
+	}
+
+	srv.Stop()
+	// Allow a heartbeat that was already firing to finish
+	time.Sleep(50 * time.Millisecond)
+	for len(beats) > 0 {
+		<-beats
+	}
+	select {
+	case <-beats:
+		t.Errorf("The heartbeat continued after the service stopped")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
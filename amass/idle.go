@@ -0,0 +1,84 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"context"
+	"time"
+)
+
+// How often WaitUntilIdle checks the state of the service
+const idleCheckInterval = 50 * time.Millisecond
+
+// trackWork adjusts the number of outstanding goroutines performing work for the service
+func (ds *DNSService) trackWork(delta int) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.pending += delta
+}
+
+// goWork runs the function in a goroutine that is tracked until it returns
+func (ds *DNSService) goWork(fn func()) {
+	ds.trackWork(1)
+
+	go func() {
+		defer ds.trackWork(-1)
+
+		fn()
+	}()
+}
+
+// setQueued records the number of names waiting in the queue
+func (ds *DNSService) setQueued(n int) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.queued = n
+}
+
+// QueueDepth - Returns the number of names waiting in the queue to be resolved. Producers
+// can use it to throttle their input, so they do not outrun the resolution
+func (ds *DNSService) QueueDepth() int {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.queued
+}
+
+// InputBufferUsed - Returns the number of requests waiting in the input channel and its capacity.
+// A full buffer indicates that the service is not keeping up with the input
+func (ds *DNSService) InputBufferUsed() (used, capacity int) {
+	in := ds.Input()
+
+	return len(in), cap(in)
+}
+
+func (ds *DNSService) isIdle() bool {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.queued == 0 && ds.pending == 0
+}
+
+// WaitUntilIdle - Blocks until the queue is empty and no names are being resolved,
+// returning early with the error of the context or ErrCanceled if the service stops
+func (ds *DNSService) WaitUntilIdle(ctx context.Context) error {
+	t := time.NewTicker(idleCheckInterval)
+	defer t.Stop()
+
+	for {
+		if ds.isIdle() {
+			return nil
+		}
+
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ds.Quit():
+			return ErrCanceled
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/caffix/recon"
+)
+
+func TestWaitUntilIdle(t *testing.T) {
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		time.Sleep(200 * time.Millisecond)
+		if qtype == "A" {
+			return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "192.0.2.100"}}, nil
+		}
+		return nil, testNoRecords(name)
+	})()
+
+	in := make(chan *AmassRequest)
+	out := make(chan *AmassRequest, 10)
+	srv := NewDNSService(in, out)
+	srv.Start()
+	defer srv.Stop()
+
+	for _, name := range []string{"a.example.com", "b.example.com", "c.example.com"} {
+		in <- &AmassRequest{Name: name, Domain: "example.com", Tag: SEARCH}
+	}
+	// Allow the last name to be added to the queue
+	time.Sleep(20 * time.Millisecond)
+	if srv.isIdle() {
+		t.Errorf("The service was idle while resolving the names")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := srv.WaitUntilIdle(ctx); err != nil {
+		t.Fatalf("WaitUntilIdle returned %v", err)
+	}
+	// The results are delivered asynchronously
+	for i := 0; i < 3; i++ {
+		select {
+		case <-out:
+		case <-time.After(100 * time.Millisecond):
+			t.Fatalf("The service became idle with %d of the 3 names resolved", i)
+		}
+	}
+}
+
+func TestQueueDepth(t *testing.T) {
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		return nil, testNXDOMAIN(name)
+	})()
+
+	in := make(chan *AmassRequest, 10)
+	out := make(chan *AmassRequest, 10)
+	srv := NewDNSService(in, out)
+	// Nothing is dispatched from the queue during the test
+	srv.SetFrequency(time.Hour)
+
+	names := []string{"a.example.com", "b.example.com", "c.example.com"}
+	for _, name := range names {
+		in <- &AmassRequest{Name: name, Domain: "example.com", Tag: SEARCH}
+	}
+	if used, capacity := srv.InputBufferUsed(); used != 3 || capacity != 10 {
+		t.Errorf("InputBufferUsed returned %d of %d instead of 3 of 10", used, capacity)
+	}
+
+	srv.Start()
+	defer srv.Stop()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for srv.QueueDepth() != len(names) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if depth := srv.QueueDepth(); depth != len(names) {
+		t.Errorf("QueueDepth returned %d instead of %d", depth, len(names))
+	}
+	if used, _ := srv.InputBufferUsed(); used != 0 {
+		t.Errorf("The input buffer still held %d requests", used)
+	}
+}
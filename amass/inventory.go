@@ -0,0 +1,92 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"bytes"
+	"net"
+	"sort"
+	"sync"
+)
+
+// AddressEntry - Summarizes the names discovered on a single IP address
+type AddressEntry struct {
+	// The unique IP address
+	Address string
+
+	// The first name that resolved to the address
+	FirstName string
+
+	// The number of unique names that resolved to the address
+	NumNames int
+}
+
+type addressIndex struct {
+	sync.Mutex
+	entries map[string]*addressNames
+}
+
+type addressNames struct {
+	first string
+	names map[string]struct{}
+}
+
+func newAddressIndex() *addressIndex {
+	return &addressIndex{entries: make(map[string]*addressNames)}
+}
+
+// Insert records that the name resolved to the address
+func (ai *addressIndex) Insert(addr, name string) {
+	if addr == "" || name == "" {
+		return
+	}
+
+	ai.Lock()
+	defer ai.Unlock()
+
+	entry, found := ai.entries[addr]
+	if !found {
+		entry = &addressNames{
+			first: name,
+			names: make(map[string]struct{}),
+		}
+		ai.entries[addr] = entry
+	}
+	entry.names[name] = struct{}{}
+}
+
+// Inventory returns the entries sorted by IP address
+func (ai *addressIndex) Inventory() []*AddressEntry {
+	var result []*AddressEntry
+
+	ai.Lock()
+	for addr, entry := range ai.entries {
+		result = append(result, &AddressEntry{
+			Address:   addr,
+			FirstName: entry.first,
+			NumNames:  len(entry.names),
+		})
+	}
+	ai.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		return compareAddresses(result[i].Address, result[j].Address) < 0
+	})
+	return result
+}
+
+// compareAddresses orders IP addresses numerically, with unparsable addresses compared as strings
+func compareAddresses(a, b string) int {
+	ipa, ipb := net.ParseIP(a), net.ParseIP(b)
+	if ipa == nil || ipb == nil {
+		return bytes.Compare([]byte(a), []byte(b))
+	}
+	return bytes.Compare(ipa.To16(), ipb.To16())
+}
+
+// AddressInventory - Returns every unique address discovered by the service,
+// along with the first name that resolved to it and the number of names sharing it
+func (ds *DNSService) AddressInventory() []*AddressEntry {
+	return ds.addresses.Inventory()
+}
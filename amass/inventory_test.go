@@ -0,0 +1,49 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"testing"
+	"time"
+
+	"github.com/caffix/recon"
+)
+
+func TestAddressInventory(t *testing.T) {
+	srv, out, done := newTestService(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		if qtype != "A" {
+			return nil, testNoRecords(name)
+		}
+
+		addr := "192.0.2.10"
+		if name == "mail.example.com" {
+			addr = "192.0.2.9"
+		}
+		return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: addr}}, nil
+	})
+	defer done()
+	srv.Start()
+
+	for _, name := range []string{"www.example.com", "api.example.com", "mail.example.com", "www.example.com"} {
+		srv.performDNSRequest(&AmassRequest{Name: name, Domain: "example.com", Tag: SEARCH})
+		// The result is delivered before the next name is resolved, so the first names are known
+		select {
+		case <-out:
+		case <-time.After(time.Second):
+			t.Fatalf("%s was not resolved", name)
+		}
+	}
+
+	inventory := srv.AddressInventory()
+	if len(inventory) != 2 {
+		t.Fatalf("The inventory contained %d addresses instead of 2", len(inventory))
+	}
+	// The entries are sorted by address
+	if e := inventory[0]; e.Address != "192.0.2.9" || e.FirstName != "mail.example.com" || e.NumNames != 1 {
+		t.Errorf("The first entry was %+v", e)
+	}
+	if e := inventory[1]; e.Address != "192.0.2.10" || e.FirstName != "www.example.com" || e.NumNames != 2 {
+		t.Errorf("The second entry was %+v", e)
+	}
+}
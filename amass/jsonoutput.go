@@ -0,0 +1,171 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// The names used for the validation outcomes in JSON results
+var validationNames = map[ValidationStatus]string{
+	ValidationMatched:    "matched",
+	ValidationMismatched: "mismatched",
+	ValidationMissing:    "missing",
+}
+
+// The names used for the discovery methods in JSON results
+var provenanceNames = map[Provenance]string{
+	ProvenanceSearch:     "search",
+	ProvenanceBruteForce: "brute_force",
+	ProvenanceAlteration: "alteration",
+	ProvenanceNgram:      "ngram",
+	ProvenanceArchive:    "archive",
+	ProvenanceBuiltin:    "builtin",
+	ProvenanceCNAME:      "cname",
+	ProvenanceMX:         "mx",
+	ProvenanceReverseDNS: "reverse_dns",
+	ProvenanceNS:         "ns",
+	ProvenanceSPF:        "spf",
+	ProvenanceSRV:        "srv",
+}
+
+// JSONRecord - A DNS answer in the JSON result schema
+type JSONRecord struct {
+	Name string `json:"name"`
+	Type int    `json:"type"`
+	TTL  int    `json:"ttl"`
+	Data string `json:"data"`
+}
+
+// JSONChainHop - A name followed through the CNAME chain in the JSON result schema
+type JSONChainHop struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// JSONSOA - A start of authority in the JSON result schema
+type JSONSOA struct {
+	Zone      string `json:"zone"`
+	PrimaryNS string `json:"primary_ns"`
+	Contact   string `json:"contact,omitempty"`
+	Serial    uint32 `json:"serial,omitempty"`
+}
+
+// JSONResult - The stable schema used when writing an AmassRequest as JSON
+type JSONResult struct {
+	Name       string         `json:"name"`
+	Domain     string         `json:"domain"`
+	Address    string         `json:"address,omitempty"`
+	Addresses  []string       `json:"addresses,omitempty"`
+	Netblock   string         `json:"netblock,omitempty"`
+	ASN        int            `json:"asn,omitempty"`
+	ISP        string         `json:"isp,omitempty"`
+	Tag        string         `json:"tag,omitempty"`
+	Source     string         `json:"source,omitempty"`
+	Method     string         `json:"method,omitempty"`
+	Round      int            `json:"round"`
+	TTL        int            `json:"ttl,omitempty"`
+	Server     string         `json:"server,omitempty"`
+	OutOfScope bool           `json:"out_of_scope,omitempty"`
+	Conflict   bool           `json:"conflict,omitempty"`
+	Truncated  bool           `json:"truncated,omitempty"`
+	Expected   string         `json:"expected,omitempty"`
+	Validation string         `json:"validation,omitempty"`
+	Transports []string       `json:"transports,omitempty"`
+	Records    []JSONRecord   `json:"records,omitempty"`
+	Chain      []JSONChainHop `json:"chain,omitempty"`
+	TXT        []string       `json:"txt,omitempty"`
+	SOA        *JSONSOA       `json:"soa,omitempty"`
+
+	// The answers of the recursive and authoritative servers, when they differed
+	Recursive     []string `json:"recursive,omitempty"`
+	Authoritative []string `json:"authoritative,omitempty"`
+
+	// The target of a dangling CNAME record, and the takeover-prone provider hosting it
+	DanglingTarget   string `json:"dangling_target,omitempty"`
+	TakeoverProvider string `json:"takeover_provider,omitempty"`
+
+	// Set when the name was emitted before the wildcard detection completed, and may be retracted
+	Provisional bool `json:"provisional,omitempty"`
+}
+
+// NewJSONResult - Converts the request into the stable JSON result schema
+func NewJSONResult(req *AmassRequest) *JSONResult {
+	r := &JSONResult{
+		Name:       req.Name,
+		Domain:     req.Domain,
+		Address:    req.Address,
+		Addresses:  req.Addresses,
+		ASN:        req.ASN,
+		ISP:        req.ISP,
+		Tag:        req.Tag,
+		Source:     req.Source,
+		Method:     provenanceNames[provenanceOf(req)],
+		Round:      req.Round,
+		TTL:        req.TTL,
+		Server:     req.Server,
+		OutOfScope: req.OutOfScope,
+		Conflict:   req.Conflict,
+		Truncated:  req.Truncated,
+		Expected:   req.Expected,
+		Validation: validationNames[req.Validation],
+		Transports: req.Transports,
+		TXT:        req.TXT,
+
+		Provisional: req.Provisional,
+	}
+
+	if req.Netblock != nil {
+		r.Netblock = req.Netblock.String()
+	}
+	for _, a := range req.Records {
+		r.Records = append(r.Records, JSONRecord{Name: a.Name, Type: a.Type, TTL: a.TTL, Data: a.Data})
+	}
+	for _, hop := range req.Chain {
+		r.Chain = append(r.Chain, JSONChainHop{Name: hop.Name, Type: hop.Type})
+	}
+	if soa := req.SOA; soa != nil {
+		r.SOA = &JSONSOA{Zone: soa.Zone, PrimaryNS: soa.PrimaryNS, Contact: soa.Contact, Serial: soa.Serial}
+	}
+	if d := req.Discrepancy; d != nil {
+		r.Recursive = d.Recursive
+		r.Authoritative = d.Authoritative
+	}
+	if d := req.Dangling; d != nil {
+		r.DanglingTarget = d.Target
+		r.TakeoverProvider = d.Provider
+	}
+	return r
+}
+
+// JSONResultWriter - Writes results as newline-delimited JSON
+type JSONResultWriter struct {
+	sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONResultWriter - Returns a writer of newline-delimited JSON results to w
+func NewJSONResultWriter(w io.Writer) *JSONResultWriter {
+	return &JSONResultWriter{enc: json.NewEncoder(w)}
+}
+
+// Write - Writes the result as a single line of JSON
+func (jw *JSONResultWriter) Write(req *AmassRequest) error {
+	jw.Lock()
+	defer jw.Unlock()
+
+	return jw.enc.Encode(NewJSONResult(req))
+}
+
+// WriteAll - Writes the results received from the channel until it is closed, or a write fails
+func (jw *JSONResultWriter) WriteAll(results <-chan *AmassRequest) error {
+	for req := range results {
+		if err := jw.Write(req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
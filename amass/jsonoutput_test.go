@@ -0,0 +1,60 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/caffix/recon"
+)
+
+func TestJSONResultWriter(t *testing.T) {
+	results := make(chan *AmassRequest, 2)
+	results <- &AmassRequest{
+		Name:        "www.example.com",
+		Domain:      "example.com",
+		Address:     "192.0.2.1",
+		Tag:         DNS,
+		Source:      "Forward DNS",
+		Provenance:  ProvenanceSRV,
+		Validation:  ValidationMatched,
+		Truncated:   true,
+		Provisional: true,
+		Records:     []recon.DNSAnswer{{Name: "www.example.com", Type: 1, TTL: 60, Data: "192.0.2.1"}},
+	}
+	results <- &AmassRequest{Name: "mail.example.com", Domain: "example.com", Tag: SEARCH}
+	close(results)
+
+	var buf bytes.Buffer
+	if err := NewJSONResultWriter(&buf).WriteAll(results); err != nil {
+		t.Fatalf("The results were not written: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("%d lines were written for two results", len(lines))
+	}
+
+	var r map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &r); err != nil {
+		t.Fatalf("The line was not valid JSON: %v", err)
+	}
+	if r["name"] != "www.example.com" || r["address"] != "192.0.2.1" ||
+		r["source"] != "Forward DNS" || r["validation"] != "matched" {
+		t.Errorf("The result was not written with the expected schema: %s", lines[0])
+	}
+	if r["method"] != "srv" || r["truncated"] != true || r["provisional"] != true {
+		t.Errorf("The method and flags were not written: %s", lines[0])
+	}
+	if !strings.Contains(lines[1], `"method":"search"`) || strings.Contains(lines[1], "truncated") ||
+		strings.Contains(lines[1], "provisional") {
+		t.Errorf("The result was written with unset flags or without its method: %s", lines[1])
+	}
+	if records, ok := r["records"].([]interface{}); !ok || len(records) != 1 {
+		t.Errorf("The records were not written: %s", lines[0])
+	}
+}
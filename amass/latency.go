@@ -0,0 +1,119 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// The weight given to each new latency measurement in the moving average
+	latencySmoothing = 0.3
+
+	// The fraction of an even share of the queries that each server is guaranteed
+	minSelectionShare = 0.1
+)
+
+// NameserverStat - The observed performance of a server
+type NameserverStat struct {
+	// The exponentially-weighted moving average of the response time
+	Latency time.Duration
+
+	// The number of queries sent to the server
+	Queries int
+}
+
+// The observed performance of each server, protected by latencyLock
+var (
+	serverLatency = make(map[string]*NameserverStat)
+	latencyLock   sync.Mutex
+)
+
+// NameserverStats - Returns the observed performance of each server that has been queried
+func NameserverStats() map[string]NameserverStat {
+	latencyLock.Lock()
+	defer latencyLock.Unlock()
+
+	stats := make(map[string]NameserverStat, len(serverLatency))
+	for server, stat := range serverLatency {
+		stats[server] = *stat
+	}
+	return stats
+}
+
+// recordLatency updates the moving average of the response time for the server
+func recordLatency(server string, rtt time.Duration) {
+	latencyLock.Lock()
+	defer latencyLock.Unlock()
+
+	stat, found := serverLatency[server]
+	if !found {
+		serverLatency[server] = &NameserverStat{Latency: rtt, Queries: 1}
+		return
+	}
+
+	stat.Queries++
+	stat.Latency += time.Duration(latencySmoothing * float64(rtt-stat.Latency))
+}
+
+// selectionWeights returns weights favoring the servers with the lowest latency.
+// Servers that have not been measured are weighted as the fastest server, so they are tried
+func selectionWeights(servers []string) []float64 {
+	latencyLock.Lock()
+	defer latencyLock.Unlock()
+
+	var fastest time.Duration
+	for _, s := range servers {
+		if stat, found := serverLatency[s]; found && stat.Latency > 0 && (fastest == 0 || stat.Latency < fastest) {
+			fastest = stat.Latency
+		}
+	}
+
+	weights := make([]float64, len(servers))
+	if fastest == 0 {
+		for i := range weights {
+			weights[i] = 1
+		}
+		return weights
+	}
+
+	var total float64
+	for i, s := range servers {
+		latency := fastest
+		if stat, found := serverLatency[s]; found && stat.Latency > 0 {
+			latency = stat.Latency
+		}
+
+		weights[i] = 1 / latency.Seconds()
+		total += weights[i]
+	}
+	// No healthy server is starved of queries
+	floor := minSelectionShare * total / float64(len(servers))
+	for i := range weights {
+		if weights[i] < floor {
+			weights[i] = floor
+		}
+	}
+	return weights
+}
+
+// weightedServer selects a server with a probability proportional to its weight
+func weightedServer(servers []string, rng *lockedRand) string {
+	weights := selectionWeights(servers)
+
+	var total float64
+	for _, w := range weights {
+		total += w
+	}
+
+	r := rng.Float64() * total
+	for i, w := range weights {
+		if r < w {
+			return servers[i]
+		}
+		r -= w
+	}
+	return servers[len(servers)-1]
+}
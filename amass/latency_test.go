@@ -0,0 +1,35 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWeightedNameservers(t *testing.T) {
+	fast, slow := "192.0.2.1:53", "192.0.2.2:53"
+
+	defer useTestResolver(nil)()
+	usableServers = []string{fast, slow}
+
+	for i := 0; i < 5; i++ {
+		recordLatency(fast, 10*time.Millisecond)
+		recordLatency(slow, time.Second)
+	}
+	if stats := NameserverStats(); stats[fast].Queries != 5 || stats[slow].Latency != time.Second {
+		t.Errorf("The server statistics were not recorded: %v", stats)
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < 2000; i++ {
+		counts[NextNameserver()]++
+	}
+	if counts[fast] <= counts[slow] {
+		t.Errorf("The fast server was not favored: %v", counts)
+	}
+	if counts[slow] == 0 {
+		t.Errorf("The slow server was starved of queries")
+	}
+}
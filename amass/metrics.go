@@ -0,0 +1,56 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+// Names of the metrics provided to the MetricsExporter
+const (
+	MetricQueries              = "amass_dns_queries_total"
+	MetricQuerySuccesses       = "amass_dns_query_successes_total"
+	MetricQueryFailures        = "amass_dns_query_failures_total"
+	MetricQueryLatency         = "amass_dns_query_latency_seconds"
+	MetricQueueDepth           = "amass_dns_queue_depth"
+	MetricWildcardSuppressions = "amass_dns_wildcard_suppressions_total"
+	MetricQueryRetries         = "amass_dns_query_retries_total"
+)
+
+// MetricsExporter - Receives the metrics produced by the DNSService as events occur,
+// so they can be exposed through Prometheus, statsd or any other metrics backend
+type MetricsExporter interface {
+	// Adds the delta to the counter
+	AddCounter(name string, delta float64, labels map[string]string)
+
+	// Sets the current value of the gauge
+	SetGauge(name string, value float64, labels map[string]string)
+
+	// Records an observation, such as a latency, for a histogram or summary
+	Observe(name string, value float64, labels map[string]string)
+}
+
+// NoopExporter - A MetricsExporter that discards all metrics, and is used by default
+type NoopExporter struct{}
+
+func (NoopExporter) AddCounter(name string, delta float64, labels map[string]string) {}
+
+func (NoopExporter) SetGauge(name string, value float64, labels map[string]string) {}
+
+func (NoopExporter) Observe(name string, value float64, labels map[string]string) {}
+
+// MetricsExporter - Returns the exporter receiving the metrics of the service
+func (ds *DNSService) MetricsExporter() MetricsExporter {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.metrics
+}
+
+// SetMetricsExporter - Sets the exporter receiving the metrics of the service
+func (ds *DNSService) SetMetricsExporter(exporter MetricsExporter) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	if exporter == nil {
+		exporter = NoopExporter{}
+	}
+	ds.metrics = exporter
+}
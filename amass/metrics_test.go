@@ -0,0 +1,122 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/caffix/recon"
+)
+
+// recordingExporter keeps the metrics it receives, so they can be checked
+type recordingExporter struct {
+	sync.Mutex
+	counters     map[string]float64
+	gauges       map[string]float64
+	observations map[string]int
+}
+
+func newRecordingExporter() *recordingExporter {
+	return &recordingExporter{
+		counters:     make(map[string]float64),
+		gauges:       make(map[string]float64),
+		observations: make(map[string]int),
+	}
+}
+
+func (r *recordingExporter) AddCounter(name string, delta float64, labels map[string]string) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.counters[name+"|"+labels["type"]] += delta
+}
+
+func (r *recordingExporter) SetGauge(name string, value float64, labels map[string]string) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.gauges[name] = value
+}
+
+func (r *recordingExporter) Observe(name string, value float64, labels map[string]string) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.observations[name]++
+}
+
+func TestMetricsExporter(t *testing.T) {
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		if name == "www.example.com" {
+			return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "192.0.2.1"}}, nil
+		}
+		return nil, testNXDOMAIN(name)
+	})()
+
+	exporter := newRecordingExporter()
+	srv := NewDNSService(nil, nil)
+	srv.SetMetricsExporter(exporter)
+	srv.query("www.example.com", "192.0.2.1:53", "A")
+	srv.query("missing.example.com", "192.0.2.1:53", "A")
+	srv.query("www.example.com", "192.0.2.1:53", "AAAA")
+
+	exporter.Lock()
+	if exporter.counters[MetricQueries+"|A"] != 2 || exporter.counters[MetricQueries+"|AAAA"] != 1 {
+		t.Errorf("The queries were counted as %v", exporter.counters)
+	}
+	if exporter.counters[MetricQuerySuccesses+"|A"] != 1 || exporter.counters[MetricQueryFailures+"|A"] != 1 {
+		t.Errorf("The query outcomes were counted as %v", exporter.counters)
+	}
+	if exporter.observations[MetricQueryLatency] != 3 {
+		t.Errorf("%d latencies were observed for the three queries", exporter.observations[MetricQueryLatency])
+	}
+	exporter.Unlock()
+
+	// The metrics are discarded once the exporter has been removed
+	srv.SetMetricsExporter(nil)
+	if _, ok := srv.MetricsExporter().(NoopExporter); !ok {
+		t.Errorf("The default exporter was not restored")
+	}
+	srv.query("www.example.com", "192.0.2.1:53", "A")
+
+	exporter.Lock()
+	defer exporter.Unlock()
+	if exporter.counters[MetricQueries+"|A"] != 2 {
+		t.Errorf("The removed exporter received the metrics of another query")
+	}
+}
+
+func TestQueueDepthGauge(t *testing.T) {
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		return nil, testNXDOMAIN(name)
+	})()
+
+	exporter := newRecordingExporter()
+	in := make(chan *AmassRequest, 10)
+	srv := NewDNSService(in, make(chan *AmassRequest, 10))
+	srv.SetMetricsExporter(exporter)
+	// Nothing is dispatched from the queue during the test
+	srv.SetFrequency(time.Hour)
+	srv.Start()
+	defer func() {
+		srv.Stop()
+		waitForWork(srv)
+	}()
+
+	for _, name := range []string{"a.example.com", "b.example.com"} {
+		in <- &AmassRequest{Name: name, Domain: "example.com", Tag: SEARCH}
+	}
+
+	var depth float64
+	for deadline := time.Now().Add(time.Second); depth != 2 && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		exporter.Lock()
+		depth = exporter.gauges[MetricQueueDepth]
+		exporter.Unlock()
+	}
+	if depth != 2 {
+		t.Errorf("The queue depth was reported as %v instead of 2", depth)
+	}
+}
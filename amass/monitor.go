@@ -0,0 +1,135 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"sort"
+	"time"
+
+	"github.com/caffix/amass/amass/stringset"
+)
+
+// AddressChange - Reports a change in the addresses that a monitored name resolves to
+type AddressChange struct {
+	// The monitored name
+	Name string
+
+	// The addresses the name resolved to before and after the change
+	Before []string
+	After  []string
+
+	// The addresses that appeared and disappeared
+	Added   []string
+	Removed []string
+
+	// When the change was observed
+	Time time.Time
+}
+
+// SetMonitor - Configures the names that will be re-resolved on the interval after the service
+// has been started. This must be set before calling Start, and a zero interval disables monitoring
+func (ds *DNSService) SetMonitor(interval time.Duration, names []string) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.monitorInterval = interval
+	ds.monitorNames = names
+}
+
+// SetChangeOutput - Sets the channel that will receive the monitoring change events
+func (ds *DNSService) SetChangeOutput(out chan *AddressChange) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.changes = out
+}
+
+func (ds *DNSService) monitorConfig() (time.Duration, []string, chan *AddressChange) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.monitorInterval, ds.monitorNames, ds.changes
+}
+
+// Goroutine that periodically re-resolves the monitored names and reports changes
+func (ds *DNSService) processMonitoring() {
+	interval, _, _ := ds.monitorConfig()
+	if interval <= 0 {
+		return
+	}
+	// The last address set observed for each monitored name
+	known := make(map[string]*stringset.StringSet)
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	ds.checkMonitoredNames(known)
+loop:
+	for {
+		select {
+		case <-t.C:
+			ds.checkMonitoredNames(known)
+		case <-ds.Quit():
+			break loop
+		}
+	}
+}
+
+func (ds *DNSService) checkMonitoredNames(known map[string]*stringset.StringSet) {
+	_, names, out := ds.monitorConfig()
+
+	for _, name := range names {
+		answers, _, err := ds.resolveName("", name)
+		// A name that no longer exists has an empty address set
+		if err != nil && err != ErrNXDOMAIN && err != ErrNoRecords && err != ErrCNAMEDepth {
+			continue
+		}
+
+		current := addressSet(answers)
+		before, found := known[name]
+		known[name] = current
+		// The first resolution only establishes the baseline
+		if !found || (before.Equal(current) && current.Equal(before)) {
+			continue
+		}
+
+		change := &AddressChange{
+			Name:    name,
+			Before:  sortedStrings(before),
+			After:   sortedStrings(current),
+			Added:   missingFrom(current, before),
+			Removed: missingFrom(before, current),
+			Time:    time.Now(),
+		}
+
+		if out == nil {
+			continue
+		}
+		select {
+		case out <- change:
+		case <-ds.Quit():
+			return
+		}
+	}
+}
+
+// missingFrom returns the sorted elements of the first set that are not in the second
+func missingFrom(first, second *stringset.StringSet) []string {
+	var result []string
+
+	for _, s := range first.ToStrings() {
+		if !second.Contains(s) {
+			result = append(result, s)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func sortedStrings(ss *stringset.StringSet) []string {
+	result := ss.ToStrings()
+
+	sort.Strings(result)
+	return result
+}
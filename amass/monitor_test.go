@@ -0,0 +1,81 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/caffix/amass/amass/stringset"
+	"github.com/caffix/recon"
+)
+
+func TestMonitorChanges(t *testing.T) {
+	var lock sync.Mutex
+	addrs := []string{"192.0.2.1", "192.0.2.2"}
+	srv, _, done := newTestService(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if qtype != "A" {
+			return nil, testNoRecords(name)
+		}
+		if len(addrs) == 0 {
+			return nil, testNXDOMAIN(name)
+		}
+
+		var answers []recon.DNSAnswer
+		for _, addr := range addrs {
+			// A zero TTL keeps the answers from being cached between the checks
+			answers = append(answers, recon.DNSAnswer{Name: name, Type: 1, TTL: 0, Data: addr})
+		}
+		return answers, nil
+	})
+	defer done()
+
+	changes := make(chan *AddressChange, 10)
+	srv.SetMonitor(time.Minute, []string{"www.example.com"})
+	srv.SetChangeOutput(changes)
+
+	// The first check only establishes the baseline
+	known := make(map[string]*stringset.StringSet)
+	srv.checkMonitoredNames(known)
+	srv.checkMonitoredNames(known)
+	if len(changes) != 0 {
+		t.Fatalf("A change was reported before the addresses changed")
+	}
+
+	lock.Lock()
+	addrs = []string{"192.0.2.2", "192.0.2.3"}
+	lock.Unlock()
+
+	srv.checkMonitoredNames(known)
+	if len(changes) != 1 {
+		t.Fatalf("The address change was not reported")
+	}
+	change := <-changes
+	if change.Name != "www.example.com" ||
+		!reflect.DeepEqual(change.Before, []string{"192.0.2.1", "192.0.2.2"}) ||
+		!reflect.DeepEqual(change.After, []string{"192.0.2.2", "192.0.2.3"}) ||
+		!reflect.DeepEqual(change.Added, []string{"192.0.2.3"}) ||
+		!reflect.DeepEqual(change.Removed, []string{"192.0.2.1"}) {
+		t.Errorf("The change was reported as %+v", change)
+	}
+
+	// A name that no longer exists has lost all of its addresses
+	lock.Lock()
+	addrs = nil
+	lock.Unlock()
+
+	srv.checkMonitoredNames(known)
+	if len(changes) != 1 {
+		t.Fatalf("The removal of the name was not reported")
+	}
+	change = <-changes
+	if len(change.After) != 0 || !reflect.DeepEqual(change.Removed, []string{"192.0.2.2", "192.0.2.3"}) {
+		t.Errorf("The removal was reported as %+v", change)
+	}
+}
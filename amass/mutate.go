@@ -0,0 +1,73 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"strconv"
+	"strings"
+)
+
+// MutationWords - The words combined with the first label of a name by Mutate
+var MutationWords = []string{"dev", "test", "qa", "uat", "stage", "staging", "prod", "beta", "internal", "api"}
+
+// Mutate - Generates plausible variations of the name, such as api-dev, dev-api, api2 and staging-api
+// for api.example.com, by combining the first label with numbers and the MutationWords. The names
+// returned are valid and unique, and do not include the name itself
+func Mutate(name string) []string {
+	var names []string
+
+	parts := strings.SplitN(strings.ToLower(strings.TrimSuffix(name, ".")), ".", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return names
+	}
+	label, rest := parts[0], parts[1]
+
+	var labels []string
+	for i := 1; i <= 3; i++ {
+		labels = append(labels, label+strconv.Itoa(i))
+	}
+	for _, word := range MutationWords {
+		if word == label {
+			continue
+		}
+		labels = append(labels, label+"-"+word, word+"-"+label, word+"."+label)
+	}
+
+	seen := map[string]struct{}{parts[0] + "." + rest: struct{}{}}
+	for _, l := range labels {
+		n := l + "." + rest
+		if _, found := seen[n]; found || !validName(n) {
+			continue
+		}
+		seen[n] = struct{}{}
+		names = append(names, n)
+	}
+	return names
+}
+
+// MutateNames - Returns true if the resolved names are mutated and the variations resolved
+func (ds *DNSService) MutateNames() bool {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.mutate
+}
+
+// SetMutateNames - Causes the variations generated by Mutate for each resolved name to be queued
+// for resolution. The variations that resolve are mutated in turn, one discovery round later
+func (ds *DNSService) SetMutateNames(enabled bool) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.mutate = enabled
+}
+
+// sendMutations queues the variations of the name that are in scope
+func (ds *DNSService) sendMutations(req *AmassRequest) {
+	for _, name := range Mutate(req.Name) {
+		if domain := ds.scopeOf(name, req.Domain); domain != "" {
+			ds.queueName(discovered(ProvenanceAlteration, name, domain, req.Round+1))
+		}
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"testing"
+)
+
+func TestMutate(t *testing.T) {
+	names := Mutate("api.example.com")
+
+	seen := make(map[string]struct{})
+	for _, n := range names {
+		if _, found := seen[n]; found {
+			t.Errorf("%s was generated more than once", n)
+		}
+		seen[n] = struct{}{}
+
+		if n == "api.example.com" || !validName(n) {
+			t.Errorf("%s should not have been generated", n)
+		}
+	}
+	for _, n := range []string{"api-dev.example.com", "dev-api.example.com", "api2.example.com", "staging-api.example.com"} {
+		if _, found := seen[n]; !found {
+			t.Errorf("%s was not generated", n)
+		}
+	}
+
+	if names := Mutate("com"); len(names) != 0 {
+		t.Errorf("Names were generated without a parent domain: %v", names)
+	}
+}
+
+func TestSendMutations(t *testing.T) {
+	srv := NewDNSService(nil, nil)
+	srv.sendMutations(&AmassRequest{
+		Name:   "api.example.com",
+		Domain: "example.com",
+		Round:  1,
+	})
+
+	if len(srv.requeue) != len(Mutate("api.example.com")) {
+		t.Fatalf("%d names were queued", len(srv.requeue))
+	}
+	if req := <-srv.requeue; req.Round != 2 || req.Provenance != ProvenanceAlteration {
+		t.Errorf("The mutation was queued as %+v", req)
+	}
+}
@@ -0,0 +1,386 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// OutputPolicy - Determines what happens to results when the consumer cannot keep up
+type OutputPolicy int
+
+const (
+	// Wait for the consumer to receive each result
+	BlockOutput OutputPolicy = iota
+
+	// Discard results the consumer is not ready to receive, and count them
+	DropOutput
+
+	// Write results the consumer is not ready to receive to disk, and deliver them later
+	SpillOutput
+)
+
+// OutputPolicy - Returns the policy used when the consumer cannot keep up
+func (ds *DNSService) OutputPolicy() OutputPolicy {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.outputPolicy
+}
+
+// SetOutputPolicy - Sets the policy used when the consumer cannot keep up
+func (ds *DNSService) SetOutputPolicy(policy OutputPolicy) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.outputPolicy = policy
+}
+
+// SetSpillPath - Sets the file used by SpillOutput, where an empty path causes a temporary file to be used
+func (ds *DNSService) SetSpillPath(path string) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.spillPath = path
+}
+
+// DroppedResults - Returns the number of results discarded by DropOutput
+func (ds *DNSService) DroppedResults() int64 {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.dropped
+}
+
+// CloseOutputOnStop - Returns true if the output channel is closed once the service has stopped
+func (ds *DNSService) CloseOutputOnStop() bool {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.closeOutput
+}
+
+// SetCloseOutputOnStop - Determines if the output channel is closed once the service has stopped,
+// so consumers ranging over the channel finish with the service. Combined with SetDrainOnStop, the
+// channel is closed after the queued names have been resolved. The channel must not be shared
+// with other services when enabled
+func (ds *DNSService) SetCloseOutputOnStop(enabled bool) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.closeOutput = enabled
+}
+
+// closeOutputChannel closes the output channel after the quit channel, once the results being
+// sent have given up, and causes the results produced afterwards to be discarded
+func (ds *DNSService) closeOutputChannel() {
+	<-ds.Quit()
+
+	ds.outputLock.Lock()
+	defer ds.outputLock.Unlock()
+
+	if !ds.outputClosed {
+		ds.outputClosed = true
+		close(ds.Output())
+	}
+}
+
+// deliver - Sends the result to the consumer according to the output policy
+func (ds *DNSService) deliver(req *AmassRequest) {
+	switch ds.OutputPolicy() {
+	case DropOutput:
+		if !ds.sendResult(req, false) {
+			ds.Lock()
+			ds.dropped++
+			ds.Unlock()
+		}
+	case SpillOutput:
+		spill := ds.getSpill()
+		if spill == nil {
+			ds.sendResult(req, true)
+			return
+		}
+		// Results already on disk go out first to preserve the order
+		if spill.SendIfEmpty(func() bool { return ds.sendResult(req, false) }) {
+			return
+		}
+		if err := spill.Write(req); err != nil {
+			ds.sendResult(req, true)
+		}
+	default:
+		ds.sendResult(req, true)
+	}
+}
+
+// sendResult sends the result on the output channel, waiting for the consumer when requested.
+// False is returned when the result was not sent, including when the service stopped, so the
+// sending goroutines do not outlive the service. The read lock keeps closeOutputChannel from
+// closing the channel during a send
+func (ds *DNSService) sendResult(req *AmassRequest, wait bool) bool {
+	ds.outputLock.RLock()
+	defer ds.outputLock.RUnlock()
+
+	if ds.outputClosed {
+		return false
+	}
+
+	if !wait {
+		select {
+		case ds.Output() <- req:
+			ds.stats.emission(req.Domain)
+			ds.recordResult(req)
+			return true
+		default:
+			return false
+		}
+	}
+
+	select {
+	case ds.Output() <- req:
+		ds.stats.emission(req.Domain)
+		ds.recordResult(req)
+		return true
+	case <-ds.Quit():
+		return false
+	}
+}
+
+// getSpill returns the disk buffer, creating it and starting its delivery goroutine on first use.
+// Nil is returned once the disk buffer has failed, and the results then wait for the consumer
+func (ds *DNSService) getSpill() *diskBuffer {
+	ds.Lock()
+	defer ds.Unlock()
+
+	if ds.spillFailed {
+		return nil
+	}
+	if ds.spill != nil {
+		return ds.spill
+	}
+
+	spill, err := newDiskBuffer(ds.spillPath)
+	if err != nil {
+		log.Printf("%s: failed to create the spill file: %v", ds, err)
+		ds.spillFailed = true
+		return nil
+	}
+	ds.spill = spill
+
+	go ds.processSpill(spill)
+	return spill
+}
+
+// spillError reports the failure of the disk buffer and stops using it. The buffer is closed
+// rather than replaced, so the results written by deliver afterwards wait for the consumer
+func (ds *DNSService) spillError(spill *diskBuffer, err error) {
+	log.Printf("%s: failed to read the spill file: %v", ds, err)
+	spill.Close()
+
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.spillFailed = true
+}
+
+// Goroutine that delivers the results written to disk once the consumer is ready
+func (ds *DNSService) processSpill(spill *diskBuffer) {
+	defer spill.Close()
+
+	for {
+		select {
+		case <-spill.Ready():
+		case <-ds.Quit():
+			return
+		}
+
+		for spill.Pending() > 0 {
+			req, err := spill.Read()
+			if err == errSpillDecode {
+				// The line has been consumed, so the following results can still be delivered
+				log.Printf("%s: skipped a corrupted result in the spill file", ds)
+				spill.Done()
+				continue
+			} else if err != nil {
+				ds.spillError(spill, err)
+				return
+			}
+
+			if !ds.sendResult(req, true) {
+				return
+			}
+			spill.Done()
+		}
+		// The file is emptied once the consumer has caught up, so it does not keep growing
+		if err := spill.Truncate(); err != nil {
+			ds.spillError(spill, err)
+			return
+		}
+	}
+}
+
+// Errors returned by the diskBuffer when a line of the file is not a valid result, and once it has been closed
+var (
+	errSpillDecode = errors.New("The spill file contains a corrupted result")
+	errSpillClosed = errors.New("The spill file has been closed")
+)
+
+// diskBuffer is a first-in, first-out queue of results stored in a file
+type diskBuffer struct {
+	// Accessed atomically, and first in the struct for 64-bit alignment
+	pending int64
+
+	sync.Mutex
+	path   string
+	temp   bool
+	closed bool
+	writer *os.File
+	reader *bufio.Reader
+	rfile  *os.File
+	ready  chan struct{}
+}
+
+func newDiskBuffer(path string) (*diskBuffer, error) {
+	var temp bool
+	var writer *os.File
+	var err error
+
+	if path == "" {
+		temp = true
+		writer, err = ioutil.TempFile("", "amass-spill")
+	} else {
+		writer, err = os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rfile, err := os.Open(writer.Name())
+	if err != nil {
+		writer.Close()
+		return nil, err
+	}
+
+	return &diskBuffer{
+		path:   writer.Name(),
+		temp:   temp,
+		writer: writer,
+		reader: bufio.NewReader(rfile),
+		rfile:  rfile,
+		ready:  make(chan struct{}, 1),
+	}, nil
+}
+
+// Write appends the result to the end of the file
+func (db *diskBuffer) Write(req *AmassRequest) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	db.Lock()
+	if db.closed {
+		db.Unlock()
+		return errSpillClosed
+	}
+	_, err = db.writer.Write(append(data, '\n'))
+	if err == nil {
+		// Counted under the lock, so Truncate cannot discard a result that has not been delivered
+		atomic.AddInt64(&db.pending, 1)
+	}
+	db.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// Wake up the delivery goroutine
+	select {
+	case db.ready <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Read removes the oldest result from the file, and must only be called while results are pending.
+// The result remains pending until Done is called, so newer results are not sent ahead of it
+func (db *diskBuffer) Read() (*AmassRequest, error) {
+	line, err := db.reader.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	req := new(AmassRequest)
+	if err := json.Unmarshal(line, req); err != nil {
+		return nil, errSpillDecode
+	}
+	return req, nil
+}
+
+// Done marks the result obtained from Read as delivered
+func (db *diskBuffer) Done() {
+	atomic.AddInt64(&db.pending, -1)
+}
+
+// SendIfEmpty hands the result over using send when no results are pending. The lock keeps other
+// results from being written to the file between the check and the handoff
+func (db *diskBuffer) SendIfEmpty(send func() bool) bool {
+	db.Lock()
+	defer db.Unlock()
+
+	return atomic.LoadInt64(&db.pending) == 0 && send()
+}
+
+// Truncate empties the file when every result written to it has been delivered
+func (db *diskBuffer) Truncate() error {
+	db.Lock()
+	defer db.Unlock()
+
+	if atomic.LoadInt64(&db.pending) > 0 {
+		return nil
+	}
+	if err := db.writer.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := db.writer.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := db.rfile.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	db.reader.Reset(db.rfile)
+	return nil
+}
+
+// Pending returns the number of results written to the file and not yet delivered
+func (db *diskBuffer) Pending() int64 {
+	return atomic.LoadInt64(&db.pending)
+}
+
+// Ready returns a channel that receives when new results have been written
+func (db *diskBuffer) Ready() <-chan struct{} {
+	return db.ready
+}
+
+// Close removes a temporary file, and causes the results written afterwards to be rejected
+func (db *diskBuffer) Close() {
+	db.Lock()
+	defer db.Unlock()
+
+	if db.closed {
+		return
+	}
+	db.closed = true
+	db.writer.Close()
+	db.rfile.Close()
+	if db.temp {
+		os.Remove(db.path)
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/caffix/amass/amass/stringset"
+	"github.com/caffix/recon"
+)
+
+func TestCloseOutputOnStop(t *testing.T) {
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		if qtype == "A" {
+			return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "192.0.2.1"}}, nil
+		}
+		return nil, testNoRecords(name)
+	})()
+
+	in := make(chan *AmassRequest)
+	out := make(chan *AmassRequest)
+	srv := NewDNSService(in, out)
+	srv.SetWildcardDetection(false)
+	srv.SetDrainOnStop(true)
+	srv.SetCloseOutputOnStop(true)
+	srv.Start()
+
+	names := 5
+	for i := 0; i < names; i++ {
+		in <- &AmassRequest{Name: fmt.Sprintf("host%d.example.com", i), Domain: "example.com", Tag: SEARCH}
+	}
+
+	seen := stringset.NewStringSet()
+	done := make(chan struct{})
+	go func() {
+		for req := range out {
+			if strings.HasPrefix(req.Name, "host") {
+				seen.Add(req.Name)
+			}
+		}
+		close(done)
+	}()
+	srv.Stop()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("The output channel was not closed after the service stopped")
+	}
+	if n := len(seen.ToStrings()); n != names {
+		t.Errorf("Only %d of the %d queued names were delivered before the channel was closed", n, names)
+	}
+}
+
+func TestSendOutShutdown(t *testing.T) {
+	out := make(chan *AmassRequest)
+	srv := NewDNSService(make(chan *AmassRequest), out)
+	srv.Start()
+
+	// The consumer is not reading, so the send waits until the service stops
+	done := make(chan struct{})
+	go func() {
+		srv.sendOut(&AmassRequest{Name: "www.example.com", Domain: "example.com"})
+		close(done)
+	}()
+	srv.Stop()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("The send on the output channel outlived the service")
+	}
+}
+
+func TestSendAfterOutputClosed(t *testing.T) {
+	out := make(chan *AmassRequest)
+	srv := NewDNSService(make(chan *AmassRequest), out)
+	srv.SetCloseOutputOnStop(true)
+	srv.Start()
+
+	// Senders waiting on the consumer while the service closes the channel must not panic
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			srv.sendResult(&AmassRequest{Name: "www.example.com", Domain: "example.com"}, true)
+		}()
+	}
+	srv.Stop()
+	wg.Wait()
+
+	select {
+	case _, ok := <-out:
+		if ok {
+			t.Errorf("A result was received after the service stopped")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("The output channel was not closed after the service stopped")
+	}
+	if srv.sendResult(&AmassRequest{Name: "www.example.com", Domain: "example.com"}, true) {
+		t.Errorf("The result was reported as sent on the closed channel")
+	}
+}
+
+func TestSpillOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "amass-spill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "spill.json")
+
+	out := make(chan *AmassRequest)
+	srv := NewDNSService(make(chan *AmassRequest), out)
+	srv.SetOutputPolicy(SpillOutput)
+	srv.SetSpillPath(path)
+	srv.Start()
+	defer srv.Stop()
+
+	// Nobody is receiving, so the results are written to the file
+	names := 5
+	for i := 0; i < names; i++ {
+		srv.deliver(&AmassRequest{Name: fmt.Sprintf("host%d.example.com", i), Domain: "example.com"})
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() == 0 {
+		t.Fatalf("The results were not written to the spill file")
+	}
+
+	for i := 0; i < names; i++ {
+		select {
+		case req := <-out:
+			if expected := fmt.Sprintf("host%d.example.com", i); req.Name != expected {
+				t.Errorf("%s was delivered instead of %s", req.Name, expected)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Only %d of the %d spilled results were delivered", i, names)
+		}
+	}
+
+	// The file is emptied once the results have been delivered
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if info, err := os.Stat(path); err == nil && info.Size() == 0 {
+			break
+		}
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() != 0 {
+		t.Errorf("The spill file was not truncated after it was drained")
+	}
+
+	// Results spilled after the truncation are still delivered
+	srv.deliver(&AmassRequest{Name: "late.example.com", Domain: "example.com"})
+	select {
+	case req := <-out:
+		if req.Name != "late.example.com" {
+			t.Errorf("%s was delivered instead of late.example.com", req.Name)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("The result spilled after the truncation was not delivered")
+	}
+}
+
+func TestSpillOrder(t *testing.T) {
+	spill, err := newDiskBuffer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spill.Close()
+
+	if err := spill.Write(&AmassRequest{Name: "first.example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := spill.Read(); err != nil {
+		t.Fatal(err)
+	}
+	// The result that has been read, but not yet delivered, still goes out first
+	if spill.SendIfEmpty(func() bool { return true }) {
+		t.Errorf("A newer result was sent ahead of the result being delivered from the file")
+	}
+
+	spill.Done()
+	if !spill.SendIfEmpty(func() bool { return true }) {
+		t.Errorf("The result was not sent once the file had been drained")
+	}
+}
+
+func TestSpillFailure(t *testing.T) {
+	out := make(chan *AmassRequest, 1)
+	srv := NewDNSService(make(chan *AmassRequest), out)
+	srv.SetOutputPolicy(SpillOutput)
+	srv.Start()
+	defer srv.Stop()
+
+	spill := srv.getSpill()
+	if spill == nil {
+		t.Fatal("The spill file was not created")
+	}
+	srv.spillError(spill, errors.New("The disk failed"))
+
+	// Writers still holding the buffer cannot lose results in the failed file
+	if err := spill.Write(&AmassRequest{Name: "www.example.com"}); err != errSpillClosed {
+		t.Errorf("The failed spill file accepted a result: %v", err)
+	}
+	if srv.getSpill() != nil {
+		t.Errorf("The failed spill file was used again")
+	}
+
+	// The results then wait for the consumer
+	srv.deliver(&AmassRequest{Name: "www.example.com", Domain: "example.com"})
+	select {
+	case req := <-out:
+		if req.Name != "www.example.com" {
+			t.Errorf("%s was delivered instead of www.example.com", req.Name)
+		}
+	default:
+		t.Errorf("The result was not delivered after the spill file failed")
+	}
+}
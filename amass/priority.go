@@ -0,0 +1,190 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"container/heap"
+	"sort"
+	"time"
+)
+
+// DefaultTagPriorities - Resolves the names found by searches ahead of the other names, since
+// they are more likely to exist and skip the wildcard filtering
+var DefaultTagPriorities = map[string]int{SEARCH: 1}
+
+// TagPriorities - Returns the priority of the names carrying each tag
+func (ds *DNSService) TagPriorities() map[string]int {
+	ds.Lock()
+	defer ds.Unlock()
+
+	priorities := make(map[string]int, len(ds.tagPriorities))
+	for tag, p := range ds.tagPriorities {
+		priorities[tag] = p
+	}
+	return priorities
+}
+
+// SetTagPriorities - Sets the priority of the names carrying each tag, where queued names with a
+// higher priority are resolved first and names with the same priority are resolved in the order
+// they arrived. Tags without a priority have zero, an empty map resolves all names in order and
+// nil restores the DefaultTagPriorities
+func (ds *DNSService) SetTagPriorities(priorities map[string]int) {
+	if priorities == nil {
+		priorities = DefaultTagPriorities
+	}
+
+	copied := make(map[string]int, len(priorities))
+	for tag, p := range priorities {
+		copied[tag] = p
+	}
+
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.tagPriorities = copied
+}
+
+// priorities returns the current priorities, which are replaced and never modified by SetTagPriorities
+func (ds *DNSService) priorities() map[string]int {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.tagPriorities
+}
+
+// requestQueue holds one FIFO of requests for each priority, so adding a request
+// does not shift the requests that are already queued. Requests that are not yet
+// eligible for dispatch wait in a heap, and join their FIFO once they become eligible
+type requestQueue struct {
+	// The priorities with queued requests, from the highest to the lowest
+	levels  []int
+	fifos   map[int][]*AmassRequest
+	delayed delayedRequests
+	length  int
+}
+
+// delayedRequest is a request waiting in the heap until it becomes eligible for dispatch
+type delayedRequest struct {
+	req       *AmassRequest
+	priority  int
+	notBefore time.Time
+}
+
+// delayedRequests implements heap.Interface, ordered by when the requests become eligible
+type delayedRequests []delayedRequest
+
+func (d delayedRequests) Len() int           { return len(d) }
+func (d delayedRequests) Less(i, j int) bool { return d[i].notBefore.Before(d[j].notBefore) }
+func (d delayedRequests) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+
+func (d *delayedRequests) Push(x interface{}) {
+	*d = append(*d, x.(delayedRequest))
+}
+
+func (d *delayedRequests) Pop() interface{} {
+	old := *d
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = delayedRequest{}
+	*d = old[:n-1]
+	return item
+}
+
+// queuePosition locates a request returned by requestQueue.Next, which is at the front of its FIFO
+type queuePosition struct {
+	priority int
+}
+
+func newRequestQueue() *requestQueue {
+	return &requestQueue{fifos: make(map[int][]*AmassRequest)}
+}
+
+// Push adds the request behind the queued requests with the same or a higher priority
+func (q *requestQueue) Push(req *AmassRequest, priority int) {
+	q.push(req, priority)
+	q.length++
+}
+
+// PushDelayed adds the request, which is not returned by Next until the provided time. It is
+// then placed behind the requests with the same or a higher priority that were already eligible
+func (q *requestQueue) PushDelayed(req *AmassRequest, priority int, notBefore time.Time) {
+	heap.Push(&q.delayed, delayedRequest{req: req, priority: priority, notBefore: notBefore})
+	q.length++
+}
+
+// push appends the request to the FIFO of the priority
+func (q *requestQueue) push(req *AmassRequest, priority int) {
+	fifo, found := q.fifos[priority]
+	if !found {
+		i := sort.Search(len(q.levels), func(i int) bool { return q.levels[i] < priority })
+		q.levels = append(q.levels, 0)
+		copy(q.levels[i+1:], q.levels[i:])
+		q.levels[i] = priority
+	}
+
+	q.fifos[priority] = append(fifo, req)
+}
+
+// Len returns the number of queued requests
+func (q *requestQueue) Len() int {
+	return q.length
+}
+
+// Requests returns the eligible requests in the order they would be dispatched,
+// followed by the delayed requests
+func (q *requestQueue) Requests() []*AmassRequest {
+	requests := make([]*AmassRequest, 0, q.length)
+	for _, p := range q.levels {
+		requests = append(requests, q.fifos[p]...)
+	}
+	for _, d := range q.delayed {
+		requests = append(requests, d.req)
+	}
+	return requests
+}
+
+// Next returns the first request eligible for dispatch at the provided time, without removing
+// it from the queue. The delayed requests that have become eligible join their FIFO first
+func (q *requestQueue) Next(now time.Time) (*AmassRequest, queuePosition, bool) {
+	for len(q.delayed) > 0 && !q.delayed[0].notBefore.After(now) {
+		d := heap.Pop(&q.delayed).(delayedRequest)
+		q.push(d.req, d.priority)
+	}
+
+	if len(q.levels) == 0 {
+		return nil, queuePosition{}, false
+	}
+	p := q.levels[0]
+	return q.fifos[p][0], queuePosition{priority: p}, true
+}
+
+// Remove takes the request at the position returned by Next out of the queue
+func (q *requestQueue) Remove(pos queuePosition) {
+	fifo := q.fifos[pos.priority]
+
+	fifo[0] = nil
+	fifo = fifo[1:]
+	q.length--
+
+	if len(fifo) > 0 {
+		q.fifos[pos.priority] = fifo
+		return
+	}
+	// Empty priorities are dropped, so Next does not keep checking them
+	delete(q.fifos, pos.priority)
+	for i, p := range q.levels {
+		if p == pos.priority {
+			q.levels = append(q.levels[:i], q.levels[i+1:]...)
+			break
+		}
+	}
+}
+
+// Clear removes all the queued requests
+func (q *requestQueue) Clear() {
+	q.levels = nil
+	q.fifos = make(map[int][]*AmassRequest)
+	q.delayed = nil
+	q.length = 0
+}
@@ -0,0 +1,50 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTagPriorities(t *testing.T) {
+	queue := newRequestQueue()
+	priorities := DefaultTagPriorities
+	for i, tag := range []string{BRUTE, SEARCH, ALT, SEARCH, BRUTE} {
+		queue.Push(&AmassRequest{Name: fmt.Sprintf("%s%d", tag, i), Tag: tag}, priorities[tag])
+	}
+
+	var order []string
+	for _, req := range queue.Requests() {
+		order = append(order, req.Name)
+	}
+	if got := strings.Join(order, ","); got != "search1,search3,brute0,alt2,brute4" {
+		t.Errorf("The names were queued in the order %s", got)
+	}
+
+	var dispatched []string
+	for queue.Len() > 0 {
+		next, pos, _ := queue.Next(time.Now())
+		queue.Remove(pos)
+		dispatched = append(dispatched, next.Name)
+	}
+	if got := strings.Join(dispatched, ","); got != "search1,search3,brute0,alt2,brute4" {
+		t.Errorf("The names were dispatched in the order %s", got)
+	}
+	if _, _, found := queue.Next(time.Now()); found || len(queue.Requests()) != 0 {
+		t.Errorf("The empty queue returned a request")
+	}
+
+	srv := NewDNSService(nil, nil)
+	srv.SetTagPriorities(map[string]int{})
+	if p := srv.TagPriorities(); len(p) != 0 {
+		t.Errorf("The priorities were not cleared: %v", p)
+	}
+	srv.SetTagPriorities(nil)
+	if p := srv.TagPriorities(); p[SEARCH] != DefaultTagPriorities[SEARCH] {
+		t.Errorf("The default priorities were not restored: %v", p)
+	}
+}
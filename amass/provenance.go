@@ -0,0 +1,103 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+// Provenance - Describes how a name was discovered
+type Provenance int
+
+const (
+	// The discovery method is not known
+	ProvenanceUnknown Provenance = iota
+
+	// Obtained from a search engine or other data source
+	ProvenanceSearch
+
+	// Guessed by brute forcing with a wordlist
+	ProvenanceBruteForce
+
+	// Guessed by altering names that were already discovered
+	ProvenanceAlteration
+
+	// Guessed by the ngram model
+	ProvenanceNgram
+
+	// Obtained from a web archive
+	ProvenanceArchive
+
+	// Guessed using the builtin prefixes
+	ProvenanceBuiltin
+
+	// Found in the CNAME chain of another name
+	ProvenanceCNAME
+
+	// The mail exchanger of another name
+	ProvenanceMX
+
+	// Found in the PTR record of a resolved address
+	ProvenanceReverseDNS
+
+	// An authoritative nameserver of the domain
+	ProvenanceNS
+
+	// Referenced by the SPF record of another name
+	ProvenanceSPF
+
+	// The target of an SRV record of the domain
+	ProvenanceSRV
+)
+
+// The Tag and Source strings historically used for each discovery method.
+// Empty sources are provided by the data source that discovered the name
+var provenanceStrings = map[Provenance][2]string{
+	ProvenanceSearch:     {SEARCH, ""},
+	ProvenanceBruteForce: {BRUTE, ""},
+	ProvenanceAlteration: {ALT, ""},
+	ProvenanceNgram:      {"ngram", ""},
+	ProvenanceArchive:    {ARCHIVE, ""},
+	ProvenanceBuiltin:    {BUILTIN, ""},
+	ProvenanceCNAME:      {DNS, "DNS"},
+	ProvenanceMX:         {DNS, "MX"},
+	ProvenanceReverseDNS: {DNS, "Reverse DNS"},
+	ProvenanceNS:         {DNS, "NS"},
+	ProvenanceSPF:        {DNS, "SPF"},
+	ProvenanceSRV:        {DNS, "SRV"},
+}
+
+// Tag - Returns the Tag string used for names discovered this way
+func (p Provenance) Tag() string {
+	return provenanceStrings[p][0]
+}
+
+// Source - Returns the Source string used for names discovered this way, which is
+// empty when the source is the specific data source that discovered the name
+func (p Provenance) Source() string {
+	return provenanceStrings[p][1]
+}
+
+// provenanceOf returns the provenance of the request, using the Tag when it was not set
+func provenanceOf(req *AmassRequest) Provenance {
+	if req.Provenance != ProvenanceUnknown {
+		return req.Provenance
+	}
+
+	for p, s := range provenanceStrings {
+		// The tag alone is ambiguous for the names found by the DNS service
+		if s[1] == "" && s[0] == req.Tag {
+			return p
+		}
+	}
+	return ProvenanceUnknown
+}
+
+// discovered returns a request for a name discovered by the DNS service, with the strings set
+func discovered(p Provenance, name, domain string, round int) *AmassRequest {
+	return &AmassRequest{
+		Name:       name,
+		Domain:     domain,
+		Tag:        p.Tag(),
+		Source:     p.Source(),
+		Provenance: p,
+		Round:      round,
+	}
+}
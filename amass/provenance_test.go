@@ -0,0 +1,35 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"testing"
+)
+
+func TestProvenance(t *testing.T) {
+	mx := discovered(ProvenanceMX, "mail.example.com", "example.com", 1)
+	if mx.Tag != DNS || mx.Source != "MX" || provenanceOf(mx) != ProvenanceMX {
+		t.Errorf("The strings were not backed by the provenance: %+v", mx)
+	}
+
+	tests := map[string]Provenance{
+		SEARCH: ProvenanceSearch,
+		BRUTE:  ProvenanceBruteForce,
+		ALT:    ProvenanceAlteration,
+		DNS:    ProvenanceUnknown,
+	}
+	for tag, expected := range tests {
+		if p := provenanceOf(&AmassRequest{Tag: tag, Source: "Test"}); p != expected {
+			t.Errorf("The tag %s provided provenance %d instead of %d", tag, p, expected)
+		}
+	}
+
+	results := collectConflictResults(t, PreferCNAME)
+	if lb := results["lb.example.com"]; len(lb) == 0 || lb[0].Provenance != ProvenanceCNAME {
+		t.Errorf("The name from the CNAME chain was not marked with its provenance")
+	}
+	if www := results["www.example.com"]; len(www) == 0 || www[0].Provenance != ProvenanceSearch {
+		t.Errorf("The searched name was not marked with its provenance")
+	}
+}
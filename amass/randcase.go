@@ -0,0 +1,73 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"errors"
+	"math/rand"
+	"strings"
+	"unicode"
+
+	"github.com/caffix/recon"
+)
+
+// ErrCaseMismatch - The answers did not echo the randomized case of the query name
+var ErrCaseMismatch = errors.New("The DNS response did not match the case of the query name")
+
+// Use0x20 - Returns true if the letters of query names are randomly cased, and checked in the answers
+func (ds *DNSService) Use0x20() bool {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.use0x20
+}
+
+// SetUse0x20 - Causes the letters of each query name to be randomly cased (DNS 0x20 encoding), with
+// answers that do not echo the casing rejected with ErrCaseMismatch, so spoofed responses are retried
+func (ds *DNSService) SetUse0x20(enabled bool) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.use0x20 = enabled
+}
+
+// randomizeCase returns the name with each letter randomly upper or lower case
+func randomizeCase(name string, rng *lockedRand) string {
+	b := []rune(strings.ToLower(name))
+
+	// A single source is taken for the whole name, instead of one for each letter
+	rng.use(func(r *rand.Rand) {
+		for i, c := range b {
+			if unicode.IsLetter(c) && r.Intn(2) == 1 {
+				b[i] = unicode.ToUpper(c)
+			}
+		}
+	})
+	return string(b)
+}
+
+// verifyCase checks that the answers for the sent name echo its exact casing, and returns the
+// answers with the original name restored, so the casing does not leak into the results
+func verifyCase(name, sent string, answers []recon.DNSAnswer) ([]recon.DNSAnswer, error) {
+	var matched bool
+
+	result := make([]recon.DNSAnswer, 0, len(answers))
+	for _, a := range answers {
+		owner := strings.TrimSuffix(a.Name, ".")
+		if strings.EqualFold(owner, sent) {
+			if owner != sent {
+				return []recon.DNSAnswer{}, ErrCaseMismatch
+			}
+
+			matched = true
+			a.Name = name
+		}
+		result = append(result, a)
+	}
+
+	if !matched {
+		return []recon.DNSAnswer{}, ErrCaseMismatch
+	}
+	return result, nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/caffix/recon"
+)
+
+func TestUse0x20(t *testing.T) {
+	bad, good := "192.0.2.1:53", "192.0.2.2:53"
+
+	var sent []string
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		if qtype != "A" {
+			return nil, testNoRecords(name)
+		}
+		sent = append(sent, name)
+		// The bad server does not echo the casing of the query name
+		owner := name
+		if server == bad {
+			owner = strings.ToLower(name)
+		}
+		return []recon.DNSAnswer{{Name: owner, Type: 1, TTL: 60, Data: "192.0.2.100"}}, nil
+	})()
+	usableServers = []string{bad, good}
+
+	srv := NewDNSService(nil, nil)
+	srv.SetRand(rand.New(rand.NewSource(1)))
+	srv.SetUse0x20(true)
+	srv.SetSelectionMode(FallbackSelection)
+	srv.SetFallbackServers([]string{bad})
+	srv.SetRecordMode(RecordAOnly)
+
+	answers, server, err := srv.resolveName("example.com", "www.longername.example.com")
+	if err != nil || server != good {
+		t.Fatalf("The name was not resolved by a server echoing the casing: %v", err)
+	}
+	if answers[0].Name != "www.longername.example.com" {
+		t.Errorf("The randomized casing leaked into the answers: %s", answers[0].Name)
+	}
+
+	var mixed bool
+	for _, name := range sent {
+		if name != strings.ToLower(name) {
+			mixed = true
+		}
+	}
+	if !mixed {
+		t.Errorf("The case of the query names was not randomized: %v", sent)
+	}
+}
+
+func TestRandomizeCaseConcurrent(t *testing.T) {
+	rng := newLockedRand(nil)
+	name := "www.longername.example.com"
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 100; j++ {
+				if sent := randomizeCase(name, rng); !strings.EqualFold(sent, name) {
+					t.Errorf("The name was randomized to %s", sent)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// An injected source still produces the same casing
+	first := randomizeCase(name, newLockedRand(rand.New(rand.NewSource(1))))
+	if second := randomizeCase(name, newLockedRand(rand.New(rand.NewSource(1)))); first != second {
+		t.Errorf("The same source randomized the name to %s and %s", first, second)
+	}
+}
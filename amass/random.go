@@ -0,0 +1,86 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// lockedRand - Allows a random source to be shared by goroutines without using the global source.
+// Without an injected source, each caller takes a source from a pool, so the queries do not contend
+// for a single lock. An injected source is shared under the lock, so the sequence is reproducible
+type lockedRand struct {
+	sync.Mutex
+	r    *rand.Rand
+	pool *sync.Pool
+}
+
+func newLockedRand(r *rand.Rand) *lockedRand {
+	if r != nil {
+		return &lockedRand{r: r}
+	}
+
+	return &lockedRand{pool: &sync.Pool{
+		New: func() interface{} {
+			// The global source gives the sources created at the same time different seeds
+			return rand.New(rand.NewSource(time.Now().UnixNano() ^ rand.Int63()))
+		},
+	}}
+}
+
+// use calls the function with a source that no other goroutine uses until it returns
+func (lr *lockedRand) use(fn func(r *rand.Rand)) {
+	if lr.pool != nil {
+		r := lr.pool.Get().(*rand.Rand)
+		defer lr.pool.Put(r)
+
+		fn(r)
+		return
+	}
+
+	lr.Lock()
+	defer lr.Unlock()
+
+	fn(lr.r)
+}
+
+func (lr *lockedRand) Intn(n int) (v int) {
+	lr.use(func(r *rand.Rand) { v = r.Intn(n) })
+	return v
+}
+
+func (lr *lockedRand) Int63n(n int64) (v int64) {
+	lr.use(func(r *rand.Rand) { v = r.Int63n(n) })
+	return v
+}
+
+func (lr *lockedRand) Float64() (v float64) {
+	lr.use(func(r *rand.Rand) { v = r.Float64() })
+	return v
+}
+
+func (lr *lockedRand) Shuffle(n int, swap func(i, j int)) {
+	lr.use(func(r *rand.Rand) { r.Shuffle(n, swap) })
+}
+
+// The source used by NextNameserver
+var defaultRand = newLockedRand(nil)
+
+// SetRand - Sets the random source used to generate wildcard probes and select servers,
+// so the behavior of the service can be reproduced. A nil source is seeded from the time
+func (ds *DNSService) SetRand(r *rand.Rand) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.rng = newLockedRand(r)
+}
+
+func (ds *DNSService) random() *lockedRand {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.rng
+}
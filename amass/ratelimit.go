@@ -0,0 +1,132 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// tokenBucket - Tracks the queries that can be sent to a single server
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// serverLimiter - Provides each server with an independent query rate
+type serverLimiter struct {
+	sync.Mutex
+	rate    float64
+	buckets map[string]*tokenBucket
+}
+
+// The limiter applied to the queries of every service in the process
+var limiter = &serverLimiter{buckets: make(map[string]*tokenBucket)}
+
+// PerServerRate - Returns the number of queries permitted per second for each server
+func PerServerRate() float64 {
+	limiter.Lock()
+	defer limiter.Unlock()
+
+	return limiter.rate
+}
+
+// SetPerServerRate - Sets the number of queries permitted per second for each server, so a single
+// server does not receive bursts that trip its rate limits. Zero means no limit. Every query is
+// covered, including the retries, fallback, authoritative and confirmation queries.
+// The servers are shared by every DNSService in the process, and the rate covers their queries combined
+func SetPerServerRate(qps float64) {
+	limiter.Lock()
+	defer limiter.Unlock()
+
+	limiter.rate = qps
+	limiter.buckets = make(map[string]*tokenBucket)
+}
+
+// acquire selects one of the servers with available tokens, without taking a token, since the
+// token is taken by the query itself. When all the servers are limited, the time until a token
+// becomes available is returned instead
+func (l *serverLimiter) acquire(servers []string, choose func([]string) string) (string, time.Duration) {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.rate <= 0 {
+		return choose(servers), 0
+	}
+
+	now := time.Now()
+	wait := time.Duration(math.MaxInt64)
+	var available []string
+	for _, s := range servers {
+		if w := l.refill(s, now); w > 0 {
+			if w < wait {
+				wait = w
+			}
+			continue
+		}
+		available = append(available, s)
+	}
+
+	if len(available) == 0 {
+		return "", wait
+	}
+	return choose(available), 0
+}
+
+// take removes a token for a query sent to the server, or returns the time until a token
+// becomes available
+func (l *serverLimiter) take(server string) time.Duration {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.rate <= 0 {
+		return 0
+	}
+	if wait := l.refill(server, time.Now()); wait > 0 {
+		return wait
+	}
+	l.buckets[server].tokens--
+	return 0
+}
+
+// refill adds the tokens earned by the server since it was last checked, and returns
+// the time until it has a token, which is zero when a token is available
+func (l *serverLimiter) refill(server string, now time.Time) time.Duration {
+	burst := math.Max(1, l.rate)
+
+	b, found := l.buckets[server]
+	if !found {
+		b = &tokenBucket{tokens: burst, last: now}
+		l.buckets[server] = b
+	}
+
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// waitForToken blocks until the server can receive another query, or the service stops
+func (ds *DNSService) waitForToken(server string) error {
+	var done <-chan struct{}
+	if ds.ctx != nil {
+		done = ds.ctx.Done()
+	}
+
+	// The same server reached over another transport shares the rate
+	_, addr := transportOf(server)
+	for wait := limiter.take(addr); wait > 0; wait = limiter.take(addr) {
+		select {
+		case <-time.After(wait):
+		case <-done:
+			return ErrCanceled
+		case <-ds.Quit():
+			return ErrCanceled
+		}
+	}
+	return nil
+}
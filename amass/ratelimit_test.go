@@ -0,0 +1,55 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/caffix/recon"
+)
+
+func TestPerServerRate(t *testing.T) {
+	first, second := "192.0.2.1:53", "192.0.2.2:53"
+
+	var lock sync.Mutex
+	sent := make(map[string][]time.Time)
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		lock.Lock()
+		sent[server] = append(sent[server], time.Now())
+		lock.Unlock()
+		return nil, ErrTimeout
+	})()
+	defer SetPerServerRate(0)
+	usableServers = []string{first, second}
+	maxServerFailures = 1000
+
+	srv := NewDNSService(nil, nil)
+	srv.SetRecordMode(RecordAOnly)
+	srv.SetMaxRetries(1)
+	srv.SetCacheTTL(0)
+
+	// Each failed name is retried on the other server, and both queries take a token
+	SetPerServerRate(4)
+	for i := 0; i < 3; i++ {
+		srv.resolveName("example.com", "www.example.com")
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	for _, server := range []string{first, second} {
+		times := sent[server]
+		if len(times) <= 4 {
+			t.Fatalf("%s only received %d queries", server, len(times))
+		}
+		// A bucket holding four tokens that refill at four per second
+		for i := 4; i < len(times); i++ {
+			want := time.Duration(i-3) * time.Second / 4
+			if elapsed := times[i].Sub(times[0]); elapsed < want-20*time.Millisecond {
+				t.Errorf("%s received %d queries within %v", server, i+1, elapsed)
+			}
+		}
+	}
+}
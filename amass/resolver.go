@@ -0,0 +1,173 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"context"
+	"net"
+
+	"github.com/caffix/recon"
+	"github.com/miekg/dns"
+)
+
+// Resolver - Performs the individual DNS queries on behalf of the DNSService
+type Resolver interface {
+	Resolve(name, server, qtype string) ([]recon.DNSAnswer, error)
+}
+
+// ContextResolver - Implemented by resolvers that give up on a query by the deadline of the
+// context, which the DNSService uses so abandoned queries do not outlive the query timeout
+type ContextResolver interface {
+	ResolveContext(ctx context.Context, name, server, qtype string) ([]recon.DNSAnswer, error)
+}
+
+// TCPResolver - Implemented by resolvers that can repeat a query over TCP, which the
+// DNSService does when the response to the original query was truncated
+type TCPResolver interface {
+	ResolveTCP(name, server, qtype string) ([]recon.DNSAnswer, error)
+}
+
+// EDNSOptions - The EDNS0 settings included with each query
+type EDNSOptions struct {
+	// The UDP payload size advertised to the server, where zero uses 4096 bytes
+	UDPSize uint16
+
+	// The client subnet sent to the server, which affects the answers of many CDNs
+	ClientSubnet *net.IPNet
+}
+
+// apply adds the OPT record to the message and returns the UDP payload size
+func (o *EDNSOptions) apply(msg *dns.Msg) uint16 {
+	size := o.UDPSize
+	if size == 0 {
+		size = dns.DefaultMsgSize
+	}
+
+	msg.SetEdns0(size, false)
+	if opt := msg.IsEdns0(); opt != nil && o.ClientSubnet != nil {
+		ones, _ := o.ClientSubnet.Mask.Size()
+
+		subnet := &dns.EDNS0_SUBNET{
+			Code:          dns.EDNS0SUBNET,
+			Family:        1,
+			SourceNetmask: uint8(ones),
+			Address:       o.ClientSubnet.IP.To4(),
+		}
+		if subnet.Address == nil {
+			subnet.Family = 2
+			subnet.Address = o.ClientSubnet.IP
+		}
+		opt.Option = append(opt.Option, subnet)
+	}
+	return size
+}
+
+// DefaultResolver - Sends the queries using recon, or over the transport selected by the server scheme.
+// When EDNS0 options have been provided, the UDP queries are sent using the miekg/dns client instead
+type DefaultResolver struct {
+	EDNS *EDNSOptions
+}
+
+// Resolve - Performs the query over the transport selected by the server
+func (r DefaultResolver) Resolve(name, server, qtype string) ([]recon.DNSAnswer, error) {
+	return r.ResolveContext(context.Background(), name, server, qtype)
+}
+
+// ResolveContext - Performs the query over the transport selected by the server, giving up by the deadline of the context
+func (r DefaultResolver) ResolveContext(ctx context.Context, name, server, qtype string) ([]recon.DNSAnswer, error) {
+	return exchange(ctx, name, server, qtype, r.EDNS)
+}
+
+// ResolveTCP - Performs the query over TCP when the server would be queried over UDP
+func (r DefaultResolver) ResolveTCP(name, server, qtype string) ([]recon.DNSAnswer, error) {
+	return r.resolveTCPContext(context.Background(), name, server, qtype)
+}
+
+func (r DefaultResolver) resolveTCPContext(ctx context.Context, name, server, qtype string) ([]recon.DNSAnswer, error) {
+	if transport, addr := transportOf(server); transport == TransportUDP {
+		return clientQuery(ctx, "tcp", name, addr, qtype, r.EDNS)
+	}
+	return exchange(ctx, name, server, qtype, r.EDNS)
+}
+
+// ClientResolver - Sends all the queries using the miekg/dns client, over the transport selected by
+// the server scheme. Unlike recon, the client stops waiting on the network by the deadline of the
+// context, so abandoned queries do not keep running in the background
+type ClientResolver struct {
+	EDNS *EDNSOptions
+}
+
+// Resolve - Performs the query over the transport selected by the server
+func (r ClientResolver) Resolve(name, server, qtype string) ([]recon.DNSAnswer, error) {
+	return r.ResolveContext(context.Background(), name, server, qtype)
+}
+
+// ResolveContext - Performs the query over the transport selected by the server, giving up by the deadline of the context
+func (r ClientResolver) ResolveContext(ctx context.Context, name, server, qtype string) ([]recon.DNSAnswer, error) {
+	if transport, addr := transportOf(server); transport == TransportUDP {
+		return clientQuery(ctx, "udp", name, addr, qtype, r.EDNS)
+	}
+	return exchange(ctx, name, server, qtype, r.EDNS)
+}
+
+// ResolveTCP - Performs the query over TCP when the server would be queried over UDP
+func (r ClientResolver) ResolveTCP(name, server, qtype string) ([]recon.DNSAnswer, error) {
+	return r.resolveTCPContext(context.Background(), name, server, qtype)
+}
+
+func (r ClientResolver) resolveTCPContext(ctx context.Context, name, server, qtype string) ([]recon.DNSAnswer, error) {
+	return DefaultResolver{EDNS: r.EDNS}.resolveTCPContext(ctx, name, server, qtype)
+}
+
+// tcpContextResolver is implemented by the resolvers repeating truncated queries by the deadline of the context
+type tcpContextResolver interface {
+	resolveTCPContext(ctx context.Context, name, server, qtype string) ([]recon.DNSAnswer, error)
+}
+
+// Public DNS-over-HTTPS endpoints providing the JSON API
+const (
+	GoogleDoH     = "https://dns.google.com/resolve"
+	CloudflareDoH = "https://cloudflare-dns.com/dns-query"
+)
+
+// DoHResolver - Sends all the queries to a DNS-over-HTTPS endpoint, for networks where plain DNS
+// is blocked or monitored. The servers selected by the service are ignored, while the query
+// timeout and retries still apply
+type DoHResolver struct {
+	// The URL of the JSON API, such as GoogleDoH or CloudflareDoH
+	Endpoint string
+
+	// Only the client subnet is sent to the endpoint
+	EDNS *EDNSOptions
+}
+
+// Resolve - Performs the query using the JSON API of the endpoint
+func (r DoHResolver) Resolve(name, server, qtype string) ([]recon.DNSAnswer, error) {
+	return r.ResolveContext(context.Background(), name, server, qtype)
+}
+
+// ResolveContext - Performs the query using the JSON API of the endpoint, giving up by the deadline of the context
+func (r DoHResolver) ResolveContext(ctx context.Context, name, server, qtype string) ([]recon.DNSAnswer, error) {
+	return dohQuery(ctx, name, r.Endpoint, qtype, r.EDNS)
+}
+
+// Resolver - Returns the resolver performing the queries of the service
+func (ds *DNSService) Resolver() Resolver {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.resolver
+}
+
+// SetResolver - Replaces the resolver performing the queries of the service,
+// and nil restores the DefaultResolver
+func (ds *DNSService) SetResolver(r Resolver) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	if r == nil {
+		r = DefaultResolver{}
+	}
+	ds.resolver = r
+}
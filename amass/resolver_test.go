@@ -0,0 +1,161 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/caffix/recon"
+)
+
+type mockResolver struct {
+	sync.Mutex
+	queries []string
+}
+
+func (m *mockResolver) Resolve(name, server, qtype string) ([]recon.DNSAnswer, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.queries = append(m.queries, name)
+	if name != "www.example.com" {
+		return nil, testNXDOMAIN(name)
+	}
+	if qtype == "A" {
+		return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "192.0.2.1"}}, nil
+	}
+	return nil, testNoRecords(name)
+}
+
+func TestSetResolver(t *testing.T) {
+	// Fail loudly if the package-level resolver is used instead of the mock
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		t.Errorf("The query for %s bypassed the resolver of the service", name)
+		return nil, testNXDOMAIN(name)
+	})()
+
+	m := new(mockResolver)
+	srv := NewDNSService(nil, nil)
+	srv.SetResolver(m)
+	srv.SetRecordMode(RecordAOnly)
+
+	answers, err := srv.dnsQuery("example.com", "www.example.com", "192.0.2.1:53")
+	if err != nil || recon.GetARecordData(answers) != "192.0.2.1" {
+		t.Errorf("The mock resolver answer was not returned: %v", err)
+	}
+	if len(m.queries) == 0 {
+		t.Errorf("The mock resolver did not receive the query")
+	}
+
+	srv.SetResolver(nil)
+	if _, ok := srv.Resolver().(DefaultResolver); !ok {
+		t.Errorf("Setting a nil resolver did not restore the default")
+	}
+}
+
+func TestClientSubnetDoH(t *testing.T) {
+	var subnet string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subnet = r.URL.Query().Get("edns_client_subnet")
+		fmt.Fprint(w, `{"Status":0,"TC":false,"Answer":[{"name":"www.example.com.","type":1,"TTL":60,"data":"203.0.113.9"}]}`)
+	}))
+	defer ts.Close()
+
+	_, ipnet, _ := net.ParseCIDR("198.51.100.0/24")
+	answers, err := dohQuery(context.Background(), "www.example.com", ts.URL, "A", &EDNSOptions{ClientSubnet: ipnet})
+	if err != nil || len(answers) != 1 || answers[0].Data != "203.0.113.9" {
+		t.Errorf("The DoH query failed: %v", err)
+	}
+	if subnet != "198.51.100.0/24" {
+		t.Errorf("The client subnet was sent as %q", subnet)
+	}
+}
+
+func TestDoHResolver(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("type") != "A" || q.Get("name") != "www.example.com" {
+			fmt.Fprint(w, `{"Status":0,"TC":false}`)
+			return
+		}
+		fmt.Fprint(w, `{"Status":0,"TC":false,"Answer":[{"name":"www.example.com.","type":1,"TTL":60,"data":"203.0.113.9"}]}`)
+	}))
+	defer ts.Close()
+
+	srv := NewDNSService(nil, nil)
+	srv.SetResolver(DoHResolver{Endpoint: ts.URL})
+	srv.SetRecordMode(RecordAOnly)
+
+	answers, err := srv.dnsQuery("example.com", "www.example.com", "192.0.2.1:53")
+	if err != nil || recon.GetARecordData(answers) != "203.0.113.9" {
+		t.Errorf("The name was not resolved through the DoH endpoint: %v", err)
+	}
+}
+
+type truncatingResolver struct {
+	sync.Mutex
+	tcp int
+}
+
+func (r *truncatingResolver) Resolve(name, server, qtype string) ([]recon.DNSAnswer, error) {
+	return nil, errors.New("dns: response truncated")
+}
+
+func (r *truncatingResolver) ResolveTCP(name, server, qtype string) ([]recon.DNSAnswer, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.tcp++
+	if qtype != "A" {
+		return nil, testNoRecords(name)
+	}
+	return []recon.DNSAnswer{
+		{Name: name, Type: 1, TTL: 60, Data: "192.0.2.1"},
+		{Name: name, Type: 1, TTL: 60, Data: "192.0.2.2"},
+	}, nil
+}
+
+type udpOnlyResolver struct{}
+
+func (udpOnlyResolver) Resolve(name, server, qtype string) ([]recon.DNSAnswer, error) {
+	return nil, ErrTruncated
+}
+
+func TestTruncatedRetry(t *testing.T) {
+	r := new(truncatingResolver)
+	srv := NewDNSService(nil, nil)
+	srv.SetResolver(r)
+	srv.SetRecordMode(RecordAOnly)
+
+	answers, err := srv.dnsQuery("example.com", "www.example.com", "192.0.2.53:53")
+	if err != nil || len(addressSet(answers).ToStrings()) != 2 {
+		t.Errorf("The truncated query was not repeated over TCP: %v %v", answers, err)
+	}
+	if r.tcp == 0 {
+		t.Errorf("The TCP resolution was not used")
+	}
+
+	// Resolvers without TCP support report the truncation
+	srv.SetResolver(udpOnlyResolver{})
+	if _, err := srv.query("www.example.com", "192.0.2.53:53", "A"); err != ErrTruncated {
+		t.Errorf("The truncated response returned %v", err)
+	}
+}
+
+func TestClientResolver(t *testing.T) {
+	addr, stop := startCAAServer(t)
+	defer stop()
+
+	answers, err := ClientResolver{}.Resolve("example.com", addr, "CAA")
+	if err != nil || len(answers) != 1 || answers[0].Type != 257 {
+		t.Errorf("The CAA record was not obtained through the client: %v", err)
+	}
+}
@@ -264,10 +264,11 @@ func (l *reverseDNSLookup) Search(domain, ip string, done chan int) {
 	if err == nil && re.MatchString(name) {
 		// Send the name to be resolved in the forward direction
 		l.Output <- &AmassRequest{
-			Name:   name,
-			Domain: domain,
-			Tag:    DNS,
-			Source: l.Name,
+			Name:       name,
+			Domain:     domain,
+			Tag:        DNS,
+			Source:     l.Name,
+			Provenance: ProvenanceReverseDNS,
 		}
 		done <- 1
 	}
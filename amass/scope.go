@@ -0,0 +1,92 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"strings"
+)
+
+// OutOfScopeOutput - Returns the channel receiving the names discovered outside of the domain
+func (ds *DNSService) OutOfScopeOutput() chan *AmassRequest {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.outOfScope
+}
+
+// SetOutOfScopeOutput - Sets the channel receiving the names discovered outside of the domain, such
+// as the third-party targets in the CNAME chains and the mail exchangers. The names are marked as out
+// of scope and are not resolved. Without the channel, only the mail exchangers are reported, through
+// the regular output
+func (ds *DNSService) SetOutOfScopeOutput(out chan *AmassRequest) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.outOfScope = out
+}
+
+// sendOutOfScope delivers the name to the out of scope channel, returning false when it has not been set
+func (ds *DNSService) sendOutOfScope(req *AmassRequest) bool {
+	out := ds.OutOfScopeOutput()
+	if out == nil {
+		return false
+	}
+
+	req.OutOfScope = true
+	ds.goWork(func() {
+		select {
+		case out <- req:
+		case <-ds.Quit():
+		}
+	})
+	return true
+}
+
+// ScopeDomains - Returns the additional domains considered in scope
+func (ds *DNSService) ScopeDomains() []string {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return append([]string{}, ds.scopeDomains...)
+}
+
+// SetScopeDomains - Sets the domains considered in scope in addition to the domain of each request,
+// so a single service can enumerate an organization owning several root domains. Names discovered
+// within any of the domains are resolved, while the domain of the request still targets the queries
+func (ds *DNSService) SetScopeDomains(domains []string) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.scopeDomains = nil
+	for _, d := range domains {
+		if d = strings.Trim(strings.ToLower(d), "."); d != "" {
+			ds.scopeDomains = append(ds.scopeDomains, d)
+		}
+	}
+}
+
+// scopeOf returns the domain the name is within, starting with the domain of the request,
+// or an empty string when the name is out of scope. Every name discovered by the service
+// is checked here before being queued or emitted as in scope
+func (ds *DNSService) scopeOf(name, domain string) string {
+	if withinDomain(name, domain) {
+		return domain
+	}
+
+	for _, d := range ds.ScopeDomains() {
+		if withinDomain(name, d) {
+			return d
+		}
+	}
+	return ""
+}
+
+// withinDomain returns true when the name is the domain or one of its subdomains, ignoring case
+// and trailing dots, so notexample.com is not mistaken for a subdomain of example.com
+func withinDomain(name, domain string) bool {
+	name = strings.Trim(strings.ToLower(name), ".")
+	domain = strings.Trim(strings.ToLower(domain), ".")
+
+	return domain != "" && (name == domain || strings.HasSuffix(name, "."+domain))
+}
@@ -0,0 +1,98 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"testing"
+	"time"
+
+	"github.com/caffix/recon"
+)
+
+func TestScopeDomains(t *testing.T) {
+	srv := NewDNSService(nil, nil)
+	srv.SetScopeDomains([]string{"Example.ORG."})
+
+	srv.sendSPFNames(&AmassRequest{
+		Name:   "example.com",
+		Domain: "example.com",
+	}, []string{"v=spf1 include:_spf.example.org include:mail.other.net a:mx.example.com -all"})
+
+	domains := make(map[string]string)
+	for len(srv.requeue) > 0 {
+		req := <-srv.requeue
+		domains[req.Name] = req.Domain
+	}
+	if len(domains) != 2 {
+		t.Fatalf("The in-scope names were not queued: %v", domains)
+	}
+	if domains["_spf.example.org"] != "example.org" || domains["mx.example.com"] != "example.com" {
+		t.Errorf("The names were queued with the wrong domains: %v", domains)
+	}
+}
+
+func TestScopeBoundary(t *testing.T) {
+	srv := NewDNSService(nil, nil)
+	srv.SetScopeDomains([]string{"example.org"})
+
+	tests := []struct {
+		name, expected string
+	}{
+		{"www.example.com", "example.com"},
+		{"WWW.Example.COM.", "example.com"},
+		{"example.com", "example.com"},
+		{"notexample.com", ""},
+		{"www.notexample.com", ""},
+		{"mail.example.org", "example.org"},
+		{"badexample.org", ""},
+	}
+	for _, test := range tests {
+		if d := srv.scopeOf(test.name, "example.com"); d != test.expected {
+			t.Errorf("%s was placed within %q instead of %q", test.name, d, test.expected)
+		}
+	}
+}
+
+func TestOutOfScopeOutput(t *testing.T) {
+	srv, out, done := newTestService(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		switch {
+		case qtype == "CNAME" && name == "a.example.com":
+			return []recon.DNSAnswer{{Name: name, Type: 5, TTL: 60, Data: "c.provider.net"}}, nil
+		case qtype == "A" && name == "c.provider.net":
+			return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "203.0.113.5"}}, nil
+		}
+		return nil, testNoRecords(name)
+	})
+	defer done()
+
+	related := make(chan *AmassRequest, 10)
+	srv.SetRecordMode(RecordAOnly)
+	srv.SetOutOfScopeOutput(related)
+	srv.Start()
+
+	srv.performDNSRequest(&AmassRequest{Name: "a.example.com", Domain: "example.com", Tag: SEARCH})
+
+	select {
+	case req := <-related:
+		if req.Name != "c.provider.net" || !req.OutOfScope || req.Provenance != ProvenanceCNAME {
+			t.Errorf("The out of scope name was reported as %+v", req)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("The out of scope name was not reported")
+	}
+
+	select {
+	case req := <-out:
+		if req.Name != "a.example.com" || req.OutOfScope {
+			t.Errorf("The in-scope result was reported as %+v", req)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("The in-scope name was not reported")
+	}
+	select {
+	case req := <-out:
+		t.Errorf("The out of scope name %s was included in the results", req.Name)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -7,6 +7,9 @@ import (
 	"errors"
 	"net"
 	"sync"
+	"time"
+
+	"github.com/caffix/recon"
 )
 
 // AmassRequest - Contains data obtained throughout AmassService processing
@@ -20,6 +23,9 @@ type AmassRequest struct {
 	// The IP address that the name resolves to
 	Address string
 
+	// All the IPv4 and IPv6 addresses that the name resolves to
+	Addresses []string
+
 	// The netblock that the address belongs to
 	Netblock *net.IPNet
 
@@ -32,10 +38,82 @@ type AmassRequest struct {
 	// The type of data source that discovered the name
 	Tag string
 
+	// How the name was discovered, which determines the Tag for the names found by the DNS service
+	Provenance Provenance
+
 	// The exact data source that discovered the name
 	Source string
+
+	// The discovery round, where names derived from an earlier result are one round later
+	Round int
+
+	// Requests that reach the front of the queue after the deadline are dropped. The zero value means no deadline
+	Deadline time.Time
+
+	// Set when the name resolved to different addresses directly and through a CNAME chain
+	Conflict bool
+
+	// Set when the CNAME chain was longer than the maximum depth, and the addresses
+	// are those of the name reached at the maximum depth
+	Truncated bool
+
+	// The address the name is expected to resolve to, when verifying a known inventory
+	Expected string
+
+	// The result of comparing the resolved addresses with the expected address
+	Validation ValidationStatus
+
+	// Set when the recursive and authoritative servers provided different answers
+	Discrepancy *Discrepancy
+
+	// The transports that provided answers when resolving over several of them
+	Transports []string
+
+	// Set for related names, such as mail exchangers, that are outside of the domain
+	OutOfScope bool
+
+	// All the DNS answers obtained while resolving the name, including the CNAME chain
+	Records []recon.DNSAnswer
+
+	// The names followed through the CNAME chain, starting with this name, when it had a CNAME record
+	Chain []ChainHop
+
+	// The TXT record strings of the name, when SPF parsing has been enabled
+	TXT []string
+
+	// The smallest TTL, in seconds, among the answers obtained while resolving the name
+	TTL int
+
+	// The nameserver that provided the answers, after any retries on other servers
+	Server string
+
+	// The start of authority for the zone containing the name, when SOA lookups have been enabled
+	SOA *SOARecord
+
+	// Set when the name has a CNAME record with a target that does not exist
+	Dangling *DanglingCNAME
+
+	// Set when the name was emitted before the wildcard detection completed, and may be retracted
+	Provisional bool
 }
 
+// ValidationStatus - The outcome of resolving a name that has an expected address
+type ValidationStatus int
+
+const (
+	// The request did not carry an expected address
+	ValidationNone ValidationStatus = iota
+
+	// The expected address was among the resolved addresses
+	ValidationMatched
+
+	// The name resolved, but not to the expected address
+	ValidationMismatched
+
+	// The name no longer resolves
+	ValidationMissing
+)
+
 type AmassService interface {
 	// Start the service
 	Start() error
@@ -69,8 +147,12 @@ type BaseAmassService struct {
 	input   <-chan *AmassRequest
 	output  chan<- *AmassRequest
 	active  bool
+	paused  bool
 	quit    chan struct{}
 
+	// Claimed by the first call to Stop, so concurrent callers cannot both close quit
+	stopping bool
+
 	// The specific service embedding BaseAmassService
 	service AmassService
 }
@@ -97,10 +179,16 @@ func (bas *BaseAmassService) OnStart() error {
 }
 
 func (bas *BaseAmassService) Stop() error {
-	if bas.IsStopped() {
+	bas.Lock()
+	if bas.stopping {
+		bas.Unlock()
 		return errors.New(bas.name + " service has already been stopped")
 	}
+	bas.stopping = true
+	bas.Unlock()
+
 	err := bas.service.OnStop()
+	bas.SetStopped()
 	close(bas.quit)
 	return err
 }
@@ -131,6 +219,29 @@ func (bas *BaseAmassService) SetActive(active bool) {
 	bas.active = active
 }
 
+// Pause causes the service to stop processing its work, while continuing to accept input
+func (bas *BaseAmassService) Pause() {
+	bas.Lock()
+	defer bas.Unlock()
+
+	bas.paused = true
+}
+
+// Resume causes a paused service to continue processing its work
+func (bas *BaseAmassService) Resume() {
+	bas.Lock()
+	defer bas.Unlock()
+
+	bas.paused = false
+}
+
+func (bas *BaseAmassService) IsPaused() bool {
+	bas.Lock()
+	defer bas.Unlock()
+
+	return bas.paused
+}
+
 func (bas *BaseAmassService) Quit() <-chan struct{} {
 	return bas.quit
 }
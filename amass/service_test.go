@@ -0,0 +1,108 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/caffix/recon"
+)
+
+func TestPauseResume(t *testing.T) {
+	var lock sync.Mutex
+	var queried int
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		// The nameserver and SRV lookups for the new domain are not taken from the queue
+		if qtype == "A" || qtype == "CNAME" {
+			queried++
+		}
+		return nil, testNXDOMAIN(name)
+	})()
+
+	in := make(chan *AmassRequest)
+	srv := NewDNSService(in, make(chan *AmassRequest, 10))
+	srv.SetWildcardDetection(false)
+	srv.Start()
+	defer srv.Stop()
+
+	srv.Pause()
+	if !srv.IsPaused() {
+		t.Errorf("The service was not reported as paused")
+	}
+	for _, name := range []string{"a.example.com", "b.example.com", "c.example.com"} {
+		in <- &AmassRequest{Name: name, Domain: "example.com", Tag: SEARCH}
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	lock.Lock()
+	if queried != 0 {
+		t.Errorf("%d queries were sent while the service was paused", queried)
+	}
+	lock.Unlock()
+	if depth := srv.QueueDepth(); depth != 3 {
+		t.Errorf("The queue held %d names while paused instead of 3", depth)
+	}
+
+	srv.Resume()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.WaitUntilIdle(ctx); err != nil {
+		t.Fatalf("WaitUntilIdle returned %v", err)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if queried == 0 {
+		t.Errorf("The queued names were not resolved after resuming")
+	}
+}
+
+func TestConcurrentStop(t *testing.T) {
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		time.Sleep(200 * time.Millisecond)
+		return nil, testNXDOMAIN(name)
+	})()
+
+	in := make(chan *AmassRequest)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv := NewDNSServiceWithContext(ctx, in, make(chan *AmassRequest, 10))
+	srv.SetWildcardDetection(false)
+	srv.SetDrainOnStop(true)
+	srv.Start()
+
+	in <- &AmassRequest{Name: "www.example.com", Domain: "example.com", Tag: SEARCH}
+
+	// The drain keeps the first Stop busy while the context and a second caller try to stop the service
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			errs <- srv.Stop()
+		}()
+	}
+	cancel()
+
+	var stopped int
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err == nil {
+			stopped++
+		}
+	}
+	if stopped > 1 {
+		t.Errorf("The service was stopped by %d callers", stopped)
+	}
+	select {
+	case <-srv.Quit():
+	case <-time.After(5 * time.Second):
+		t.Errorf("The service did not finish stopping")
+	}
+	if !srv.IsStopped() {
+		t.Errorf("The service was not reported as stopped")
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"strings"
+)
+
+// SOARecord - The start of authority for the zone containing a name
+type SOARecord struct {
+	// The apex of the zone
+	Zone string
+
+	// The primary nameserver of the zone
+	PrimaryNS string
+
+	// The email address responsible for the zone
+	Contact string
+
+	Serial uint32
+}
+
+// LookupSOA - Returns true if the zone of each resolved name is determined using SOA queries
+func (ds *DNSService) LookupSOA() bool {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.lookupSOA
+}
+
+// SetLookupSOA - Causes the zone of each resolved name to be determined using SOA queries, and
+// attached to the result. Names in the CNAME chain that are within the domain, but in a delegated
+// zone with a different primary nameserver and contact, are then not reported as part of the domain
+func (ds *DNSService) SetLookupSOA(enabled bool) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.lookupSOA = enabled
+}
+
+// zoneOf - Finds the zone containing the name, by walking up the labels until an SOA record is found
+func (ds *DNSService) zoneOf(name, server string) (*SOARecord, error) {
+	err := ErrNoRecords
+
+	for n := strings.ToLower(strings.TrimSuffix(name, ".")); strings.Contains(n, "."); {
+		answers, qerr := ds.cachedQuery(n, server, "SOA")
+		if qerr != nil {
+			err = ClassifyError(qerr)
+		}
+
+		for _, a := range answers {
+			// Some resolvers provide the SOA of the enclosing zone for names below the apex
+			if a.Type != 6 || !strings.EqualFold(strings.TrimSuffix(a.Name, "."), n) {
+				continue
+			}
+			if soa, ok := parseSOA(n, a.Data); ok {
+				return soa, nil
+			}
+		}
+		n = n[strings.Index(n, ".")+1:]
+	}
+	return nil, err
+}
+
+// sameOwnership checks that the name does not belong to a zone delegated to a different owner
+// than the domain. Names are assumed to be in scope when the zones cannot be determined
+func (ds *DNSService) sameOwnership(name, domain, server string) bool {
+	zone, err := ds.zoneOf(name, server)
+	if err != nil {
+		return true
+	}
+
+	apex, err := ds.zoneOf(domain, server)
+	if err != nil || zone.Zone == apex.Zone {
+		return true
+	}
+	return zone.PrimaryNS == apex.PrimaryNS || zone.Contact == apex.Contact
+}
+
+// parseSOA builds the SOARecord for the zone from SOA record data
+func parseSOA(zone, data string) (*SOARecord, bool) {
+	fields := soaFields(data)
+	if len(fields) < 2 {
+		return nil, false
+	}
+
+	soa := &SOARecord{
+		Zone:      zone,
+		PrimaryNS: strings.ToLower(strings.TrimSuffix(fields[0], ".")),
+		Contact:   soaContact(fields[1]),
+	}
+	if serial, ok := soaSerial(data); ok {
+		soa.Serial = serial
+	}
+	return soa, true
+}
+
+// soaContact converts the responsible mailbox into an email address,
+// where the first unescaped dot separates the local part
+func soaContact(mbox string) string {
+	mbox = strings.TrimSuffix(mbox, ".")
+
+	for i := 0; i < len(mbox); i++ {
+		switch mbox[i] {
+		case '\\':
+			i++
+		case '.':
+			local := strings.Replace(mbox[:i], "\\.", ".", -1)
+			return local + "@" + mbox[i+1:]
+		}
+	}
+	return mbox
+}
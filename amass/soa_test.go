@@ -0,0 +1,74 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"testing"
+	"time"
+
+	"github.com/caffix/recon"
+)
+
+func TestLookupSOA(t *testing.T) {
+	srv, out, done := newTestService(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		switch {
+		case qtype == "SOA" && name == "example.com":
+			return []recon.DNSAnswer{{Name: name, Type: 6, TTL: 60,
+				Data: "ns1.example.com. hostmaster.example.com. 2018010101 7200 3600 1209600 300"}}, nil
+		case qtype == "SOA" && name == "sub.example.com":
+			return []recon.DNSAnswer{{Name: name, Type: 6, TTL: 60,
+				Data: "ns1.provider.net. dns.provider.net. 7 7200 3600 1209600 300"}}, nil
+		case qtype == "CNAME" && name == "www.example.com":
+			return []recon.DNSAnswer{{Name: name, Type: 5, TTL: 60, Data: "cdn.sub.example.com"}}, nil
+		case qtype == "A" && name == "cdn.sub.example.com":
+			return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "203.0.113.5"}}, nil
+		}
+		return nil, testNoRecords(name)
+	})
+	defer done()
+
+	srv.SetRecordMode(RecordAOnly)
+	srv.SetLookupSOA(true)
+	srv.Start()
+
+	srv.performDNSRequest(&AmassRequest{Name: "www.example.com", Domain: "example.com", Tag: SEARCH})
+
+	results := make(map[string]*AmassRequest)
+	timeout := time.After(500 * time.Millisecond)
+loop:
+	for {
+		select {
+		case req := <-out:
+			results[req.Name] = req
+		case <-timeout:
+			break loop
+		}
+	}
+
+	www, found := results["www.example.com"]
+	if !found {
+		t.Fatalf("The requested name was not returned")
+	}
+	if soa := www.SOA; soa == nil || soa.Zone != "example.com" ||
+		soa.PrimaryNS != "ns1.example.com" || soa.Contact != "hostmaster@example.com" || soa.Serial != 2018010101 {
+		t.Errorf("The zone of the name was not reported: %+v", www.SOA)
+	}
+	if _, found := results["cdn.sub.example.com"]; found {
+		t.Errorf("The name in the zone delegated to another owner was reported")
+	}
+}
+
+func TestSOAContact(t *testing.T) {
+	tests := map[string]string{
+		"hostmaster.example.com.": "hostmaster@example.com",
+		"john\\.doe.example.com.": "john.doe@example.com",
+		"nodots":                  "nodots",
+	}
+
+	for mbox, expected := range tests {
+		if got := soaContact(mbox); got != expected {
+			t.Errorf("soaContact(%q) returned %q instead of %q", mbox, got, expected)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"strings"
+)
+
+// The SPF mechanisms and modifiers that reference hostnames
+var spfHostPrefixes = []string{"include:", "a:", "mx:", "exists:", "redirect="}
+
+// ParseSPF - Returns true if TXT records are obtained for resolved names and parsed for SPF hostnames
+func (ds *DNSService) ParseSPF() bool {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.parseSPF
+}
+
+// SetParseSPF - Causes the TXT records of each resolved name to be obtained and attached to the
+// result, with the hostnames referenced by SPF records queued for resolution when within the domain
+func (ds *DNSService) SetParseSPF(enabled bool) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.parseSPF = enabled
+}
+
+// dnsQueryTXT - Obtains the TXT record strings for the name
+func (ds *DNSService) dnsQueryTXT(name, server string) ([]string, error) {
+	answers, err := ds.query(name, server, "TXT")
+	if err != nil {
+		return []string{}, queryError(err)
+	}
+
+	var txt []string
+	for _, a := range answers {
+		if a.Type == 16 {
+			txt = append(txt, a.Data)
+		}
+	}
+	return txt, nil
+}
+
+// sendSPFNames queues the hostnames within the domain that are referenced by the SPF records
+func (ds *DNSService) sendSPFNames(req *AmassRequest, txt []string) {
+	for _, record := range txt {
+		for _, host := range spfHosts(record) {
+			if host == req.Name {
+				continue
+			}
+
+			if domain := ds.scopeOf(host, req.Domain); domain != "" {
+				ds.queueName(discovered(ProvenanceSPF, host, domain, req.Round+1))
+			}
+		}
+	}
+}
+
+// spfHosts returns the hostnames referenced by the mechanisms and modifiers of an SPF record
+func spfHosts(record string) []string {
+	var hosts []string
+
+	fields := strings.Fields(strings.ToLower(strings.Trim(record, "\"")))
+	if len(fields) == 0 || fields[0] != "v=spf1" {
+		return hosts
+	}
+
+	for _, field := range fields[1:] {
+		// Remove the qualifier
+		field = strings.TrimLeft(field, "+-~?")
+
+		for _, prefix := range spfHostPrefixes {
+			if !strings.HasPrefix(field, prefix) {
+				continue
+			}
+			// Remove the CIDR length used by the a and mx mechanisms
+			host := strings.SplitN(strings.TrimPrefix(field, prefix), "/", 2)[0]
+			host = strings.TrimSuffix(host, ".")
+			// Hostnames built with macros cannot be resolved directly
+			if validTarget(host) {
+				hosts = UniqueAppend(hosts, host)
+			}
+			break
+		}
+	}
+	return hosts
+}
@@ -0,0 +1,28 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"testing"
+)
+
+func TestSPFHosts(t *testing.T) {
+	record := "v=spf1 ip4:192.0.2.0/24 include:_spf.example.com a:mail.example.com/28 " +
+		"~mx:mx.example.com exists:%{i}.spf.example.com redirect=spf.provider.net -all"
+
+	hosts := spfHosts(record)
+	expected := []string{"_spf.example.com", "mail.example.com", "mx.example.com", "spf.provider.net"}
+	if len(hosts) != len(expected) {
+		t.Fatalf("The SPF record provided the hosts %v", hosts)
+	}
+	for i, host := range expected {
+		if hosts[i] != host {
+			t.Errorf("The SPF record provided %s instead of %s", hosts[i], host)
+		}
+	}
+
+	if hosts := spfHosts("google-site-verification=abc include:other.example.com"); len(hosts) != 0 {
+		t.Errorf("A TXT record without SPF provided the hosts %v", hosts)
+	}
+}
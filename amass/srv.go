@@ -0,0 +1,85 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"strings"
+
+	"github.com/caffix/recon"
+)
+
+// DefaultSRVProbes are the service labels queried for SRV records under each domain
+var DefaultSRVProbes = []string{
+	"_sip._tcp",
+	"_sip._udp",
+	"_sips._tcp",
+	"_ldap._tcp",
+	"_kerberos._tcp",
+	"_kerberos._udp",
+	"_gc._tcp",
+	"_autodiscover._tcp",
+	"_xmpp-client._tcp",
+	"_xmpp-server._tcp",
+	"_caldav._tcp",
+	"_carddav._tcp",
+	"_imaps._tcp",
+	"_submission._tcp",
+}
+
+// SRVProbes - Returns the service labels queried for SRV records under each domain
+func (ds *DNSService) SRVProbes() []string {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.srvProbes
+}
+
+// SetSRVProbes - Sets the service labels, such as _sip._tcp, queried for SRV records under each
+// domain, and DefaultSRVProbes provides a common set. The targets in scope are queued for
+// resolution. The probes are disabled by default, and an empty list disables them again
+func (ds *DNSService) SetSRVProbes(probes []string) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.srvProbes = probes
+}
+
+// dnsQuerySRV - Obtains the SRV records for the name, with the target hostnames as the data
+func (ds *DNSService) dnsQuerySRV(name, server string) ([]recon.DNSAnswer, error) {
+	answers, err := ds.query(name, server, "SRV")
+	if err != nil {
+		return []recon.DNSAnswer{}, queryError(err)
+	}
+
+	var srv []recon.DNSAnswer
+	for _, a := range answers {
+		// The priority, weight and port may be provided along with the target
+		fields := strings.Fields(a.Data)
+		if len(fields) == 0 || !validTarget(fields[len(fields)-1]) {
+			continue
+		}
+
+		a.Data = strings.TrimSuffix(fields[len(fields)-1], ".")
+		srv = append(srv, a)
+	}
+	return srv, nil
+}
+
+// sendSRVTargets queues the targets of the SRV records under the domain that are in scope
+func (ds *DNSService) sendSRVTargets(domain string, round int) {
+	server := ds.nextNameserver()
+
+	for _, probe := range ds.SRVProbes() {
+		answers, err := ds.dnsQuerySRV(probe+"."+domain, server)
+		if err != nil {
+			continue
+		}
+
+		for _, a := range answers {
+			if d := ds.scopeOf(a.Data, domain); d != "" {
+				ds.queueName(discovered(ProvenanceSRV, a.Data, d, round+1))
+			}
+		}
+	}
+}
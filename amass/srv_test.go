@@ -0,0 +1,39 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"testing"
+
+	"github.com/caffix/recon"
+)
+
+func TestSRVProbes(t *testing.T) {
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		if qtype == "SRV" && name == "_ldap._tcp.example.com" {
+			return []recon.DNSAnswer{
+				{Name: name, Type: 33, TTL: 60, Data: "0 100 389 dc1.example.com."},
+				{Name: name, Type: 33, TTL: 60, Data: "0 100 389 ldap.provider.net."},
+				{Name: name, Type: 33, TTL: 60, Data: "0 100 389 dc1.notexample.com."},
+			}, nil
+		}
+		return nil, testNXDOMAIN(name)
+	})()
+
+	srv := NewDNSService(nil, nil)
+	srv.sendSRVTargets("example.com", 0)
+	if len(srv.requeue) != 0 {
+		t.Fatalf("SRV targets were queued before the probes were enabled")
+	}
+
+	srv.SetSRVProbes([]string{"_sip._tcp", "_ldap._tcp"})
+	srv.sendSRVTargets("example.com", 0)
+
+	if len(srv.requeue) != 1 {
+		t.Fatalf("%d SRV targets were queued instead of the single in-scope target", len(srv.requeue))
+	}
+	if req := <-srv.requeue; req.Name != "dc1.example.com" || req.Source != "SRV" {
+		t.Errorf("The SRV target was queued as %+v", req)
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"sync"
+)
+
+// DNSStats - A snapshot of the counters maintained by the DNSService
+type DNSStats struct {
+	// Wildcard filtering results for each domain
+	Domains map[string]*DomainStats
+
+	// Queries answered from the cache, and queries that were sent because no answer was cached
+	CacheHits   int
+	CacheMisses int
+
+	// Queries sent to the nameservers, and how many of them were answered, did not exist or timed out
+	Queries   int
+	Successes int
+	NXDOMAINs int
+	Timeouts  int
+
+	// Resolved names across all domains that were suppressed for matching a wildcard,
+	// and the results delivered to the consumer
+	WildcardFiltered int
+	Emitted          int
+
+	// Input names dropped for being malformed, and names dropped by the name filter
+	Invalid  int
+	Rejected int
+
+	// Resolutions that the confirmation servers disagreed with
+	Anomalies int
+
+	// Requests dropped for reaching the front of the queue after their deadline
+	Expired int
+
+	// Names waiting in the queue when the snapshot was taken
+	QueueDepth int
+}
+
+// DomainStats - Counters maintained for a single domain
+type DomainStats struct {
+	// Resolved names suppressed for matching a wildcard
+	WildcardSuppressed int
+
+	// Results for the domain that were delivered to the consumer
+	Emitted int
+}
+
+type dnsStats struct {
+	sync.Mutex
+	domains     map[string]*DomainStats
+	cacheHits   int
+	cacheMisses int
+	queries     int
+	successes   int
+	nxdomains   int
+	timeouts    int
+	filtered    int
+	emitted     int
+	invalid     int
+	rejected    int
+	anomalies   int
+	expired     int
+}
+
+func newDNSStats() *dnsStats {
+	return &dnsStats{domains: make(map[string]*DomainStats)}
+}
+
+func (s *dnsStats) domain(domain string) *DomainStats {
+	d, found := s.domains[domain]
+	if !found {
+		d = new(DomainStats)
+		s.domains[domain] = d
+	}
+	return d
+}
+
+// wildcardSuppression records a resolved name that was suppressed by the wildcard filter
+func (s *dnsStats) wildcardSuppression(domain string) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.domain(domain).WildcardSuppressed++
+	s.filtered++
+}
+
+// emission records a result that was delivered to the consumer
+func (s *dnsStats) emission(domain string) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.domain(domain).Emitted++
+	s.emitted++
+}
+
+// cacheLookup records whether a query was answered from the cache
+func (s *dnsStats) cacheLookup(hit bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	if hit {
+		s.cacheHits++
+	} else {
+		s.cacheMisses++
+	}
+}
+
+// queryResult records the outcome of a query sent to a nameserver
+func (s *dnsStats) queryResult(err error) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.queries++
+	switch ClassifyError(err) {
+	case nil:
+		s.successes++
+	case ErrNXDOMAIN:
+		s.nxdomains++
+	case ErrTimeout:
+		s.timeouts++
+	}
+}
+
+// invalidName records an input name that was dropped for being malformed
+func (s *dnsStats) invalidName() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.invalid++
+}
+
+// anomaly records a resolution that the confirmation servers disagreed with
+func (s *dnsStats) anomaly() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.anomalies++
+}
+
+// expiredRequest records a request that was dropped for reaching its deadline in the queue
+func (s *dnsStats) expiredRequest() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.expired++
+}
+
+// filteredName records a name that was dropped by the name filter
+func (s *dnsStats) filteredName() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.rejected++
+}
+
+func (s *dnsStats) reset() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.domains = make(map[string]*DomainStats)
+	s.cacheHits, s.cacheMisses = 0, 0
+	s.queries, s.successes, s.nxdomains, s.timeouts = 0, 0, 0, 0
+	s.filtered, s.emitted, s.invalid, s.rejected = 0, 0, 0, 0
+	s.anomalies, s.expired = 0, 0
+}
+
+func (s *dnsStats) snapshot() *DNSStats {
+	s.Lock()
+	defer s.Unlock()
+
+	result := &DNSStats{
+		Domains:     make(map[string]*DomainStats),
+		CacheHits:   s.cacheHits,
+		CacheMisses: s.cacheMisses,
+		Queries:     s.queries,
+		Successes:   s.successes,
+		NXDOMAINs:   s.nxdomains,
+		Timeouts:    s.timeouts,
+
+		WildcardFiltered: s.filtered,
+		Emitted:          s.emitted,
+		Invalid:          s.invalid,
+		Rejected:         s.rejected,
+		Anomalies:        s.anomalies,
+		Expired:          s.expired,
+	}
+	for domain, d := range s.domains {
+		c := *d
+		result.Domains[domain] = &c
+	}
+	return result
+}
+
+// Stats - Returns a snapshot of the counters maintained by the service
+func (ds *DNSService) Stats() *DNSStats {
+	stats := ds.stats.snapshot()
+
+	stats.QueueDepth = ds.QueueDepth()
+	return stats
+}
+
+// ResetStats - Sets all the counters maintained by the service back to zero
+func (ds *DNSService) ResetStats() {
+	ds.stats.reset()
+}
@@ -0,0 +1,108 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caffix/recon"
+)
+
+func TestQueryStats(t *testing.T) {
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		switch name {
+		case "www.example.com":
+			return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "192.0.2.1"}}, nil
+		case "slow.example.com":
+			return nil, ErrTimeout
+		}
+		return nil, testNXDOMAIN(name)
+	})()
+
+	srv := NewDNSService(nil, nil)
+	srv.query("www.example.com", "192.0.2.1:53", "A")
+	srv.query("missing.example.com", "192.0.2.1:53", "A")
+	srv.query("slow.example.com", "192.0.2.1:53", "A")
+	srv.stats.wildcardSuppression("example.com")
+	srv.stats.emission("example.com")
+
+	stats := srv.Stats()
+	if stats.Queries != 3 || stats.Successes != 1 || stats.NXDOMAINs != 1 || stats.Timeouts != 1 {
+		t.Errorf("The query counters were not maintained: %+v", stats)
+	}
+	if stats.WildcardFiltered != 1 || stats.Emitted != 1 {
+		t.Errorf("The wildcard counters were not maintained: %+v", stats)
+	}
+
+	srv.ResetStats()
+	if stats := srv.Stats(); stats.Queries != 0 || stats.Emitted != 0 || len(stats.Domains) != 0 {
+		t.Errorf("The counters were not reset: %+v", stats)
+	}
+}
+
+func TestWildcardFilteringStats(t *testing.T) {
+	// Names under example.com resolve to the wildcard address, except for mail.example.com
+	srv, out, done := newTestService(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		switch {
+		case qtype != "A":
+			return nil, testNoRecords(name)
+		case name == "mail.example.com":
+			return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "192.0.2.7"}}, nil
+		case strings.HasSuffix(name, ".example.com"):
+			return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "192.0.2.50"}}, nil
+		case name == "www.example.org":
+			return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "198.51.100.7"}}, nil
+		}
+		return nil, testNXDOMAIN(name)
+	})
+	defer done()
+	srv.SetWildcardDetection(true)
+	srv.Start()
+
+	for _, req := range []*AmassRequest{
+		{Name: "www.example.com", Domain: "example.com", Tag: BRUTE},
+		{Name: "mail.example.com", Domain: "example.com", Tag: BRUTE},
+		{Name: "www.example.org", Domain: "example.org", Tag: BRUTE},
+	} {
+		srv.performDNSRequest(req)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-out:
+		case <-time.After(time.Second):
+			t.Fatalf("The names that do not match a wildcard were not emitted")
+		}
+	}
+
+	stats := srv.Stats()
+	if d := stats.Domains["example.com"]; d == nil || d.WildcardSuppressed != 1 || d.Emitted != 1 {
+		t.Errorf("The wildcard filtering of example.com was counted as %+v", d)
+	}
+	if d := stats.Domains["example.org"]; d == nil || d.WildcardSuppressed != 0 || d.Emitted != 1 {
+		t.Errorf("The wildcard filtering of example.org was counted as %+v", d)
+	}
+}
+
+func TestDropOutputStats(t *testing.T) {
+	out := make(chan *AmassRequest, 3)
+	srv := NewDNSService(make(chan *AmassRequest), out)
+	srv.SetOutputPolicy(DropOutput)
+
+	// The consumer only has room for three of the results
+	for i := 0; i < 5; i++ {
+		srv.deliver(&AmassRequest{Name: "www.example.com", Domain: "example.com"})
+	}
+
+	received := len(out)
+	stats := srv.Stats()
+	if stats.Emitted != received || srv.DroppedResults() != int64(5-received) {
+		t.Errorf("%d results were counted as emitted and %d as dropped, when %d were received",
+			stats.Emitted, srv.DroppedResults(), received)
+	}
+	if d := stats.Domains["example.com"]; d == nil || d.Emitted != received {
+		t.Errorf("The results emitted for example.com were counted as %+v", d)
+	}
+}
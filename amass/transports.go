@@ -0,0 +1,309 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/caffix/recon"
+	"github.com/miekg/dns"
+)
+
+// Servers can be prefixed with a scheme to select the transport used to reach them.
+// Servers without a scheme are queried over UDP
+const (
+	TransportUDP   = "udp"
+	TransportTCP   = "tcp"
+	TransportTLS   = "tls"
+	TransportHTTPS = "https"
+
+	// The timeout used by the miekg/dns client when the context of a query has no deadline
+	defaultTransportTimeout = 5 * time.Second
+)
+
+// transportOf returns the transport used to reach the server, and the server without the scheme
+func transportOf(server string) (string, string) {
+	if idx := strings.Index(server, "://"); idx != -1 {
+		scheme := strings.ToLower(server[:idx])
+		// The DoH endpoint is the full URL
+		if scheme == TransportHTTPS {
+			return scheme, server
+		}
+		return scheme, server[idx+3:]
+	}
+	return TransportUDP, server
+}
+
+// exchange performs the query over the transport selected by the server, giving up by the deadline of the context
+func exchange(ctx context.Context, name, server, qtype string, opts *EDNSOptions) ([]recon.DNSAnswer, error) {
+	transport, addr := transportOf(server)
+
+	switch transport {
+	case TransportTCP:
+		return clientQuery(ctx, "tcp", name, addr, qtype, opts)
+	case TransportTLS:
+		return clientQuery(ctx, "tcp-tls", name, addr, qtype, opts)
+	case TransportHTTPS:
+		return dohQuery(ctx, name, addr, qtype, opts)
+	}
+
+	if opts != nil {
+		return clientQuery(ctx, "udp", name, server, qtype, opts)
+	}
+	return resolveDNS(ctx, name, server, qtype)
+}
+
+// transportTimeout returns the time remaining until the deadline of the context,
+// or the default transport timeout when the context has no deadline
+func transportTimeout(ctx context.Context) time.Duration {
+	if deadline, ok := ctx.Deadline(); ok {
+		return time.Until(deadline)
+	}
+	return defaultTransportTimeout
+}
+
+// clientQuery performs the query using the miekg/dns client, which gives up by the deadline of the context
+func clientQuery(ctx context.Context, network, name, server, qtype string, opts *EDNSOptions) ([]recon.DNSAnswer, error) {
+	timeout := transportTimeout(ctx)
+	if timeout <= 0 {
+		return []recon.DNSAnswer{}, ErrTimeout
+	}
+
+	qt, found := dns.StringToType[strings.ToUpper(qtype)]
+	if !found {
+		return []recon.DNSAnswer{}, errors.New("Unsupported DNS query type: " + qtype)
+	}
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(name), qt)
+	msg.RecursionDesired = true
+
+	client := &dns.Client{
+		Net:     network,
+		Timeout: timeout,
+	}
+	if opts != nil {
+		client.UDPSize = opts.apply(msg)
+	}
+	r, _, err := client.Exchange(msg, server)
+	if err != nil {
+		return []recon.DNSAnswer{}, err
+	}
+	if r.Rcode != dns.RcodeSuccess {
+		return []recon.DNSAnswer{}, fmt.Errorf("DNS query for %s, type %s returned error %s",
+			name, qtype, dns.RcodeToString[r.Rcode])
+	}
+	// The partial answers would silently lose records
+	if r.Truncated {
+		return []recon.DNSAnswer{}, ErrTruncated
+	}
+
+	var answers []recon.DNSAnswer
+	for _, rr := range r.Answer {
+		if a, ok := convertRR(rr); ok {
+			answers = append(answers, a)
+		}
+	}
+	if len(answers) == 0 {
+		return []recon.DNSAnswer{}, fmt.Errorf("DNS query for %s, type %s returned 0 records", name, qtype)
+	}
+	return answers, nil
+}
+
+// convertRR translates a resource record into the answer format provided by recon
+func convertRR(rr dns.RR) (recon.DNSAnswer, bool) {
+	var data string
+
+	switch t := rr.(type) {
+	case *dns.A:
+		data = t.A.String()
+	case *dns.AAAA:
+		data = t.AAAA.String()
+	case *dns.CNAME:
+		data = t.Target
+	case *dns.DNAME:
+		data = t.Target
+	case *dns.NS:
+		data = t.Ns
+	case *dns.PTR:
+		data = t.Ptr
+	case *dns.MX:
+		data = t.Mx
+	case *dns.TXT:
+		data = strings.Join(t.Txt, " ")
+	case *dns.SOA:
+		data = fmt.Sprintf("%s %s %d %d %d %d %d", t.Ns, t.Mbox, t.Serial, t.Refresh, t.Retry, t.Expire, t.Minttl)
+	case *dns.SRV:
+		data = t.Target
+	case *dns.CAA:
+		data = fmt.Sprintf("%d %s %q", t.Flag, t.Tag, t.Value)
+	default:
+		return recon.DNSAnswer{}, false
+	}
+
+	hdr := rr.Header()
+	return recon.DNSAnswer{
+		Name: strings.TrimSuffix(hdr.Name, "."),
+		Type: int(hdr.Rrtype),
+		TTL:  int(hdr.Ttl),
+		Data: strings.TrimSuffix(data, "."),
+	}, true
+}
+
+// dohResponse is the JSON format returned by DNS-over-HTTPS providers such as Google and Cloudflare
+type dohResponse struct {
+	Status    int  `json:"Status"`
+	Truncated bool `json:"TC"`
+	Answer    []struct {
+		Name string `json:"name"`
+		Type int    `json:"type"`
+		TTL  int    `json:"TTL"`
+		Data string `json:"data"`
+	} `json:"Answer"`
+}
+
+// dohQuery performs the query using the JSON API of a DNS-over-HTTPS endpoint
+func dohQuery(ctx context.Context, name, endpoint, qtype string, opts *EDNSOptions) ([]recon.DNSAnswer, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return []recon.DNSAnswer{}, err
+	}
+
+	q := u.Query()
+	q.Set("name", name)
+	q.Set("type", qtype)
+	if opts != nil && opts.ClientSubnet != nil {
+		q.Set("edns_client_subnet", opts.ClientSubnet.String())
+	}
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return []recon.DNSAnswer{}, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/dns-json")
+
+	client := &http.Client{Timeout: defaultTransportTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return []recon.DNSAnswer{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return []recon.DNSAnswer{}, errors.New("DNS-over-HTTPS query returned status " + strconv.Itoa(resp.StatusCode))
+	}
+
+	var r dohResponse
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return []recon.DNSAnswer{}, err
+	}
+	if r.Status != dns.RcodeSuccess {
+		return []recon.DNSAnswer{}, fmt.Errorf("DNS query for %s, type %s returned error %s",
+			name, qtype, dns.RcodeToString[r.Status])
+	}
+	if r.Truncated {
+		return []recon.DNSAnswer{}, ErrTruncated
+	}
+
+	var answers []recon.DNSAnswer
+	for _, a := range r.Answer {
+		answers = append(answers, recon.DNSAnswer{
+			Name: strings.TrimSuffix(a.Name, "."),
+			Type: a.Type,
+			TTL:  a.TTL,
+			Data: strings.TrimSuffix(a.Data, "."),
+		})
+	}
+	if len(answers) == 0 {
+		return []recon.DNSAnswer{}, fmt.Errorf("DNS query for %s, type %s returned 0 records", name, qtype)
+	}
+	return answers, nil
+}
+
+// MergeTransports - Returns true if names are resolved over every transport with the answers merged
+func (ds *DNSService) MergeTransports() bool {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.mergeTransports
+}
+
+// SetMergeTransports - Causes each name to be resolved over UDP, TCP and the extra transports,
+// merging the answers obtained, since some paths may be blocked in filtered networks
+func (ds *DNSService) SetMergeTransports(enabled bool) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.mergeTransports = enabled
+}
+
+// ExtraTransports - Returns the additional servers used when merging transports
+func (ds *DNSService) ExtraTransports() []string {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.extraTransports
+}
+
+// SetExtraTransports - Sets additional servers used when merging transports, such as
+// DNS-over-TLS servers (tls://1.1.1.1:853) and DNS-over-HTTPS endpoints (https://dns.google/resolve)
+func (ds *DNSService) SetExtraTransports(servers []string) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.extraTransports = servers
+}
+
+// resolveAllTransports resolves the name using the server over UDP and TCP, in addition to the
+// extra transports, and merges the answers. The transports that succeeded are also returned
+func (ds *DNSService) resolveAllTransports(domain, name, server string) ([]recon.DNSAnswer, []string, error) {
+	var err error
+	var truncated bool
+	var merged []recon.DNSAnswer
+	var transports []string
+
+	_, server = transportOf(server)
+	candidates := append([]string{server, TransportTCP + "://" + server}, ds.ExtraTransports()...)
+
+	seen := make(map[string]struct{})
+	for _, candidate := range candidates {
+		answers, qerr := ds.dnsQuery(domain, name, candidate)
+		if qerr == ErrCNAMEDepth {
+			truncated = true
+		} else if qerr != nil {
+			if err == nil || err == ErrNoRecords {
+				err = qerr
+			}
+			continue
+		}
+
+		transport, _ := transportOf(candidate)
+		transports = append(transports, transport)
+		for _, a := range answers {
+			key := a.Name + "|" + strconv.Itoa(a.Type) + "|" + a.Data
+			if _, found := seen[key]; !found {
+				seen[key] = struct{}{}
+				merged = append(merged, a)
+			}
+		}
+	}
+
+	if len(transports) == 0 {
+		return []recon.DNSAnswer{}, transports, err
+	}
+	if truncated {
+		return merged, transports, ErrCNAMEDepth
+	}
+	return merged, transports, nil
+}
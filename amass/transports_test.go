@@ -0,0 +1,120 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/caffix/recon"
+	"github.com/miekg/dns"
+)
+
+func TestTransportOf(t *testing.T) {
+	tests := []struct {
+		server, transport, addr string
+	}{
+		{"8.8.8.8:53", TransportUDP, "8.8.8.8:53"},
+		{"tcp://8.8.8.8:53", TransportTCP, "8.8.8.8:53"},
+		{"tls://1.1.1.1:853", TransportTLS, "1.1.1.1:853"},
+		{"https://dns.google/resolve", TransportHTTPS, "https://dns.google/resolve"},
+	}
+
+	for _, test := range tests {
+		transport, addr := transportOf(test.server)
+		if transport != test.transport || addr != test.addr {
+			t.Errorf("%s was parsed as %s and %s", test.server, transport, addr)
+		}
+	}
+}
+
+func TestClientQueryDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+
+	// The query is not sent once the deadline has passed
+	if _, err := clientQuery(ctx, "udp", "www.example.com", "192.0.2.1:53", "A", nil); err != ErrTimeout {
+		t.Errorf("The expired query returned %v instead of ErrTimeout", err)
+	}
+	if timeout := transportTimeout(context.Background()); timeout != defaultTransportTimeout {
+		t.Errorf("A context without a deadline used a timeout of %v", timeout)
+	}
+	// The default path through recon also stops waiting by the deadline
+	if _, err := reconQuery(ctx, "www.example.com", "192.0.2.1:53", "A"); err != ErrTimeout {
+		t.Errorf("The expired recon query returned %v instead of ErrTimeout", err)
+	}
+}
+
+// startCAAServer starts a local server answering every query with a CAA record,
+// and returns its address along with a function shutting it down
+func startCAAServer(t *testing.T) (string, func()) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen for the test server: %v", err)
+	}
+
+	server := &dns.Server{
+		PacketConn: conn,
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+			m := new(dns.Msg)
+			m.SetReply(req)
+			m.Answer = append(m.Answer, &dns.CAA{
+				Hdr:   dns.RR_Header{Name: req.Question[0].Name, Rrtype: dns.TypeCAA, Class: dns.ClassINET, Ttl: 60},
+				Flag:  0,
+				Tag:   "issue",
+				Value: "ca.example.net",
+			})
+			w.WriteMsg(m)
+		}),
+	}
+	go server.ActivateAndServe()
+	return conn.LocalAddr().String(), func() { server.Shutdown() }
+}
+
+func TestClientQueryCAA(t *testing.T) {
+	addr, stop := startCAAServer(t)
+	defer stop()
+
+	// The miekg/dns client converts the records using convertRR
+	answers, err := clientQuery(context.Background(), "udp", "example.com", addr, "CAA", nil)
+	if err != nil || len(answers) != 1 {
+		t.Fatalf("The CAA record was not returned: %v", err)
+	}
+	if a := answers[0]; a.Type != 257 || a.Name != "example.com" || a.Data != "0 issue \"ca.example.net\"" {
+		t.Errorf("The CAA record was converted as %+v", a)
+	}
+}
+
+// transportResolver only answers the queries sent over TCP
+type transportResolver struct{}
+
+func (transportResolver) Resolve(name, server, qtype string) ([]recon.DNSAnswer, error) {
+	if transport, _ := transportOf(server); transport != TransportTCP {
+		return nil, ErrTimeout
+	}
+	if qtype != "A" {
+		return nil, testNoRecords(name)
+	}
+	return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "192.0.2.1"}}, nil
+}
+
+func TestMergeTransports(t *testing.T) {
+	srv, _, done := newTestService(nil)
+	defer done()
+
+	srv.SetResolver(transportResolver{})
+	srv.SetExtraTransports([]string{"tls://192.0.2.1:853"})
+
+	// The answers obtained over TCP are not reported for the other transports
+	answers, transports, err := srv.resolveAllTransports("example.com", "www.example.com", "192.0.2.1:53")
+	if err != nil || len(answers) != 1 {
+		t.Fatalf("The name was not resolved over TCP: %v", err)
+	}
+	if len(transports) != 1 || transports[0] != TransportTCP {
+		t.Errorf("The name was reported as resolved over %v", transports)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import "strings"
+
+// Record types checked for the name and the wildcard, since real names often have
+// records that the wildcard does not provide
+var distinguishingTypes = []string{"MX", "TXT", "NS"}
+
+// WildcardVerdict - The detailed outcome of verifying a wildcard suppression
+type WildcardVerdict struct {
+	Name   string
+	Domain string
+
+	// Set when the name is indistinguishable from the wildcard
+	Wildcard bool
+
+	// The subdomain with the wildcard that the name matched
+	Subdomain string
+
+	// The addresses returned for the name and for the wildcard
+	NameAnswers     []string
+	WildcardAnswers []string
+
+	// Addresses returned for the name that the wildcard does not provide
+	DistinctAnswers []string
+
+	// Record types returned for the name that the wildcard does not provide
+	DistinguishingRecords []string
+
+	// A description of how the verdict was reached
+	Reason string
+}
+
+// VerifyWildcardName - Performs targeted checks to determine if a name suppressed as a wildcard
+// match is truly a wildcard, or a real name that happens to share the addresses of the wildcard
+func (ds *DNSService) VerifyWildcardName(name, domain string) *WildcardVerdict {
+	verdict := &WildcardVerdict{
+		Name:   name,
+		Domain: domain,
+	}
+
+	answers, server, err := ds.resolveName(domain, name)
+	if err != nil && err != ErrCNAMEDepth {
+		verdict.Reason = "The name did not resolve: " + err.Error()
+		return verdict
+	}
+	addrs := addressSet(answers)
+	verdict.NameAnswers = sortedStrings(addrs)
+
+	// Detection is performed again, bypassing the cache, starting with the closest subdomain
+	base := len(strings.Split(domain, "."))
+	labels := strings.Split(name, ".")
+	var wildcard *dnsWildcard
+	for i := 1; i <= len(labels)-base; i++ {
+		sub := strings.Join(labels[i:], ".")
+
+		if w := ds.wildcardDetection(sub, domain); w.HasWildcard && w.Answers.ContainsAny(verdict.NameAnswers) {
+			verdict.Subdomain = sub
+			wildcard = w
+			break
+		}
+	}
+	if wildcard == nil {
+		verdict.Reason = "No wildcard provides the addresses of the name"
+		return verdict
+	}
+	verdict.WildcardAnswers = sortedStrings(wildcard.Answers)
+
+	for _, addr := range verdict.NameAnswers {
+		if !wildcard.Answers.Contains(addr) {
+			verdict.DistinctAnswers = append(verdict.DistinctAnswers, addr)
+		}
+	}
+
+	if probe := ds.probeName(verdict.Subdomain); probe != "" {
+		verdict.DistinguishingRecords = ds.distinguishingRecords(name, probe, server)
+	}
+
+	switch {
+	case len(verdict.DistinctAnswers) > 0:
+		verdict.Reason = "The name returned addresses not provided by the wildcard"
+	case len(verdict.DistinguishingRecords) > 0:
+		verdict.Reason = "The name has records not provided by the wildcard"
+	default:
+		verdict.Wildcard = true
+		verdict.Reason = "The name is indistinguishable from the wildcard at " + verdict.Subdomain
+	}
+	return verdict
+}
+
+// distinguishingRecords returns the record types provided for the name and not the probe
+func (ds *DNSService) distinguishingRecords(name, probe, server string) []string {
+	var types []string
+
+	for _, qtype := range distinguishingTypes {
+		ans, err := ds.query(name, server, qtype)
+		if err != nil || len(ans) == 0 {
+			continue
+		}
+
+		found := answersToStringSet(ans)
+		pans, err := ds.query(probe, server, qtype)
+		if err != nil || len(pans) == 0 {
+			types = append(types, qtype)
+			continue
+		}
+		// The wildcard records are expected to match those of the name
+		if wild := answersToStringSet(pans); !found.Equal(wild) || !wild.Equal(found) {
+			types = append(types, qtype)
+		}
+	}
+	return types
+}
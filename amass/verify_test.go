@@ -0,0 +1,36 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"testing"
+
+	"github.com/caffix/recon"
+)
+
+func TestVerifyWildcardName(t *testing.T) {
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		switch qtype {
+		case "A":
+			return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "192.0.2.50"}}, nil
+		case "MX":
+			if name == "mail.example.com" {
+				return []recon.DNSAnswer{{Name: name, Type: 15, TTL: 60, Data: "mx.example.com"}}, nil
+			}
+		}
+		return nil, testNoRecords(name)
+	})()
+
+	srv := NewDNSService(nil, nil)
+
+	v := srv.VerifyWildcardName("www.example.com", "example.com")
+	if !v.Wildcard || v.Subdomain != "example.com" {
+		t.Errorf("The wildcard name was not verified: %s", v.Reason)
+	}
+
+	v = srv.VerifyWildcardName("mail.example.com", "example.com")
+	if v.Wildcard || len(v.DistinguishingRecords) != 1 || v.DistinguishingRecords[0] != "MX" {
+		t.Errorf("The MX record did not distinguish the name from the wildcard: %s", v.Reason)
+	}
+}
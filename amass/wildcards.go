@@ -0,0 +1,205 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caffix/amass/amass/stringset"
+)
+
+// ExportWildcards - Returns the wildcard detection results for each subdomain, so they can be
+// provided to LoadWildcards in a later scan. Subdomains without a wildcard have no answers
+func (ds *DNSService) ExportWildcards() map[string][]string {
+	wc := ds.knownWildcards
+	wc.Lock()
+	defer wc.Unlock()
+
+	result := make(map[string][]string)
+	for sub, entry := range wc.entries {
+		if entry.HasWildcard {
+			result[sub] = wildcardAnswers(entry)
+		} else {
+			result[sub] = []string{}
+		}
+	}
+	return result
+}
+
+// LoadWildcards - Seeds the wildcard cache with results exported from an earlier scan, so the
+// subdomains are not probed again. This must be called before Start
+func (ds *DNSService) LoadWildcards(entries map[string][]string) {
+	wc := ds.knownWildcards
+	wc.Lock()
+	defer wc.Unlock()
+
+	for sub, answers := range entries {
+		entry := &dnsWildcard{Type: WildcardNone, Loaded: true}
+		if len(answers) > 0 {
+			entry.Type = WildcardAnswers
+			entry.HasWildcard = true
+			entry.Answers = stringset.NewStringSet()
+			entry.Answers.AddAll(answers)
+		}
+		wc.entries[sub] = entry
+	}
+}
+
+// ExpireLoadedWildcards - Causes the entries provided by LoadWildcards to be probed again
+// the next time they are needed, while keeping the results of detection in this scan
+func (ds *DNSService) ExpireLoadedWildcards() {
+	wc := ds.knownWildcards
+	wc.Lock()
+	defer wc.Unlock()
+
+	// Any time in the past marks the entry as needing re-evaluation
+	expired := time.Unix(1, 0)
+	for _, entry := range wc.entries {
+		if entry.Loaded {
+			entry.Expires = expired
+		}
+	}
+}
+
+// AsyncWildcards - Returns true if resolved names are emitted before wildcard detection completes
+func (ds *DNSService) AsyncWildcards() bool {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.asyncWildcards
+}
+
+// SetAsyncWildcards - Determines if names within subdomains that have not been probed yet are
+// emitted without waiting for the wildcard detection. Such names are marked as provisional, and
+// the ones found to match a wildcard once the detection completes are sent to the Retractions
+// channel. Names within subdomains that have already been probed are always checked before being emitted
+func (ds *DNSService) SetAsyncWildcards(enabled bool) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.asyncWildcards = enabled
+}
+
+// Retractions - Returns the channel receiving the provisional names found to match a wildcard
+func (ds *DNSService) Retractions() chan *AmassRequest {
+	ds.Lock()
+	defer ds.Unlock()
+
+	return ds.retractions
+}
+
+// SetRetractions - Sets the channel receiving the provisional names found to match a wildcard
+// after they were emitted. Each retraction waits for the consumer, so none are lost while the
+// channel is full. ErrWildcardMatch is also sent for the name to the ErrorOutput
+func (ds *DNSService) SetRetractions(retractions chan *AmassRequest) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	ds.retractions = retractions
+}
+
+// PrewarmWildcards - Performs the wildcard detection for the subdomains of the domain, and each
+// level above them, before the names within them are resolved. This allows brute forcing to
+// begin without waiting on the probes. The subdomains are probed concurrently
+func (ds *DNSService) PrewarmWildcards(domain string, subdomains []string) {
+	var wg sync.WaitGroup
+
+	for _, sub := range subdomains {
+		wg.Add(1)
+		go func(sub string) {
+			defer wg.Done()
+
+			// The levels of a name within the subdomain end with the subdomain itself
+			for _, level := range append(wildcardLevels(sub, domain), sub) {
+				ds.knownWildcards.get(level, domain)
+			}
+		}(sub)
+	}
+	wg.Wait()
+}
+
+// checkWildcards returns true when the name matches a wildcard. In the async mode, names
+// that would wait on the detection are checked in the background and false is returned
+func (ds *DNSService) checkWildcards(req *AmassRequest, server string) bool {
+	if !ds.AsyncWildcards() {
+		return ds.dnsWildcardMatch(req)
+	}
+	if match, complete := ds.cachedWildcardMatch(req); complete {
+		return match
+	}
+
+	// Names from searches are emitted whatever the detection finds
+	if req.Tag == SEARCH {
+		return false
+	}
+
+	// The copy is checked, since the request is still being processed while the detection runs
+	req.Provisional = true
+	c := *req
+	ds.goWork(func() {
+		if ds.dnsWildcardMatch(&c) {
+			ds.retract(&c, server)
+		}
+	})
+	return false
+}
+
+// retract reports the provisional name that was found to match a wildcard after being emitted
+func (ds *DNSService) retract(req *AmassRequest, server string) {
+	ds.sendError(req, server, ErrWildcardMatch)
+	// The provisional result remains counted as emitted, since it was delivered
+	ds.stats.wildcardSuppression(req.Domain)
+	ds.MetricsExporter().AddCounter(MetricWildcardSuppressions, 1, map[string]string{"domain": req.Domain})
+
+	retractions := ds.Retractions()
+	if retractions == nil {
+		return
+	}
+	select {
+	case retractions <- req:
+	case <-ds.Quit():
+	}
+}
+
+// cachedWildcardMatch checks the name using only the cached detection results,
+// and complete is false when any of the subdomains still needs to be probed
+func (ds *DNSService) cachedWildcardMatch(req *AmassRequest) (match, complete bool) {
+	if !ds.WildcardDetection() {
+		return false, true
+	}
+	// Whitelisted addresses are never wildcard matches, whatever detection found
+	if ds.whitelisted(append([]string{req.Address}, req.Addresses...)) {
+		return false, true
+	}
+
+	addrs := req.Addresses
+	if len(addrs) == 0 {
+		addrs = []string{req.Address}
+	}
+
+	for _, sub := range wildcardLevels(req.Name, req.Domain) {
+		w := ds.knownWildcards.cached(sub)
+		if w == nil {
+			return false, false
+		}
+		if w.HasWildcard && w.Answers.ContainsAll(addrs) {
+			match = true
+		}
+	}
+	return match, true
+}
+
+// wildcardLevels returns the subdomains checked for wildcards, starting with the root domain
+func wildcardLevels(name, root string) []string {
+	var levels []string
+
+	base := len(strings.Split(root, "."))
+	labels := strings.Split(name, ".")
+	for i := len(labels) - base; i > 0; i-- {
+		levels = append(levels, strings.Join(labels[i:], "."))
+	}
+	return levels
+}
@@ -0,0 +1,325 @@
+// Copyright 2017 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package amass
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caffix/recon"
+)
+
+func TestLoadWildcards(t *testing.T) {
+	var queries int
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		queries++
+		return nil, testNXDOMAIN(name)
+	})()
+
+	srv := NewDNSService(make(chan *AmassRequest), make(chan *AmassRequest, 10))
+	srv.LoadWildcards(map[string][]string{
+		"example.com":     {"192.0.2.50"},
+		"dev.example.com": {},
+	})
+	srv.Start()
+	defer srv.Stop()
+
+	if !srv.dnsWildcardMatch(&AmassRequest{Name: "www.example.com", Domain: "example.com", Address: "192.0.2.50"}) {
+		t.Errorf("The loaded wildcard was not matched")
+	}
+	if queries != 0 {
+		t.Errorf("%d probe queries were sent for a loaded wildcard", queries)
+	}
+
+	exported := srv.ExportWildcards()
+	if a := exported["example.com"]; len(a) != 1 || a[0] != "192.0.2.50" {
+		t.Errorf("The wildcard was not exported: %v", exported)
+	}
+	if a, found := exported["dev.example.com"]; !found || len(a) != 0 {
+		t.Errorf("The subdomain without a wildcard was not exported: %v", exported)
+	}
+
+	srv.ExpireLoadedWildcards()
+	if srv.dnsWildcardMatch(&AmassRequest{Name: "www.example.com", Domain: "example.com", Address: "192.0.2.50"}) {
+		t.Errorf("The expired wildcard was still matched")
+	}
+	if queries == 0 {
+		t.Errorf("The expired wildcard was not probed again")
+	}
+}
+
+func TestAsyncWildcards(t *testing.T) {
+	// Every name within the zone resolves to the same address
+	srv, out, done := newTestService(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		if qtype == "A" {
+			return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "192.0.2.1"}}, nil
+		}
+		return nil, testNoRecords(name)
+	})
+	defer done()
+	srv.SetWildcardDetection(true)
+
+	errs := make(chan error, 10)
+	retractions := make(chan *AmassRequest)
+	srv.SetAsyncWildcards(true)
+	srv.SetErrorOutput(errs)
+	srv.SetRetractions(retractions)
+	srv.Start()
+
+	// The name is emitted before the zone has been probed, and retracted afterwards
+	srv.performDNSRequest(&AmassRequest{Name: "www.example.com", Domain: "example.com", Tag: BRUTE})
+	select {
+	case req := <-out:
+		if req.Name != "www.example.com" || !req.Provisional {
+			t.Errorf("The name was emitted as %+v", req)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("The name was not emitted before the detection completed")
+	}
+	// The unbuffered channel does not lose the retraction
+	select {
+	case req := <-retractions:
+		if req.Name != "www.example.com" {
+			t.Errorf("%s was retracted instead of the name", req.Name)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("The name matching the wildcard was not retracted")
+	}
+	if err := srv.WaitUntilIdle(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-errs:
+		if re, ok := err.(*ResolutionError); !ok || re.Name != "www.example.com" || re.Err != ErrWildcardMatch {
+			t.Errorf("The name was retracted with %v", err)
+		}
+	default:
+		t.Error("ErrWildcardMatch was not sent for the retracted name")
+	}
+	// The provisional result was delivered before it was retracted
+	if stats := srv.Stats().Domains["example.com"]; stats.Emitted != 1 || stats.WildcardSuppressed != 1 {
+		t.Errorf("The retracted name was counted as %+v", stats)
+	}
+
+	// Once the zone has been probed, names matching the wildcard are not emitted
+	srv.performDNSRequest(&AmassRequest{Name: "ftp.example.com", Domain: "example.com", Tag: BRUTE})
+	if err := srv.WaitUntilIdle(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case req := <-out:
+		t.Errorf("%s was emitted after the wildcard had been detected", req.Name)
+	default:
+	}
+}
+
+func TestPrewarmWildcards(t *testing.T) {
+	var probes int32
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		atomic.AddInt32(&probes, 1)
+		return nil, testNXDOMAIN(name)
+	})()
+
+	srv := NewDNSService(nil, nil)
+	srv.PrewarmWildcards("example.com", []string{"dev.example.com", "www.dev.example.com"})
+
+	for _, sub := range []string{"example.com", "dev.example.com", "www.dev.example.com"} {
+		if srv.knownWildcards.cached(sub) == nil {
+			t.Errorf("The detection was not performed for %s", sub)
+		}
+	}
+
+	sent := atomic.LoadInt32(&probes)
+	req := &AmassRequest{Name: "host.www.dev.example.com", Domain: "example.com", Address: "192.0.2.1"}
+	if match, complete := srv.cachedWildcardMatch(req); match || !complete {
+		t.Errorf("The prewarmed subdomains returned match %t and complete %t", match, complete)
+	}
+	if atomic.LoadInt32(&probes) != sent {
+		t.Errorf("The prewarmed subdomains were probed again")
+	}
+}
+
+func TestWildcardDetectionCoalesced(t *testing.T) {
+	var probes int32
+	release := make(chan struct{})
+	wildcards := newWildcardCache(func(sub, root string) *dnsWildcard {
+		atomic.AddInt32(&probes, 1)
+		<-release
+		return &dnsWildcard{HasWildcard: false}
+	})
+
+	var wg sync.WaitGroup
+	results := make(chan *dnsWildcard, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results <- wildcards.get("sub.example.com", "example.com")
+		}()
+	}
+	// The callers wait on the detection that is already in progress
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(results)
+
+	if n := atomic.LoadInt32(&probes); n != 1 {
+		t.Errorf("The subdomain was probed %d times by the concurrent callers", n)
+	}
+	first := <-results
+	for w := range results {
+		if w != first {
+			t.Errorf("The concurrent callers did not share the detection result")
+			break
+		}
+	}
+}
+
+func TestWildcardChanges(t *testing.T) {
+	var lock sync.Mutex
+	wildcard := "192.0.2.100"
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if qtype != "A" {
+			return nil, testNoRecords(name)
+		}
+		return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: wildcard}}, nil
+	})()
+
+	changes := make(chan *WildcardChange, 10)
+	srv := NewDNSService(nil, nil)
+	srv.SetWildcardTTL(50 * time.Millisecond)
+	srv.SetWildcardChangeOutput(changes)
+
+	// The first detection is not a change
+	srv.knownWildcards.get("example.com", "example.com")
+	srv.knownWildcards.get("example.com", "example.com")
+	waitForWork(srv)
+	if len(changes) != 0 {
+		t.Fatalf("A change was reported before the entry expired")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	srv.knownWildcards.get("example.com", "example.com")
+	waitForWork(srv)
+	if len(changes) != 1 {
+		t.Fatalf("The re-evaluation of the expired entry was not reported")
+	}
+	if change := <-changes; change.Subdomain != "example.com" || change.Changed {
+		t.Errorf("The unchanged wildcard was reported as %+v", change)
+	}
+
+	lock.Lock()
+	wildcard = "192.0.2.200"
+	lock.Unlock()
+
+	time.Sleep(60 * time.Millisecond)
+	srv.knownWildcards.get("example.com", "example.com")
+	waitForWork(srv)
+	if len(changes) != 1 {
+		t.Fatalf("The re-evaluation of the expired entry was not reported")
+	}
+	change := <-changes
+	if !change.Changed || len(change.OldAnswers) != 1 || change.OldAnswers[0] != "192.0.2.100" ||
+		len(change.NewAnswers) != 1 || change.NewAnswers[0] != "192.0.2.200" {
+		t.Errorf("The changed wildcard was reported as %+v", change)
+	}
+}
+
+func BenchmarkCachedWildcardMatch(b *testing.B) {
+	defer useTestResolver(nil)()
+
+	srv := NewDNSService(make(chan *AmassRequest), make(chan *AmassRequest))
+	srv.LoadWildcards(map[string][]string{
+		"example.com":     {},
+		"www.example.com": {},
+	})
+	srv.Start()
+	defer srv.Stop()
+
+	req := &AmassRequest{Name: "www.example.com", Domain: "example.com", Address: "192.0.2.1"}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			srv.dnsWildcardMatch(req)
+		}
+	})
+}
+
+func BenchmarkWildcardDetection(b *testing.B) {
+	benchmarkWildcardDetection(b, false)
+}
+
+func BenchmarkAsyncWildcardDetection(b *testing.B) {
+	benchmarkWildcardDetection(b, true)
+}
+
+// benchmarkWildcardDetection resolves names within subdomains that have not been probed
+func benchmarkWildcardDetection(b *testing.B, async bool) {
+	defer useTestResolver(func(name, server, qtype string) ([]recon.DNSAnswer, error) {
+		if strings.HasPrefix(name, "host.") {
+			if qtype == "A" {
+				return []recon.DNSAnswer{{Name: name, Type: 1, TTL: 60, Data: "192.0.2.1"}}, nil
+			}
+			return nil, testNoRecords(name)
+		}
+		// The wildcard probes wait on the network
+		time.Sleep(2 * time.Millisecond)
+		return nil, testNXDOMAIN(name)
+	})()
+
+	out := make(chan *AmassRequest, 100)
+	srv := NewDNSService(make(chan *AmassRequest), out)
+	srv.SetAsyncWildcards(async)
+	srv.LoadWildcards(map[string][]string{"example.com": {}})
+	srv.Start()
+	defer srv.Stop()
+
+	go func() {
+		for range out {
+		}
+	}()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		srv.performDNSRequest(&AmassRequest{
+			Name:   fmt.Sprintf("host.sub%d.example.com", i),
+			Domain: "example.com",
+			Tag:    BRUTE,
+		})
+	}
+}
+
+func TestWildcardMatchStopped(t *testing.T) {
+	defer useTestResolver(nil)()
+
+	// The service has not been started, so no worker answers the buffered request
+	srv := NewDNSService(nil, nil)
+	srv.SetWildcardBuffer(1)
+
+	result := make(chan bool, 1)
+	go func() {
+		result <- srv.dnsWildcardMatch(&AmassRequest{Name: "www.example.com", Domain: "example.com", Address: "192.0.2.1"})
+	}()
+	for deadline := time.Now().Add(time.Second); len(srv.wildcards) == 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	srv.Stop()
+
+	select {
+	case match := <-result:
+		if match {
+			t.Errorf("The unanswered request was reported as a wildcard match")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("The wildcard match did not return once the service stopped")
+	}
+}